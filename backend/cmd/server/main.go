@@ -1,13 +1,19 @@
 package main
 
 import (
+	"errors"
 	"log"
+	"time"
 
 	"dalivim/internal/config"
 	"dalivim/internal/database"
 	handler "dalivim/internal/handlers"
+	"dalivim/internal/models"
+	"dalivim/internal/queue"
 	"dalivim/internal/repository"
 	"dalivim/internal/router"
+	"dalivim/internal/rules"
+	"dalivim/internal/scoring"
 	"dalivim/internal/service"
 )
 
@@ -31,25 +37,180 @@ func main() {
 	activityRepo := repository.NewActivityRepository(db)
 	submissionRepo := repository.NewSubmissionRepository(db)
 	telemetryRepo := repository.NewTelemetryRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	queueRepo := repository.NewQueueRepository(db)
+	archiveRepo := repository.NewArchiveRepository(db)
+	semesterRepo := repository.NewSemesterRepository(db)
+	similarityRepo := repository.NewSimilarityRepository(db)
+	similarityJobRepo := repository.NewSimilarityJobRepository(db)
+	outageRepo := repository.NewOutageRepository(db)
+	ruleRepo := repository.NewRuleRepository(db)
+	baselineRepo := repository.NewBaselineRepository(db)
+	profileRepo := repository.NewKeystrokeProfileRepository(db)
+	labelRepo := repository.NewLabelRepository(db)
+	runRepo := repository.NewAnalysisRunRepository(db)
+	jobRepo := repository.NewReanalysisJobRepository(db)
+
+	// Load analysis rules
+	analysisRules := rules.Defaults()
+	if cfg.Analysis.RulesFile != "" {
+		analysisRules, err = rules.LoadFile(cfg.Analysis.RulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Initialize telemetry ingestion queue
+	var telemetryQueue queue.Queue
+	switch cfg.Queue.Backend {
+	case "database":
+		telemetryQueue = queue.NewDatabaseQueue(queueRepo, cfg.Queue.Capacity)
+	default:
+		telemetryQueue = queue.NewMemoryQueue(cfg.Queue.Capacity)
+	}
+
+	// Initialize analysis detectors
+	detectors := service.NewDetectorRegistry()
+	detectorList := append(
+		service.DefaultDetectors(),
+		service.NewBaselineDetector(baselineRepo),
+		service.NewIdentityDetector(profileRepo),
+		service.NewStylometryDetector(submissionRepo),
+		service.NewTypingConsistencyDetector(),
+		service.NewTimelineDetector(),
+	)
+	for _, detector := range detectorList {
+		if err := detectors.Register(detector); err != nil {
+			log.Fatal(err)
+		}
+	}
+	detectorWeights, err := service.ParseDetectorWeights(cfg.Analysis.DetectorWeights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	aggregator, err := service.NewAggregator(cfg.Analysis.Aggregator, detectorWeights)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load the trained scoring model, if any
+	var scoringModel *scoring.Model
+	if cfg.Analysis.ModelFile != "" {
+		scoringModel, err = scoring.Load(cfg.Analysis.ModelFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Using scoring model %s", scoringModel.Version)
+	}
 
 	// Initialize services
 	authService := service.NewAuthService(userRepo)
-	activityService := service.NewActivityService(activityRepo, userRepo)
-	analysisService := service.NewAnalysisService()
+	activityService := service.NewActivityService(activityRepo, userRepo, sessionRepo)
+	analysisService := service.NewAnalysisService(ruleRepo, userRepo, analysisRules, detectors, aggregator, scoringModel)
+	proctoringService := service.NewProctoringService()
+	telemetryPipeline := service.NewTelemetryPipeline(telemetryQueue, telemetryRepo, queueRepo, cfg.Queue)
 	telemetryService := service.NewTelemetryService(
 		telemetryRepo,
 		submissionRepo,
 		userRepo,
+		sessionRepo,
+		activityRepo,
+		outageRepo,
+		archiveRepo,
+		profileRepo,
 		analysisService,
+		proctoringService,
+		telemetryPipeline,
+		cfg.Analysis.Workers,
+	)
+	cohortService := service.NewCohortService(submissionRepo, analysisService)
+	labelService := service.NewLabelService(labelRepo, submissionRepo, activityRepo)
+	reanalysisService := service.NewReanalysisService(
+		jobRepo,
+		runRepo,
+		submissionRepo,
+		telemetryRepo,
+		archiveRepo,
+		activityRepo,
+		analysisService,
+	)
+	similarityService := service.NewSimilarityService(
+		similarityRepo,
+		similarityJobRepo,
+		submissionRepo,
+		activityRepo,
+	)
+	semesterService := service.NewSemesterService(semesterRepo, userRepo, activityRepo, cfg.Retention)
+	streamService := service.NewTelemetryStreamService(sessionRepo, telemetryService)
+	retentionService := service.NewRetentionService(
+		archiveRepo,
+		telemetryRepo,
+		activityRepo,
+		semesterRepo,
+		cfg.Retention,
 	)
 
 	// Initialize handlers
 	authHandler := handler.NewAuthHandler(authService)
 	activityHandler := handler.NewActivityHandler(activityService)
-	telemetryHandler := handler.NewTelemetryHandler(telemetryService)
+	telemetryHandler := handler.NewTelemetryHandler(telemetryService, activityService)
+	streamHandler := handler.NewStreamHandler(streamService)
+	proctorHandler := handler.NewProctoringHandler(proctoringService, activityService)
+	rulesHandler := handler.NewAnalysisRulesHandler(analysisService, activityService)
+	cohortHandler := handler.NewCohortHandler(cohortService, activityService)
+	labelHandler := handler.NewLabelHandler(labelService)
+	reanalysisHandler := handler.NewReanalysisHandler(reanalysisService)
+	similarityHandler := handler.NewSimilarityHandler(similarityService, activityService)
+	semesterHandler := handler.NewSemesterHandler(semesterService)
+
+	// Compare each submission with its cohort once an activity closes and
+	// the last finals are analyzed
+	activityService.OnClose(func(activity *models.Activity) error {
+		if !telemetryService.WaitAnalyzed(activity.ID, time.Minute) {
+			log.Printf("analyses of activity %d still pending, comparing the analyzed submissions", activity.ID)
+		}
+		_, err := cohortService.AnalyzeActivity(activity.ID)
+		if errors.Is(err, service.ErrCohortTooSmall) {
+			return nil
+		}
+		return err
+	})
+
+	// Stop the live feed of a closed activity
+	activityService.OnClose(func(activity *models.Activity) error {
+		proctoringService.Forget(activity.ID)
+		return nil
+	})
+
+	// Compare the submissions of an activity with each other once it closes
+	activityService.OnClose(func(activity *models.Activity) error {
+		_, err := similarityService.StartDetection(activity.ID, models.SimilarityTriggerClose)
+		if errors.Is(err, service.ErrSimilarityJobRunning) {
+			return nil
+		}
+		return err
+	})
+
+	// Start background jobs
+	go proctoringService.Run()
+	telemetryPipeline.Start()
+	telemetryService.Start()
+	go retentionService.Run()
 
 	// Setup router
-	r := router.NewRouter(authHandler, activityHandler, telemetryHandler)
+	r := router.NewRouter(
+		authHandler,
+		activityHandler,
+		telemetryHandler,
+		streamHandler,
+		proctorHandler,
+		rulesHandler,
+		cohortHandler,
+		labelHandler,
+		reanalysisHandler,
+		similarityHandler,
+		semesterHandler,
+	)
 	engine := r.Setup()
 
 	// Start server
@@ -0,0 +1,121 @@
+// Command trainer trains and evaluates authorship models offline from the
+// labeled submissions export.
+//
+//	trainer train -data labels.csv -out model.json -version 2026.1
+//	trainer evaluate -data labels.csv -model model.json
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"dalivim/internal/scoring"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "train":
+		train(os.Args[2:])
+	case "evaluate":
+		evaluate(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: trainer train|evaluate [flags]")
+	os.Exit(2)
+}
+
+func train(args []string) {
+	defaults := scoring.DefaultOptions()
+
+	fs := flag.NewFlagSet("train", flag.ExitOnError)
+	data := fs.String("data", "", "labeled submissions CSV")
+	out := fs.String("out", "model.json", "model artifact to write")
+	version := fs.String("version", "", "model version")
+	epochs := fs.Int("epochs", defaults.Epochs, "gradient descent epochs")
+	rate := fs.Float64("lr", defaults.LearningRate, "learning rate")
+	l2 := fs.Float64("l2", defaults.L2, "L2 regularization")
+	holdout := fs.Float64("holdout", defaults.Holdout, "share of samples kept for evaluation")
+	seed := fs.Int64("seed", defaults.Seed, "shuffle seed")
+	fs.Parse(args)
+
+	if *data == "" || *version == "" {
+		log.Fatal("-data and -version are required")
+	}
+
+	samples := readSamples(*data)
+	model, err := scoring.Train(samples, scoring.Options{
+		Version:      *version,
+		Epochs:       *epochs,
+		LearningRate: *rate,
+		L2:           *l2,
+		Holdout:      *holdout,
+		Seed:         *seed,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := model.Save(*out); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("trained model %s on %d samples, written to %s", model.Version, model.Samples, *out)
+
+	if model.Metrics != nil {
+		printMetrics(*model.Metrics)
+	}
+}
+
+func evaluate(args []string) {
+	fs := flag.NewFlagSet("evaluate", flag.ExitOnError)
+	data := fs.String("data", "", "labeled submissions CSV")
+	path := fs.String("model", "model.json", "model artifact")
+	fs.Parse(args)
+
+	if *data == "" {
+		log.Fatal("-data is required")
+	}
+
+	model, err := scoring.Load(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printMetrics(scoring.Evaluate(model, readSamples(*data)))
+}
+
+func readSamples(path string) []scoring.Sample {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	samples, err := scoring.ReadSamples(file)
+	if err != nil {
+		log.Fatalf("%s: %v", path, err)
+	}
+	return samples
+}
+
+func printMetrics(metrics scoring.Metrics) {
+	fmt.Printf("samples    %d\n", metrics.Samples)
+	fmt.Printf("accuracy   %.3f\n", metrics.Accuracy)
+	fmt.Printf("precision  %.3f\n", metrics.Precision)
+	fmt.Printf("recall     %.3f\n", metrics.Recall)
+	fmt.Printf("f1         %.3f\n", metrics.F1)
+	fmt.Printf("log loss   %.3f\n", metrics.LogLoss)
+	fmt.Println("calibration (predicted -> observed)")
+	for _, point := range metrics.Calibration {
+		fmt.Printf("  %.1f-%.1f  n=%-4d %.3f -> %.3f\n", point.From, point.To, point.Count, point.Predicted, point.Observed)
+	}
+}
@@ -0,0 +1,94 @@
+// Package archive encodes compacted telemetry and exports it to local files.
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+// Config drives the retention job
+type Config struct {
+	Dir          string        // Where archives are exported before deletion
+	Interval     time.Duration // How often the job runs
+	CompactAfter time.Duration // Age after which per-tick rows are compacted
+
+	// Used for activities without a semester
+	DefaultRawRetentionDays     int
+	DefaultFeatureRetentionDays int
+}
+
+// Encode writes rows as gzip-compressed JSONL
+func Encode(rows []models.TelemetryData) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+
+	for _, row := range rows {
+		if err := enc.Encode(row); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads rows written by Encode
+func Decode(data []byte) ([]models.TelemetryData, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	var rows []models.TelemetryData
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var row models.TelemetryData
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// Export writes an encoded archive to <dir>/activity-<id>/<name>.jsonl.gz and
+// returns its path. Existing files are never overwritten.
+func Export(dir string, activityID uint, name string, data []byte) (string, error) {
+	folder := filepath.Join(dir, fmt.Sprintf("activity-%d", activityID))
+	if err := os.MkdirAll(folder, 0o750); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(folder, name+".jsonl.gz")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
@@ -3,13 +3,33 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"time"
 
+	"dalivim/internal/archive"
 	"dalivim/internal/database"
+	"dalivim/internal/queue"
 )
 
 type Config struct {
-	Database database.Config
-	Server   ServerConfig
+	Database  database.Config
+	Server    ServerConfig
+	Queue     queue.Config
+	Retention archive.Config
+	Analysis  AnalysisConfig
+}
+
+type AnalysisConfig struct {
+	// RulesFile is an optional YAML file overriding the default rules
+	RulesFile string
+	// Aggregator combines detector scores: sum, weighted or max
+	Aggregator string
+	// DetectorWeights are "detector=weight" pairs for the weighted aggregator
+	DetectorWeights string
+	// ModelFile is an optional trained model artifact that replaces the aggregator
+	ModelFile string
+	// Workers is the number of workers analyzing final submissions
+	Workers int
 }
 
 type ServerConfig struct {
@@ -31,6 +51,29 @@ func Load() *Config {
 			Port: getEnv("SERVER_PORT", "8080"),
 			Host: getEnv("SERVER_HOST", "0.0.0.0"),
 		},
+		Queue: queue.Config{
+			Backend:       getEnv("TELEMETRY_QUEUE_BACKEND", "memory"),
+			Capacity:      getEnvInt("TELEMETRY_QUEUE_CAPACITY", 10000),
+			Workers:       getEnvInt("TELEMETRY_WORKERS", 4),
+			BatchSize:     getEnvInt("TELEMETRY_BATCH_SIZE", 100),
+			FlushInterval: getEnvDuration("TELEMETRY_FLUSH_INTERVAL", time.Second),
+			MaxAttempts:   getEnvInt("TELEMETRY_MAX_ATTEMPTS", 5),
+			RetryBackoff:  getEnvDuration("TELEMETRY_RETRY_BACKOFF", 2*time.Second),
+		},
+		Retention: archive.Config{
+			Dir:                         getEnv("ARCHIVE_DIR", "./archive"),
+			Interval:                    getEnvDuration("RETENTION_INTERVAL", 6*time.Hour),
+			CompactAfter:                getEnvDuration("COMPACT_AFTER", 24*time.Hour),
+			DefaultRawRetentionDays:     getEnvInt("RAW_RETENTION_DAYS", 365),
+			DefaultFeatureRetentionDays: getEnvInt("FEATURE_RETENTION_DAYS", 0),
+		},
+		Analysis: AnalysisConfig{
+			RulesFile:       getEnv("ANALYSIS_RULES_FILE", ""),
+			Aggregator:      getEnv("ANALYSIS_AGGREGATOR", "sum"),
+			DetectorWeights: getEnv("ANALYSIS_DETECTOR_WEIGHTS", ""),
+			ModelFile:       getEnv("ANALYSIS_MODEL_FILE", ""),
+			Workers:         getEnvInt("ANALYSIS_WORKERS", 4),
+		},
 	}
 }
 
@@ -44,3 +87,19 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
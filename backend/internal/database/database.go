@@ -38,14 +38,34 @@ func Connect(cfg Config) (*gorm.DB, error) {
 }
 
 func Migrate(db *gorm.DB) error {
+	if err := dedupeSimilarityDetections(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	if err := flagDuplicateSequences(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Semester{},
 		&models.Activity{},
 		&models.Submission{},
 		&models.TelemetryData{},
+		&models.TelemetrySession{},
+		&models.TelemetryJob{},
+		&models.TelemetryDeadLetter{},
+		&models.TelemetryArchive{},
+		&models.TelemetryOutage{},
+		&models.AnalysisRule{},
+		&models.StudentBaseline{},
+		&models.KeystrokeProfile{},
+		&models.SubmissionLabel{},
+		&models.AnalysisRun{},
+		&models.ReanalysisJob{},
 		&models.SimilarityDetection{},
 		&models.SimilarityCluster{},
+		&models.SimilarityJob{},
+		&models.SimilarityRunDetection{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
@@ -54,3 +74,56 @@ func Migrate(db *gorm.DB) error {
 	log.Println("✅ Database migrated successfully")
 	return nil
 }
+
+// dedupeSimilarityDetections keeps the latest detection of each pair, so the
+// unique pair index can be created over detections saved by repeated runs,
+// and drops the clusters no remaining detection belongs to
+func dedupeSimilarityDetections(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.SimilarityDetection{}) {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			DELETE FROM similarity_detections older
+			USING similarity_detections newer
+			WHERE older.activity_id = newer.activity_id
+			  AND LEAST(older.submission_id1, older.submission_id2) = LEAST(newer.submission_id1, newer.submission_id2)
+			  AND GREATEST(older.submission_id1, older.submission_id2) = GREATEST(newer.submission_id1, newer.submission_id2)
+			  AND older.algorithm = newer.algorithm
+			  AND older.id < newer.id`).Error
+		if err != nil {
+			return err
+		}
+
+		if !tx.Migrator().HasTable(&models.SimilarityCluster{}) {
+			return nil
+		}
+		return tx.Exec(`
+			DELETE FROM similarity_clusters
+			WHERE NOT EXISTS (
+				SELECT 1 FROM similarity_detections
+				WHERE similarity_detections.cluster_id = similarity_clusters.id
+			)`).Error
+	})
+}
+
+// flagDuplicateSequences marks later copies of a stored batch as replayed, so
+// the unique (session_id, sequence) index can be created over batches stored
+// twice before it existed
+func flagDuplicateSequences(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.TelemetryData{}) {
+		return nil
+	}
+
+	return db.Exec(`
+		UPDATE telemetry_data newer
+		SET integrity = 'replayed_batch'
+		FROM telemetry_data older
+		WHERE older.session_id = newer.session_id
+		  AND older.sequence = newer.sequence
+		  AND older.id < newer.id
+		  AND older.sequence > 0
+		  AND older.integrity NOT IN ('replayed_batch', 'invalid_signature', 'session_mismatch')
+		  AND newer.integrity NOT IN ('replayed_batch', 'invalid_signature', 'session_mismatch')`).Error
+}
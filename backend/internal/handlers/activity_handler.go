@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -20,8 +21,10 @@ func NewActivityHandler(activityService service.ActivityService) *ActivityHandle
 type CreateActivityRequest struct {
 	Title       string `json:"title" binding:"required"`
 	Description string `json:"description"`
+	StarterCode string `json:"starterCode"`
 	Language    string `json:"language" binding:"required"`
 	TimeLimit   int    `json:"timeLimit" binding:"required,min=1"`
+	LatePolicy  string `json:"latePolicy" binding:"omitempty,oneof=accept flag reject"`
 }
 
 func (h *ActivityHandler) Create(c *gin.Context) {
@@ -33,7 +36,7 @@ func (h *ActivityHandler) Create(c *gin.Context) {
 
 	userID := c.GetUint("userID")
 
-	activity, err := h.activityService.Create(userID, req.Title, req.Description, req.Language, req.TimeLimit)
+	activity, err := h.activityService.Create(userID, req.Title, req.Description, req.StarterCode, req.Language, req.TimeLimit, req.LatePolicy)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -70,17 +73,61 @@ func (h *ActivityHandler) GetByID(c *gin.Context) {
 	c.JSON(http.StatusOK, activity)
 }
 
+// Close ends an activity. Analyses that need every submission, such as the
+// cohort comparison, then run in the background.
+func (h *ActivityHandler) Close(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to close this activity"})
+		return
+	}
+
+	activity, err = h.activityService.Close(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, activity)
+}
+
+// JoinActivityRequest is the optional body of a join
+type JoinActivityRequest struct {
+	StudentToken string `json:"studentToken"`
+}
+
 func (h *ActivityHandler) Join(c *gin.Context) {
 	inviteToken := c.Param("inviteToken")
 
-	activity, student, err := h.activityService.JoinActivity(inviteToken)
+	// The body is optional: returning students send their student token
+	var req JoinActivityRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	result, err := h.activityService.JoinActivity(inviteToken, req.StudentToken)
+	if errors.Is(err, service.ErrUnknownStudentToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unknown student token"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid or expired invite link"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"activity": activity,
-		"student":  student,
-	})
+	c.JSON(http.StatusOK, result)
 }
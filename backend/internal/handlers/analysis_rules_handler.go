@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AnalysisRulesHandler struct {
+	analysisService service.AnalysisService
+	activityService service.ActivityService
+}
+
+func NewAnalysisRulesHandler(
+	analysisService service.AnalysisService,
+	activityService service.ActivityService,
+) *AnalysisRulesHandler {
+	return &AnalysisRulesHandler{
+		analysisService: analysisService,
+		activityService: activityService,
+	}
+}
+
+// UpdateAnalysisRulesRequest maps rule names to the fields they change.
+// Omitted fields keep the value of the level below.
+type UpdateAnalysisRulesRequest struct {
+	Rules map[string]rules.Override `json:"rules" binding:"required"`
+}
+
+// Get returns the effective analysis rules of an activity
+func (h *AnalysisRulesHandler) Get(c *gin.Context) {
+	activity, ok := h.ownedActivity(c)
+	if !ok {
+		return
+	}
+
+	set, err := h.analysisService.GetRules(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load analysis rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": set})
+}
+
+// Update replaces the rule overrides of an activity. Rules and fields left
+// out of the request fall back to the global configuration.
+func (h *AnalysisRulesHandler) Update(c *gin.Context) {
+	activity, ok := h.ownedActivity(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateAnalysisRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.analysisService.SetActivityRules(activity.ID, req.Rules); err != nil {
+		respondRulesError(c, err)
+		return
+	}
+
+	set, err := h.analysisService.GetRules(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load analysis rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": set})
+}
+
+// GetGlobal returns the rules of activities without overrides
+func (h *AnalysisRulesHandler) GetGlobal(c *gin.Context) {
+	set, err := h.analysisService.GetGlobalRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load analysis rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": set})
+}
+
+// UpdateGlobal replaces the global rule overrides, which apply to every
+// activity under its own overrides
+func (h *AnalysisRulesHandler) UpdateGlobal(c *gin.Context) {
+	var req UpdateAnalysisRulesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.analysisService.SetGlobalRules(c.GetUint("userID"), req.Rules); err != nil {
+		respondRulesError(c, err)
+		return
+	}
+
+	h.GetGlobal(c)
+}
+
+func respondRulesError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrUnknownRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "unknown_rule"})
+	case errors.Is(err, service.ErrNotProfessor):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save analysis rules"})
+	}
+}
+
+// ownedActivity loads the activity in the path and checks that the caller is
+// its professor, answering the request otherwise
+func (h *AnalysisRulesHandler) ownedActivity(c *gin.Context) (*models.Activity, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return nil, false
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to configure this activity"})
+		return nil, false
+	}
+
+	return activity, true
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CohortHandler struct {
+	cohortService   service.CohortService
+	activityService service.ActivityService
+}
+
+func NewCohortHandler(
+	cohortService service.CohortService,
+	activityService service.ActivityService,
+) *CohortHandler {
+	return &CohortHandler{
+		cohortService:   cohortService,
+		activityService: activityService,
+	}
+}
+
+// Analyze runs the cohort comparison of an activity on demand. It also runs
+// automatically when the activity is closed.
+func (h *CohortHandler) Analyze(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to analyze this activity"})
+		return
+	}
+
+	report, err := h.cohortService.AnalyzeActivity(activity.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrCohortTooSmall) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "cohort_too_small"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to analyze cohort"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
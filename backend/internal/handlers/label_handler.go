@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LabelHandler struct {
+	labelService service.LabelService
+}
+
+func NewLabelHandler(labelService service.LabelService) *LabelHandler {
+	return &LabelHandler{labelService: labelService}
+}
+
+type LabelSubmissionRequest struct {
+	Label string `json:"label" binding:"required,oneof=confirmed_authored confirmed_copied ai_assisted inconclusive"`
+	Notes string `json:"notes"`
+}
+
+func (h *LabelHandler) Create(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req LabelSubmissionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	label, err := h.labelService.Label(c.GetUint("userID"), uint(id), req.Label, req.Notes)
+	if err != nil {
+		respondLabelError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, label)
+}
+
+func (h *LabelHandler) History(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	labels, err := h.labelService.History(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondLabelError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, labels)
+}
+
+// Export downloads labeled submissions as CSV for the trainer, for the
+// activity in the path or, without one, every activity of the professor
+func (h *LabelHandler) Export(c *gin.Context) {
+	var activityID uint64
+	if param := c.Param("id"); param != "" {
+		var err error
+		activityID, err = strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+			return
+		}
+	}
+
+	filename := "labels.csv"
+	if activityID != 0 {
+		filename = fmt.Sprintf("labels-activity-%d.csv", activityID)
+	}
+
+	var buf bytes.Buffer
+	if err := h.labelService.Export(&buf, c.GetUint("userID"), uint(activityID)); err != nil {
+		respondLabelError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+func respondLabelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrSubmissionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+	case errors.Is(err, service.ErrNotActivityOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to label this submission"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
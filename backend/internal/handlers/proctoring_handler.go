@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProctoringHandler struct {
+	proctoringService service.ProctoringService
+	activityService   service.ActivityService
+}
+
+func NewProctoringHandler(
+	proctoringService service.ProctoringService,
+	activityService service.ActivityService,
+) *ProctoringHandler {
+	return &ProctoringHandler{
+		proctoringService: proctoringService,
+		activityService:   activityService,
+	}
+}
+
+// Live streams the status of every student in an activity as Server-Sent
+// Events. Only the professor who owns the activity may watch it.
+func (h *ProctoringHandler) Live(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to watch this activity"})
+		return
+	}
+
+	updates, unsubscribe := h.proctoringService.Subscribe(activity.ID)
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				return false
+			}
+			c.SSEvent(update.Type, update)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReanalysisHandler struct {
+	reanalysisService service.ReanalysisService
+}
+
+func NewReanalysisHandler(reanalysisService service.ReanalysisService) *ReanalysisHandler {
+	return &ReanalysisHandler{reanalysisService: reanalysisService}
+}
+
+type ReanalyzeRequest struct {
+	// Apply replaces the current results; otherwise they are only compared
+	Apply bool `json:"apply"`
+}
+
+func (h *ReanalysisHandler) StartActivity(c *gin.Context) {
+	id, req, ok := bindReanalyze(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.reanalysisService.StartActivity(c.GetUint("userID"), id, req.Apply)
+	if err != nil {
+		respondReanalysisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *ReanalysisHandler) StartSemester(c *gin.Context) {
+	id, req, ok := bindReanalyze(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.reanalysisService.StartSemester(c.GetUint("userID"), id, req.Apply)
+	if err != nil {
+		respondReanalysisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *ReanalysisHandler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	job, err := h.reanalysisService.GetJob(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondReanalysisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *ReanalysisHandler) Compare(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	comparisons, err := h.reanalysisService.Compare(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondReanalysisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comparisons)
+}
+
+func (h *ReanalysisHandler) Runs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	runs, err := h.reanalysisService.Runs(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondReanalysisError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, runs)
+}
+
+func bindReanalyze(c *gin.Context) (uint, ReanalyzeRequest, bool) {
+	var req ReanalyzeRequest
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return 0, req, false
+	}
+
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return 0, req, false
+		}
+	}
+
+	return uint(id), req, true
+}
+
+func respondReanalysisError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reanalysis job not found"})
+	case errors.Is(err, service.ErrSubmissionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+	case errors.Is(err, service.ErrNotActivityOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to reanalyze this activity"})
+	case errors.Is(err, service.ErrActivityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SemesterHandler struct {
+	semesterService service.SemesterService
+}
+
+func NewSemesterHandler(semesterService service.SemesterService) *SemesterHandler {
+	return &SemesterHandler{semesterService: semesterService}
+}
+
+type SemesterRequest struct {
+	Year      int       `json:"year" binding:"required,min=2000"`
+	Period    int       `json:"period" binding:"required,oneof=1 2"`
+	StartDate time.Time `json:"startDate" binding:"required"`
+	EndDate   time.Time `json:"endDate" binding:"required"`
+
+	// Telemetry retention in days, 0 keeps data forever. Omitted values
+	// keep the current ones (the server defaults on create).
+	RawRetentionDays     *int `json:"rawRetentionDays" binding:"omitempty,min=0"`
+	FeatureRetentionDays *int `json:"featureRetentionDays" binding:"omitempty,min=0"`
+}
+
+func (r SemesterRequest) retention() service.SemesterRetention {
+	return service.SemesterRetention{
+		RawDays:     r.RawRetentionDays,
+		FeatureDays: r.FeatureRetentionDays,
+	}
+}
+
+func (h *SemesterHandler) Create(c *gin.Context) {
+	var req SemesterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	semester, err := h.semesterService.CreateSemester(c.GetUint("userID"), req.Year, req.Period, req.StartDate, req.EndDate, req.retention())
+	if err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, semester)
+}
+
+func (h *SemesterHandler) GetAll(c *gin.Context) {
+	semesters, err := h.semesterService.GetAllSemesters(c.GetUint("userID"))
+	if err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, semesters)
+}
+
+func (h *SemesterHandler) GetByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	semester, err := h.semesterService.GetSemester(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, semester)
+}
+
+func (h *SemesterHandler) GetActive(c *gin.Context) {
+	semester, err := h.semesterService.GetActiveSemester(c.GetUint("userID"))
+	if err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, semester)
+}
+
+func (h *SemesterHandler) Update(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	var req SemesterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	semester, err := h.semesterService.UpdateSemester(c.GetUint("userID"), uint(id), req.Year, req.Period, req.StartDate, req.EndDate, req.retention())
+	if err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, semester)
+}
+
+func (h *SemesterHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.semesterService.DeleteSemester(c.GetUint("userID"), uint(id)); err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RefreshStudents recalculates the current semester of every student from
+// the active semester
+func (h *SemesterHandler) RefreshStudents(c *gin.Context) {
+	if err := h.semesterService.UpdateAllStudentSemesters(c.GetUint("userID")); err != nil {
+		respondSemesterError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student semesters updated"})
+}
+
+func respondSemesterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrNotProfessor), errors.Is(err, service.ErrNotSemesterOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSemesterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Semester not found"})
+	case errors.Is(err, service.ErrInvalidSemester), errors.Is(err, service.ErrInvalidRetention):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrSemesterExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "semester_exists"})
+	case errors.Is(err, service.ErrSemesterInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "semester_in_use"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
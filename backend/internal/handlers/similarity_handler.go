@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/models"
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SimilarityHandler struct {
+	similarityService service.SimilarityService
+	activityService   service.ActivityService
+}
+
+func NewSimilarityHandler(
+	similarityService service.SimilarityService,
+	activityService service.ActivityService,
+) *SimilarityHandler {
+	return &SimilarityHandler{
+		similarityService: similarityService,
+		activityService:   activityService,
+	}
+}
+
+// Run starts comparing every pair of submissions of an activity in the
+// background. It also runs automatically when the activity is closed.
+func (h *SimilarityHandler) Run(c *gin.Context) {
+	activity, ok := h.ownedActivity(c)
+	if !ok {
+		return
+	}
+
+	job, err := h.similarityService.StartDetection(activity.ID, models.SimilarityTriggerManual)
+	if err != nil {
+		if errors.Is(err, service.ErrSimilarityJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "similarity_job_running", "jobId": job.ID})
+			return
+		}
+		respondSimilarityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *SimilarityHandler) GetJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	job, err := h.similarityService.GetJob(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondSimilarityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *SimilarityHandler) CancelJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	job, err := h.similarityService.CancelJob(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondSimilarityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *SimilarityHandler) GetJobDetections(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	detections, err := h.similarityService.GetJobDetections(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondSimilarityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, detections)
+}
+
+// CompareJob lists the pairs that changed since the previous completed job
+// of the activity
+func (h *SimilarityHandler) CompareJob(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	comparison, err := h.similarityService.CompareJob(c.GetUint("userID"), uint(id))
+	if err != nil {
+		respondSimilarityError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
+func (h *SimilarityHandler) GetSimilarities(c *gin.Context) {
+	activity, ok := h.ownedActivity(c)
+	if !ok {
+		return
+	}
+
+	detections, err := h.similarityService.GetSimilaritiesForActivity(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, detections)
+}
+
+func (h *SimilarityHandler) GetClusters(c *gin.Context) {
+	activity, ok := h.ownedActivity(c)
+	if !ok {
+		return
+	}
+
+	clusters, err := h.similarityService.GetClustersForActivity(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, clusters)
+}
+
+// ownedActivity loads the activity of the request and checks that it
+// belongs to the professor
+func (h *SimilarityHandler) ownedActivity(c *gin.Context) (*models.Activity, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return nil, false
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return nil, false
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to view similarities of this activity"})
+		return nil, false
+	}
+
+	return activity, true
+}
+
+func respondSimilarityError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrSimilarityJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Similarity job not found"})
+	case errors.Is(err, service.ErrNotActivityOwner):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to view similarities of this activity"})
+	case errors.Is(err, service.ErrActivityNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+	case errors.Is(err, service.ErrSimilarityJobFinished):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "similarity_job_finished"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
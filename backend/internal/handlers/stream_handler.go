@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"dalivim/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StreamHandler struct {
+	streamService service.TelemetryStreamService
+}
+
+func NewStreamHandler(streamService service.TelemetryStreamService) *StreamHandler {
+	return &StreamHandler{streamService: streamService}
+}
+
+type StreamFrameRequest struct {
+	Sequence  int64                  `json:"sequence" binding:"required,min=1"`
+	PrevHash  string                 `json:"prevHash"`
+	Signature string                 `json:"signature"`
+	Timestamp int64                  `json:"timestamp" binding:"required"`
+	SentAt    int64                  `json:"sentAt"`
+	Buffered  bool                   `json:"buffered"`
+	IsFinal   bool                   `json:"isFinal"`
+	Code      string                 `json:"code"`
+	Features  map[string]interface{} `json:"features"`
+	Events    map[string]interface{} `json:"events"`
+}
+
+// Subscribe streams acks and analysis results of a session as Server-Sent
+// Events. EventSource cannot set headers, so the stream credential is also
+// accepted as the "auth" query parameter.
+func (h *StreamHandler) Subscribe(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("sessionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	messages, unsubscribe, err := h.streamService.Subscribe(uint(sessionID), streamAuth(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	defer unsubscribe()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return false
+			}
+			c.SSEvent(msg.Event, msg)
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// Push accepts one frame. It answers 202 with the highest sequence received,
+// or 429 when the session queue is full.
+func (h *StreamHandler) Push(c *gin.Context) {
+	sessionID, err := strconv.ParseUint(c.Param("sessionId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	var req StreamFrameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	received, err := h.streamService.Push(uint(sessionID), streamAuth(c), service.StreamFrame{
+		Sequence:  req.Sequence,
+		PrevHash:  req.PrevHash,
+		Signature: req.Signature,
+		Timestamp: req.Timestamp,
+		SentAt:    req.SentAt,
+		Buffered:  req.Buffered,
+		IsFinal:   req.IsFinal,
+		Code:      req.Code,
+		Features:  req.Features,
+		Events:    req.Events,
+	})
+	switch {
+	case errors.Is(err, service.ErrStreamUnauthorized):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, service.ErrStreamBackpressure):
+		c.Header("Retry-After", "1")
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "received": received})
+		return
+	case errors.Is(err, service.ErrStreamClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "received": received})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"received": received})
+}
+
+func streamAuth(c *gin.Context) string {
+	if auth := c.GetHeader("X-Stream-Auth"); auth != "" {
+		return auth
+	}
+	return c.Query("auth")
+}
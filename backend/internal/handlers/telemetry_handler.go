@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -11,20 +12,34 @@ import (
 
 type TelemetryHandler struct {
 	telemetryService service.TelemetryService
+	activityService  service.ActivityService
 }
 
-func NewTelemetryHandler(telemetryService service.TelemetryService) *TelemetryHandler {
-	return &TelemetryHandler{telemetryService: telemetryService}
+func NewTelemetryHandler(
+	telemetryService service.TelemetryService,
+	activityService service.ActivityService,
+) *TelemetryHandler {
+	return &TelemetryHandler{
+		telemetryService: telemetryService,
+		activityService:  activityService,
+	}
 }
 
 type TelemetryRequest struct {
-	ActivityID uint                   `json:"activityId" binding:"required"`
-	StudentID  uint                   `json:"studentId" binding:"required"`
-	Timestamp  int64                  `json:"timestamp" binding:"required"`
-	IsFinal    bool                   `json:"isFinal"`
-	Code       string                 `json:"code"`
-	Features   map[string]interface{} `json:"features" binding:"required"`
-	RawEvents  map[string]interface{} `json:"rawEvents" binding:"required"`
+	ActivityID     uint                   `json:"activityId" binding:"required"`
+	StudentID      uint                   `json:"studentId" binding:"required"`
+	SessionID      uint                   `json:"sessionId"`
+	Sequence       int64                  `json:"sequence"`
+	PrevHash       string                 `json:"prevHash"`
+	Signature      string                 `json:"signature"`
+	Timestamp      int64                  `json:"timestamp" binding:"required"`
+	SentAt         int64                  `json:"sentAt"`
+	Buffered       bool                   `json:"buffered"`
+	IsFinal        bool                   `json:"isFinal"`
+	IdempotencyKey string                 `json:"idempotencyKey"`
+	Code           string                 `json:"code"`
+	Features       map[string]interface{} `json:"features" binding:"required"`
+	RawEvents      map[string]interface{} `json:"rawEvents" binding:"required"`
 }
 
 func (h *TelemetryHandler) Process(c *gin.Context) {
@@ -34,21 +49,52 @@ func (h *TelemetryHandler) Process(c *gin.Context) {
 		return
 	}
 
-	analysis, err := h.telemetryService.ProcessTelemetry(
-		req.ActivityID,
-		req.StudentID,
-		req.Timestamp,
-		req.IsFinal,
-		req.Code,
-		req.Features,
-		req.RawEvents,
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	// The Idempotency-Key header takes precedence over the body field
+	idempotencyKey := c.GetHeader("Idempotency-Key")
+	if idempotencyKey == "" {
+		idempotencyKey = req.IdempotencyKey
+	}
+
+	result, err := h.telemetryService.ProcessTelemetry(service.TelemetryBatch{
+		ActivityID: req.ActivityID,
+		StudentID:  req.StudentID,
+		SessionID:  req.SessionID,
+		Sequence:   req.Sequence,
+		PrevHash:   req.PrevHash,
+		Signature:  req.Signature,
+		Timestamp:  req.Timestamp,
+		SentAt:     req.SentAt,
+		Buffered:   req.Buffered,
+		IsFinal:    req.IsFinal,
+		Code:       req.Code,
+		Features:   req.Features,
+		RawEvents:  req.RawEvents,
+
+		IdempotencyKey: idempotencyKey,
+	})
+	switch {
+	case errors.Is(err, service.ErrIngestionBusy):
+		c.Header("Retry-After", "2")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error(), "code": "ingestion_busy"})
+		return
+	case errors.Is(err, service.ErrLateSubmissionRejected):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "code": "late_submission_rejected"})
+		return
+	case errors.Is(err, service.ErrActivityClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "activity_closed"})
+		return
+	case errors.Is(err, service.ErrStudentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "code": "student_not_found"})
+		return
+	case errors.Is(err, service.ErrSubmissionNotSaved):
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "submission_not_saved"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "code": "internal_error"})
 		return
 	}
 
-	c.JSON(http.StatusOK, analysis)
+	c.JSON(http.StatusOK, result)
 }
 
 func (h *TelemetryHandler) GetSubmissions(c *gin.Context) {
@@ -66,3 +112,34 @@ func (h *TelemetryHandler) GetSubmissions(c *gin.Context) {
 
 	c.JSON(http.StatusOK, submissions)
 }
+
+func (h *TelemetryHandler) GetPipelineMetrics(c *gin.Context) {
+	c.JSON(http.StatusOK, h.telemetryService.PipelineMetrics())
+}
+
+func (h *TelemetryHandler) GetOutages(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	activity, err := h.activityService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Activity not found"})
+		return
+	}
+
+	if activity.ProfessorID != c.GetUint("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed to view outages of this activity"})
+		return
+	}
+
+	outages, err := h.telemetryService.GetOutages(activity.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, outages)
+}
@@ -24,15 +24,41 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		token := parts[1]
+		authenticate(c, parts[1])
+	}
+}
 
-		// TODO: Validate JWT token and extract user ID
-		// For now, we'll use a mock user ID
-		_ = token
+// StreamAuthMiddleware authenticates Server-Sent Event feeds. Browser
+// EventSource cannot set the Authorization header, so the token may also be
+// sent as the X-Stream-Auth header or the "auth" query parameter.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			AuthMiddleware()(c)
+			return
+		}
 
-		// In production, extract userID from JWT
-		c.Set("userID", uint(1))
+		token := c.GetHeader("X-Stream-Auth")
+		if token == "" {
+			token = c.Query("auth")
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
+			c.Abort()
+			return
+		}
 
-		c.Next()
+		authenticate(c, token)
 	}
 }
+
+func authenticate(c *gin.Context, token string) {
+	// TODO: Validate JWT token and extract user ID
+	// For now, we'll use a mock user ID
+	_ = token
+
+	// In production, extract userID from JWT
+	c.Set("userID", uint(1))
+
+	c.Next()
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AnalysisRule overrides one analysis rule, globally when ActivityID is nil
+// or for a single activity. Null fields keep the value of the level below.
+type AnalysisRule struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActivityID *uint     `gorm:"index" json:"activityId,omitempty"`
+	Name       string    `gorm:"not null" json:"name"`
+	Enabled    *bool     `json:"enabled"`
+	Threshold  *float64  `json:"threshold"`
+	Weight     *float64  `json:"weight"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+func (AnalysisRule) TableName() string {
+	return "analysis_rules"
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Analysis run triggers
+const (
+	AnalysisTriggerSubmission = "submission" // Final submission received
+	AnalysisTriggerReanalysis = "reanalysis" // Re-run by a reanalysis job
+)
+
+// AnalysisRun is one analysis of a submission, stamped with the logic that
+// produced it. The submission row holds the current result; runs keep every
+// result, including re-analyses that were not applied.
+type AnalysisRun struct {
+	ID               uint             `gorm:"primaryKey" json:"id"`
+	SubmissionID     uint             `gorm:"not null;index" json:"submissionId"`
+	ActivityID       uint             `gorm:"not null;index" json:"activityId"`
+	JobID            *uint            `gorm:"index" json:"jobId,omitempty"`
+	Trigger          string           `gorm:"not null" json:"trigger"`
+	AnalysisVersion  string           `gorm:"not null;index" json:"analysisVersion"`
+	DetectorVersions string           `gorm:"not null" json:"detectorVersions"` // e.g. "paste@1,editing@1"
+	Scorer           string           `gorm:"not null" json:"scorer"`           // Aggregator name or "model:<version>"
+	RulesHash        string           `gorm:"not null" json:"rulesHash"`
+	AuthorshipScore  float64          `json:"authorshipScore"`
+	Confidence       string           `json:"confidence"`
+	ConfidenceScore  float64          `json:"confidenceScore"`
+	Signals          string           `gorm:"type:text" json:"-"`
+	SignalsArray     []string         `gorm:"-" json:"signals"`
+	DetectorResults  string           `gorm:"type:text" json:"-"`
+	DetectorArray    []DetectorResult `gorm:"-" json:"detectorResults"`
+	Applied          bool             `gorm:"not null" json:"applied"` // Became the submission's current result
+	CreatedAt        time.Time        `json:"createdAt"`
+}
+
+func (AnalysisRun) TableName() string {
+	return "analysis_runs"
+}
+
+func (r *AnalysisRun) MarshalResults() error {
+	signals, err := json.Marshal(r.SignalsArray)
+	if err != nil {
+		return err
+	}
+	r.Signals = string(signals)
+
+	detectors, err := json.Marshal(r.DetectorArray)
+	if err != nil {
+		return err
+	}
+	r.DetectorResults = string(detectors)
+	return nil
+}
+
+func (r *AnalysisRun) UnmarshalResults() error {
+	r.SignalsArray = []string{}
+	r.DetectorArray = []DetectorResult{}
+
+	if r.Signals != "" {
+		if err := json.Unmarshal([]byte(r.Signals), &r.SignalsArray); err != nil {
+			return err
+		}
+	}
+	if r.DetectorResults != "" {
+		if err := json.Unmarshal([]byte(r.DetectorResults), &r.DetectorArray); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Background job statuses
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// ReanalysisJob re-runs the analysis over past submissions from their stored
+// telemetry. With Apply set, new results replace the submissions' current
+// ones; otherwise they are only recorded for comparison.
+type ReanalysisJob struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	ProfessorID uint       `gorm:"not null;index" json:"professorId"`
+	ActivityID  *uint      `gorm:"index" json:"activityId,omitempty"`
+	SemesterID  *uint      `gorm:"index" json:"semesterId,omitempty"`
+	Apply       bool       `gorm:"not null" json:"apply"`
+	Status      string     `gorm:"not null;default:'pending'" json:"status"`
+	Total       int        `json:"total"`
+	Processed   int        `json:"processed"`
+	Changed     int        `json:"changed"` // Submissions whose score or signals changed
+	Skipped     int        `json:"skipped"` // Submissions without stored telemetry
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (ReanalysisJob) TableName() string {
+	return "reanalysis_jobs"
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// TelemetryArchive holds the compacted per-tick telemetry of one session as a
+// single gzip-compressed JSONL blob (one TelemetryData per line)
+type TelemetryArchive struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	ActivityID     uint       `gorm:"not null;index:idx_archive_session" json:"activityId"`
+	StudentID      uint       `gorm:"not null;index:idx_archive_session" json:"studentId"`
+	SessionID      uint       `gorm:"index:idx_archive_session" json:"sessionId"`
+	RowCount       int        `gorm:"not null" json:"rowCount"`
+	FirstTimestamp int64      `json:"firstTimestamp"`
+	LastTimestamp  int64      `gorm:"index" json:"lastTimestamp"`
+	Data           []byte     `gorm:"type:bytea" json:"-"`
+	RawPurgedAt    *time.Time `json:"rawPurgedAt,omitempty"` // Raw events removed, features kept
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+func (TelemetryArchive) TableName() string {
+	return "telemetry_archives"
+}
@@ -0,0 +1,36 @@
+package models
+
+// DetectorResult is the output of one analysis detector for a submission
+type DetectorResult struct {
+	Detector string             `json:"detector"`
+	Version  string             `json:"version"`
+	Score    float64            `json:"score"` // Suspicion contributed; negative values are evidence of authorship
+	Signals  []string           `json:"signals"`
+	Evidence map[string]float64 `json:"evidence,omitempty"` // Measured values the score is based on
+	Details  []SignalDetail     `json:"details"`
+	Skipped  bool               `json:"skipped,omitempty"` // The detector's inputs were missing
+}
+
+// SignalDetail explains why a signal fired: what was measured, against which
+// threshold, how much it moved the score and which events caused it
+type SignalDetail struct {
+	Signal       string            `json:"signal"`
+	Detector     string            `json:"detector"`
+	Value        float64           `json:"value"`
+	Threshold    float64           `json:"threshold"`
+	Contribution float64           `json:"contribution"` // Share of the aggregated suspicion score
+	Explanation  map[string]string `json:"explanation"`  // Keyed by language ("pt-BR", "en")
+	Events       []EventPointer    `json:"events,omitempty"`
+
+	// Informational details did not produce the score: a trained model
+	// scored the submission and Contribution is the rule weight
+	Informational bool `json:"informational,omitempty"`
+}
+
+// EventPointer locates the raw events behind a signal. End is omitted for
+// single events.
+type EventPointer struct {
+	Kind  string `json:"kind"` // RawEvents key, e.g. "pasteEvents"
+	Start int64  `json:"start"`
+	End   int64  `json:"end,omitempty"`
+}
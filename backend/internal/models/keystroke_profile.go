@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// KeystrokeProfile is a student's typing signature: key hold (dwell) time,
+// time between keys (flight) and latency of each key pair (digraph),
+// accumulated from sessions attributed to the student
+type KeystrokeProfile struct {
+	ID           uint                    `gorm:"primaryKey" json:"id"`
+	StudentID    uint                    `gorm:"not null;uniqueIndex" json:"studentId"`
+	SessionCount int                     `gorm:"not null;default:0" json:"sessionCount"`
+	Dwell        FeatureStats            `gorm:"embedded;embeddedPrefix:dwell_" json:"dwell"`
+	Flight       FeatureStats            `gorm:"embedded;embeddedPrefix:flight_" json:"flight"`
+	DigraphStats string                  `gorm:"type:text" json:"-"`
+	Digraphs     map[string]FeatureStats `gorm:"-" json:"digraphs"` // Keyed "KeyA>KeyB"
+	CreatedAt    time.Time               `json:"createdAt"`
+	UpdatedAt    time.Time               `json:"updatedAt"`
+}
+
+func (KeystrokeProfile) TableName() string {
+	return "keystroke_profiles"
+}
+
+func (p *KeystrokeProfile) MarshalDigraphs() error {
+	data, err := json.Marshal(p.Digraphs)
+	if err != nil {
+		return err
+	}
+	p.DigraphStats = string(data)
+	return nil
+}
+
+func (p *KeystrokeProfile) UnmarshalDigraphs() error {
+	p.Digraphs = map[string]FeatureStats{}
+	if p.DigraphStats == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(p.DigraphStats), &p.Digraphs)
+}
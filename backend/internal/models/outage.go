@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// TelemetryOutage is a window during which a student's editor could not reach
+// the server and buffered its telemetry locally
+type TelemetryOutage struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	ActivityID      uint      `gorm:"not null;index" json:"activityId"`
+	StudentID       uint      `gorm:"not null;index" json:"studentId"`
+	SessionID       uint      `gorm:"index" json:"sessionId"`
+	StartedAt       int64     `gorm:"not null" json:"startedAt"` // Client timestamp of the first buffered batch (ms)
+	EndedAt         int64     `gorm:"not null" json:"endedAt"`   // When the connection came back (ms)
+	BufferedBatches int       `gorm:"not null" json:"bufferedBatches"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+func (TelemetryOutage) TableName() string {
+	return "telemetry_outages"
+}
+
+// Duration returns the outage length in milliseconds
+func (o *TelemetryOutage) Duration() int64 {
+	return o.EndedAt - o.StartedAt
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// TelemetryJob is a telemetry row waiting in the durable ingestion queue. A
+// claimed job stays in the table, leased to its worker, until the row is
+// persisted; jobs whose lease expires are claimed again.
+type TelemetryJob struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	Payload     string     `gorm:"type:text;not null" json:"payload"` // JSON encoded TelemetryData
+	Attempts    int        `gorm:"not null;default:0" json:"attempts"`
+	LeasedUntil *time.Time `gorm:"index" json:"leasedUntil,omitempty"`
+	CreatedAt   time.Time  `gorm:"index" json:"createdAt"`
+}
+
+func (TelemetryJob) TableName() string {
+	return "telemetry_jobs"
+}
+
+// TelemetryDeadLetter keeps telemetry that could not be persisted after all retries
+type TelemetryDeadLetter struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ActivityID uint      `gorm:"index" json:"activityId"`
+	StudentID  uint      `gorm:"index" json:"studentId"`
+	Payload    string    `gorm:"type:text;not null" json:"payload"` // JSON encoded TelemetryData
+	Attempts   int       `json:"attempts"`
+	LastError  string    `gorm:"type:text" json:"lastError"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func (TelemetryDeadLetter) TableName() string {
+	return "telemetry_dead_letters"
+}
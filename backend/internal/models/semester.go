@@ -12,6 +12,15 @@ type Semester struct {
 	Period    int       `gorm:"not null;check:period IN (1,2);index:idx_semester" json:"period"` // 1 or 2
 	StartDate time.Time `gorm:"not null" json:"startDate"`
 	EndDate   time.Time `gorm:"not null" json:"endDate"`
+
+	// Telemetry retention in days, 0 keeps data forever
+	RawRetentionDays     int `gorm:"not null;default:365" json:"rawRetentionDays"`
+	FeatureRetentionDays int `gorm:"not null;default:0" json:"featureRetentionDays"`
+
+	// Professor who created the semester and may change it, 0 for semesters
+	// created before owners were recorded
+	CreatedBy uint `gorm:"index" json:"createdBy"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TelemetrySession is issued when a student joins an activity. It holds the
+// per-session HMAC key and the head of the telemetry hash chain.
+type TelemetrySession struct {
+	ID                    uint      `gorm:"primaryKey" json:"id"`
+	ActivityID            uint      `gorm:"not null;index" json:"activityId"`
+	StudentID             uint      `gorm:"not null;index" json:"studentId"`
+	SessionKey            string    `gorm:"not null" json:"-"`
+	LastSequence          int64     `gorm:"not null;default:0" json:"lastSequence"`
+	LastHash              string    `json:"-"`
+	IntegritySignals      string    `gorm:"type:text" json:"-"`
+	IntegritySignalsArray []string  `gorm:"-" json:"integritySignals"`
+	CreatedAt             time.Time `json:"createdAt"`
+	UpdatedAt             time.Time `json:"updatedAt"`
+}
+
+func (TelemetrySession) TableName() string {
+	return "telemetry_sessions"
+}
+
+// AddIntegritySignal records a signal once, ignoring duplicates
+func (s *TelemetrySession) AddIntegritySignal(signal string) {
+	for _, existing := range s.IntegritySignalsArray {
+		if existing == signal {
+			return
+		}
+	}
+	s.IntegritySignalsArray = append(s.IntegritySignalsArray, signal)
+}
+
+func (s *TelemetrySession) MarshalSignals() error {
+	data, err := json.Marshal(s.IntegritySignalsArray)
+	if err != nil {
+		return err
+	}
+	s.IntegritySignals = string(data)
+	return nil
+}
+
+func (s *TelemetrySession) UnmarshalSignals() error {
+	if s.IntegritySignals == "" {
+		s.IntegritySignalsArray = []string{}
+		return nil
+	}
+	return json.Unmarshal([]byte(s.IntegritySignals), &s.IntegritySignalsArray)
+}
@@ -2,18 +2,21 @@ package models
 
 import "time"
 
-// SimilarityDetection stores pairwise similarity comparisons between submissions
+// SimilarityDetection stores the current pairwise similarity comparisons
+// between submissions of an activity, from its latest completed job. Pairs
+// are ordered with the lower submission ID first.
 type SimilarityDetection struct {
 	ID              uint      `gorm:"primaryKey" json:"id"`
-	ActivityID      uint      `gorm:"not null;index:idx_similarity" json:"activityId"`
-	SubmissionID1   uint      `gorm:"not null;index:idx_similarity" json:"submissionId1"`
-	SubmissionID2   uint      `gorm:"not null;index:idx_similarity" json:"submissionId2"`
+	ActivityID      uint      `gorm:"not null;uniqueIndex:idx_similarity_pair" json:"activityId"`
+	SubmissionID1   uint      `gorm:"not null;uniqueIndex:idx_similarity_pair" json:"submissionId1"`
+	SubmissionID2   uint      `gorm:"not null;uniqueIndex:idx_similarity_pair" json:"submissionId2"`
 	StudentID1      uint      `gorm:"not null" json:"studentId1"`
 	StudentID2      uint      `gorm:"not null" json:"studentId2"`
-	SimilarityScore float64   `gorm:"not null" json:"similarityScore"` // 0.0 to 1.0
-	Algorithm       string    `gorm:"not null" json:"algorithm"`       // "levenshtein", "cosine", "ast"
+	SimilarityScore float64   `gorm:"not null" json:"similarityScore"`                           // 0.0 to 1.0
+	Algorithm       string    `gorm:"not null;uniqueIndex:idx_similarity_pair" json:"algorithm"` // "levenshtein", "cosine", "ast"
 	IsSuspicious    bool      `gorm:"not null;index" json:"isSuspicious"`
 	ClusterID       *uint     `gorm:"index" json:"clusterId,omitempty"` // Group of similar submissions
+	JobID           uint      `gorm:"index" json:"jobId"`               // Job that produced it, 0 before jobs
 	CreatedAt       time.Time `json:"createdAt"`
 
 	// Relations
@@ -32,7 +35,10 @@ type SimilarityCluster struct {
 	ClusterSize    int       `gorm:"not null" json:"clusterSize"`
 	AvgSimilarity  float64   `json:"avgSimilarity"`
 	SuspicionLevel string    `json:"suspicionLevel"` // "low", "medium", "high"
+	JobID          uint      `gorm:"index" json:"jobId"`
 	CreatedAt      time.Time `json:"createdAt"`
+
+	SubmissionIDs []uint `gorm:"-" json:"-"` // Members, set when clustering
 }
 
 func (SimilarityCluster) TableName() string {
@@ -46,3 +52,53 @@ type SimilarityPair struct {
 	SimilarityScore float64    `json:"similarityScore"`
 	IsSuspicious    bool       `json:"isSuspicious"`
 }
+
+// SimilarityRunDetection is a pair compared by a similarity job. Every job
+// keeps its own pairs, so runs can be compared after the current results
+// move on.
+type SimilarityRunDetection struct {
+	ID              uint      `gorm:"primaryKey" json:"id"`
+	JobID           uint      `gorm:"not null;uniqueIndex:idx_similarity_run_pair" json:"jobId"`
+	ActivityID      uint      `gorm:"not null;index" json:"activityId"`
+	SubmissionID1   uint      `gorm:"not null;uniqueIndex:idx_similarity_run_pair" json:"submissionId1"`
+	SubmissionID2   uint      `gorm:"not null;uniqueIndex:idx_similarity_run_pair" json:"submissionId2"`
+	StudentID1      uint      `gorm:"not null" json:"studentId1"`
+	StudentID2      uint      `gorm:"not null" json:"studentId2"`
+	SimilarityScore float64   `gorm:"not null" json:"similarityScore"`
+	Algorithm       string    `gorm:"not null;uniqueIndex:idx_similarity_run_pair" json:"algorithm"`
+	IsSuspicious    bool      `gorm:"not null" json:"isSuspicious"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+func (SimilarityRunDetection) TableName() string {
+	return "similarity_run_detections"
+}
+
+// Similarity job triggers
+const (
+	SimilarityTriggerManual = "manual"
+	SimilarityTriggerClose  = "activity_closed"
+)
+
+// SimilarityJob compares every pair of submissions of an activity in the
+// background. Its pairs are saved as they are compared; once all are, they
+// replace the activity's current detections and clusters.
+type SimilarityJob struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	ActivityID      uint       `gorm:"not null;index" json:"activityId"`
+	ProfessorID     uint       `gorm:"not null;index" json:"professorId"`
+	Trigger         string     `gorm:"not null" json:"trigger"`
+	Status          string     `gorm:"not null;default:'pending'" json:"status"`
+	TotalPairs      int        `json:"totalPairs"`
+	ComparedPairs   int        `json:"comparedPairs"`
+	SuspiciousPairs int        `json:"suspiciousPairs"`
+	Progress        float64    `json:"progress"` // Percentage of pairs compared
+	Error           string     `json:"error,omitempty"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+func (SimilarityJob) TableName() string {
+	return "similarity_jobs"
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+)
+
+// StudentBaseline is a student's typical behavior, accumulated from their
+// previous final submissions. Each feature keeps running statistics.
+type StudentBaseline struct {
+	ID              uint                    `gorm:"primaryKey" json:"id"`
+	StudentID       uint                    `gorm:"not null;uniqueIndex" json:"studentId"`
+	SubmissionCount int                     `gorm:"not null;default:0" json:"submissionCount"`
+	Stats           string                  `gorm:"type:text" json:"-"`
+	Features        map[string]FeatureStats `gorm:"-" json:"features"`
+	CreatedAt       time.Time               `json:"createdAt"`
+	UpdatedAt       time.Time               `json:"updatedAt"`
+}
+
+func (StudentBaseline) TableName() string {
+	return "student_baselines"
+}
+
+// FeatureStats are running mean and variance (Welford's method)
+type FeatureStats struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+}
+
+func (f *FeatureStats) Add(value float64) {
+	f.Count++
+	delta := value - f.Mean
+	f.Mean += delta / float64(f.Count)
+	f.M2 += delta * (value - f.Mean)
+}
+
+// Std is the sample standard deviation
+func (f FeatureStats) Std() float64 {
+	if f.Count < 2 {
+		return 0
+	}
+	return math.Sqrt(f.M2 / float64(f.Count-1))
+}
+
+func (b *StudentBaseline) MarshalStats() error {
+	data, err := json.Marshal(b.Features)
+	if err != nil {
+		return err
+	}
+	b.Stats = string(data)
+	return nil
+}
+
+func (b *StudentBaseline) UnmarshalStats() error {
+	b.Features = map[string]FeatureStats{}
+	if b.Stats == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(b.Stats), &b.Features)
+}
@@ -6,30 +6,52 @@ import (
 )
 
 type Submission struct {
-	ID                   uint      `gorm:"primaryKey" json:"id"`
-	ActivityID           uint      `gorm:"not null;index" json:"activityId"`
-	StudentID            uint      `gorm:"not null;index" json:"studentId"`
-	StudentName          string    `json:"studentName"`
-	StudentEmail         string    `json:"studentEmail"`
-	Code                 string    `gorm:"type:text" json:"code"`
-	AuthorshipScore      float64   `json:"authorshipScore"`
-	Confidence           string    `json:"confidence"`
-	Signals              string    `gorm:"type:text" json:"-"`
-	SignalsArray         []string  `gorm:"-" json:"signals"`
-	AvgKeystrokeInterval float64   `json:"avgKeystrokeInterval"`
-	StdKeystrokeInterval float64   `json:"stdKeystrokeInterval"`
-	PasteEvents          int       `json:"pasteEvents"`
-	PasteCharRatio       float64   `json:"pasteCharRatio"`
-	DeleteRatio          float64   `json:"deleteRatio"`
-	FocusLossCount       int       `json:"focusLossCount"`
-	LinearEditingScore   float64   `json:"linearEditingScore"`
-	Burstiness           float64   `json:"burstiness"`
-	TimeToFirstRun       float64   `json:"timeToFirstRun"`
-	ExecutionCount       int       `json:"executionCount"`
-	TotalTime            float64   `json:"totalTime"`
-	KeystrokeCount       int       `json:"keystrokeCount"`
-	PasteEventDetails    string    `gorm:"type:text" json:"pasteEventDetails"`
-	CreatedAt            time.Time `json:"createdAt"`
+	ID                   uint             `gorm:"primaryKey" json:"id"`
+	ActivityID           uint             `gorm:"not null;index" json:"activityId"`
+	StudentID            uint             `gorm:"not null;index" json:"studentId"`
+	StudentName          string           `json:"studentName"`
+	StudentEmail         string           `json:"studentEmail"`
+	Code                 string           `gorm:"type:text" json:"code"`
+	AuthorshipScore      float64          `json:"authorshipScore"`
+	Confidence           string           `json:"confidence"`      // high, medium, low or insufficient_data
+	ConfidenceScore      float64          `json:"confidenceScore"` // Calibrated confidence, 0-1
+	Signals              string           `gorm:"type:text" json:"-"`
+	SignalsArray         []string         `gorm:"-" json:"signals"`
+	DetectorResults      string           `gorm:"type:text" json:"-"`
+	DetectorArray        []DetectorResult `gorm:"-" json:"detectorResults"`
+	SignalDetails        []SignalDetail   `gorm:"-" json:"signalDetails"` // Collected from DetectorArray
+	BaselineDeviation    *float64         `json:"baselineDeviation"`      // Distance from the student's own baseline
+	CohortPercentile     *float64         `json:"cohortPercentile"`       // Share of the activity that is less suspicious, 0-100
+	CohortAnalyzedAt     *time.Time       `json:"cohortAnalyzedAt"`
+	IdentityConsistency  *float64         `json:"identityConsistency"`                                 // Match with the student's keystroke profile, 0-1
+	Label                string           `json:"label"`                                               // Latest professor label, see SubmissionLabel
+	AnalysisVersion      string           `json:"analysisVersion"`                                     // Version of the analysis behind the current result
+	AnalysisPending      bool             `gorm:"not null;default:false;index" json:"analysisPending"` // Saved, not analyzed yet
+	AvgKeystrokeInterval float64          `json:"avgKeystrokeInterval"`
+	StdKeystrokeInterval float64          `json:"stdKeystrokeInterval"`
+	PasteEvents          int              `json:"pasteEvents"`
+	PasteCharRatio       float64          `json:"pasteCharRatio"`
+	DeleteRatio          float64          `json:"deleteRatio"`
+	FocusLossCount       int              `json:"focusLossCount"`
+	LinearEditingScore   float64          `json:"linearEditingScore"`
+	Burstiness           float64          `json:"burstiness"`
+	TimeToFirstRun       float64          `json:"timeToFirstRun"`
+	ExecutionCount       int              `json:"executionCount"`
+	TotalTime            float64          `json:"totalTime"`
+	KeystrokeCount       int              `json:"keystrokeCount"`
+	PasteEventDetails    string           `gorm:"type:text" json:"pasteEventDetails"`
+	PasteProvenance      string           `gorm:"type:text" json:"pasteProvenance"` // JSON list of classified pastes
+	NonLinearNavigation  *float64         `json:"nonLinearNavigationRatio"`         // Nil without cursor events
+	UndoFrequency        *float64         `json:"undoFrequency"`                    // Undos per 100 keystrokes, nil without undo events
+	SelectionCount       int              `json:"selectionCount"`
+	FindReplaceCount     int              `json:"findReplaceCount"`
+	SessionID            uint             `gorm:"index" json:"sessionId"`
+	FinalTelemetryID     uint             `json:"-"` // Telemetry row of the final batch, 0 for older submissions
+	IntegritySignals     string           `gorm:"type:text" json:"-"`
+	IntegrityArray       []string         `gorm:"-" json:"integritySignals"`
+	ReceiptID            string           `gorm:"index" json:"receiptId"`
+	IdempotencyKey       *string          `gorm:"uniqueIndex" json:"-"`
+	CreatedAt            time.Time        `json:"createdAt"`
 }
 
 func (Submission) TableName() string {
@@ -42,13 +64,45 @@ func (s *Submission) MarshalSignals() error {
 		return err
 	}
 	s.Signals = string(data)
+
+	integrity, err := json.Marshal(s.IntegrityArray)
+	if err != nil {
+		return err
+	}
+	s.IntegritySignals = string(integrity)
+
+	detectors, err := json.Marshal(s.DetectorArray)
+	if err != nil {
+		return err
+	}
+	s.DetectorResults = string(detectors)
 	return nil
 }
 
 func (s *Submission) UnmarshalSignals() error {
-	if s.Signals == "" {
-		s.SignalsArray = []string{}
-		return nil
+	s.SignalsArray = []string{}
+	s.IntegrityArray = []string{}
+	s.DetectorArray = []DetectorResult{}
+
+	if s.Signals != "" {
+		if err := json.Unmarshal([]byte(s.Signals), &s.SignalsArray); err != nil {
+			return err
+		}
+	}
+	if s.IntegritySignals != "" {
+		if err := json.Unmarshal([]byte(s.IntegritySignals), &s.IntegrityArray); err != nil {
+			return err
+		}
+	}
+	if s.DetectorResults != "" {
+		if err := json.Unmarshal([]byte(s.DetectorResults), &s.DetectorArray); err != nil {
+			return err
+		}
 	}
-	return json.Unmarshal([]byte(s.Signals), &s.SignalsArray)
+
+	s.SignalDetails = []SignalDetail{}
+	for _, result := range s.DetectorArray {
+		s.SignalDetails = append(s.SignalDetails, result.Details...)
+	}
+	return nil
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Submission labels given by professors
+const (
+	LabelConfirmedAuthored = "confirmed_authored"
+	LabelConfirmedCopied   = "confirmed_copied"
+	LabelAIAssisted        = "ai_assisted"
+	LabelInconclusive      = "inconclusive"
+)
+
+// SubmissionLabel is a professor's verdict on a submission. Labels are never
+// updated: a new verdict adds a row, and the latest one is current.
+type SubmissionLabel struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	SubmissionID uint      `gorm:"not null;index" json:"submissionId"`
+	ActivityID   uint      `gorm:"not null;index" json:"activityId"`
+	ProfessorID  uint      `gorm:"not null" json:"professorId"`
+	Label        string    `gorm:"not null" json:"label"`
+	Notes        string    `gorm:"type:text" json:"notes"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+func (SubmissionLabel) TableName() string {
+	return "submission_labels"
+}
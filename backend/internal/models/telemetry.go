@@ -2,14 +2,25 @@ package models
 
 import "time"
 
+// TelemetrySequenceIndexWhere restricts the unique (session_id, sequence)
+// index of TelemetryData to signed batches the chain accepted. Replayed and
+// forged batches are still stored as evidence. Keep in sync with the tag.
+const TelemetrySequenceIndexWhere = "sequence > 0 AND integrity <> 'replayed_batch' AND integrity <> 'invalid_signature' AND integrity <> 'session_mismatch'"
+
 type TelemetryData struct {
 	ID         uint      `gorm:"primaryKey" json:"id"`
 	ActivityID uint      `gorm:"not null;index" json:"activityId"`
 	StudentID  uint      `gorm:"not null;index" json:"studentId"`
-	Timestamp  int64     `gorm:"not null;index" json:"timestamp"`
+	SessionID  uint      `gorm:"index;uniqueIndex:idx_telemetry_session_sequence" json:"sessionId"`
+	Sequence   int64     `gorm:"uniqueIndex:idx_telemetry_session_sequence,where:sequence > 0 AND integrity <> 'replayed_batch' AND integrity <> 'invalid_signature' AND integrity <> 'session_mismatch'" json:"sequence"`
+	Timestamp  int64     `gorm:"not null;index" json:"timestamp"` // Client time the batch was produced (ms)
+	ReceivedAt int64     `json:"receivedAt"`                      // Server time the batch arrived (ms)
+	Late       bool      `gorm:"default:false" json:"late"`       // Buffered offline and uploaded late
 	IsFinal    bool      `gorm:"default:false" json:"isFinal"`
 	Features   string    `gorm:"type:text" json:"features"`
 	RawEvents  string    `gorm:"type:text" json:"rawEvents"`
+	Signature  string    `json:"signature"`
+	Integrity  string    `gorm:"default:'ok'" json:"integrity"` // "ok" or the integrity signal raised by this batch
 	CreatedAt  time.Time `json:"createdAt"`
 }
 
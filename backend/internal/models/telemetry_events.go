@@ -0,0 +1,87 @@
+package models
+
+// Typed editor events sent inside TelemetryData.RawEvents, keyed by the
+// RawEvents field named in each comment. Timestamps are client times in ms.
+
+// CursorEvent is a cursor move ("cursorEvents")
+type CursorEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Line      int    `json:"lineNumber"`
+	Column    int    `json:"column"`
+	Source    string `json:"source"` // "keyboard", "mouse", "api"
+}
+
+// SelectionEvent is a non-empty selection ("selectionEvents")
+type SelectionEvent struct {
+	Timestamp   int64 `json:"timestamp"`
+	StartLine   int   `json:"startLineNumber"`
+	StartColumn int   `json:"startColumn"`
+	EndLine     int   `json:"endLineNumber"`
+	EndColumn   int   `json:"endColumn"`
+	Length      int   `json:"length"`
+}
+
+// UndoRedoEvent is an undo or redo ("undoRedoEvents")
+type UndoRedoEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"` // "undo" or "redo"
+}
+
+// ScrollEvent is a viewport scroll ("scrollEvents")
+type ScrollEvent struct {
+	Timestamp   int64 `json:"timestamp"`
+	FirstLine   int   `json:"firstVisibleLine"`
+	LastLine    int   `json:"lastVisibleLine"`
+	ScrollDelta int   `json:"scrollDelta"`
+}
+
+// FindReplaceEvent is a use of the find/replace widget ("findReplaceEvents")
+type FindReplaceEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"` // "find" or "replace"
+	Matches   int    `json:"matches"`
+}
+
+// PasteEvent is a paste into the editor ("pasteEvents"). Content holds at
+// most the first 200 characters.
+type PasteEvent struct {
+	Timestamp  int64  `json:"timestamp"`
+	Length     int    `json:"length"`
+	Content    string `json:"content"`
+	LinesCount int    `json:"linesCount"`
+}
+
+// CopyEvent is a copy or cut made inside the editor ("copyEvents"). Content
+// holds at most the first 200 characters.
+type CopyEvent struct {
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"` // "copy" or "cut"
+	Length    int    `json:"length"`
+	Content   string `json:"content"`
+}
+
+// FocusEvent is the editor losing ("blur") or regaining ("focus") focus
+// ("focusEvents"). AwayDuration is set on focus events, in ms.
+type FocusEvent struct {
+	Timestamp    int64  `json:"timestamp"`
+	Type         string `json:"type"`
+	AwayDuration int64  `json:"awayDuration"`
+}
+
+// EditEvent is one change to the editor content ("editEvents"), as reported
+// by the editor: RangeLength characters from RangeOffset were replaced by
+// Text. Offsets count characters of the whole document.
+type EditEvent struct {
+	Timestamp   int64  `json:"timestamp"`
+	RangeOffset int    `json:"rangeOffset"`
+	RangeLength int    `json:"rangeLength"`
+	Text        string `json:"text"`
+}
+
+// KeyEvent is a key press or release ("keyEvents"), used for keystroke
+// dynamics. Key is the physical key code (e.g. "KeyA"), not the character.
+type KeyEvent struct {
+	Timestamp float64 `json:"timestamp"` // High resolution ms
+	Type      string  `json:"type"`      // "keydown" or "keyup"
+	Key       string  `json:"code"`
+}
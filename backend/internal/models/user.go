@@ -9,6 +9,10 @@ type User struct {
 	Name     string `json:"name"`
 	Role     string `gorm:"not null;check:role IN ('professor', 'student')" json:"role"`
 
+	// Hash of the token an anonymous student presents to join again as the
+	// same student
+	StudentTokenHash *string `gorm:"uniqueIndex" json:"-"`
+
 	// CAMPOS PARA SISTEMA DE SEMESTRES
 	CurrentSemester  int `json:"currentSemester"`  // Semestre atual do aluno (1-10)
 	EnrollmentYear   int `json:"enrollmentYear"`   // Ano de matrícula (ex: 2024)
@@ -0,0 +1,114 @@
+package queue
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+const (
+	databasePollInterval = 200 * time.Millisecond
+	// Dequeued jobs are redelivered when neither acknowledged nor released
+	// for a retry within this time
+	databaseLeaseTimeout = 5 * time.Minute
+)
+
+type databaseQueue struct {
+	queueRepo repository.QueueRepository
+	capacity  int
+	depth     atomic.Int64
+}
+
+// NewDatabaseQueue returns a queue stored in the telemetry_jobs table, so
+// pending telemetry survives a restart and can be shared by several servers.
+func NewDatabaseQueue(queueRepo repository.QueueRepository, capacity int) Queue {
+	q := &databaseQueue{queueRepo: queueRepo, capacity: capacity}
+	if count, err := queueRepo.Count(); err == nil {
+		q.depth.Store(count)
+	}
+	return q
+}
+
+func (q *databaseQueue) Enqueue(item Item) error {
+	if q.depth.Load() >= int64(q.capacity) {
+		return ErrFull
+	}
+
+	payload, err := json.Marshal(item.Telemetry)
+	if err != nil {
+		return err
+	}
+
+	job := &models.TelemetryJob{Payload: string(payload), Attempts: item.Attempts}
+	if err := q.queueRepo.Push(job); err != nil {
+		return err
+	}
+
+	q.depth.Add(1)
+	return nil
+}
+
+func (q *databaseQueue) Dequeue(max int, wait time.Duration) ([]Item, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		jobs, err := q.queueRepo.Claim(max, databaseLeaseTimeout)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(jobs) > 0 {
+			items := make([]Item, 0, len(jobs))
+			for _, job := range jobs {
+				var telemetry models.TelemetryData
+				if err := json.Unmarshal([]byte(job.Payload), &telemetry); err != nil {
+					err = q.queueRepo.CreateDeadLetter(&models.TelemetryDeadLetter{
+						Payload:   job.Payload,
+						Attempts:  job.Attempts,
+						LastError: err.Error(),
+					})
+					if err == nil {
+						q.Ack([]Item{{JobID: job.ID}})
+					}
+					continue
+				}
+				items = append(items, Item{Telemetry: telemetry, Attempts: job.Attempts, JobID: job.ID})
+			}
+			return items, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(databasePollInterval)
+	}
+}
+
+func (q *databaseQueue) Ack(items []Item) error {
+	ids := make([]uint, 0, len(items))
+	for _, item := range items {
+		if item.JobID != 0 {
+			ids = append(ids, item.JobID)
+		}
+	}
+	if err := q.queueRepo.Delete(ids); err != nil {
+		return err
+	}
+
+	q.depth.Add(-int64(len(ids)))
+	return nil
+}
+
+// Retry updates the job in place: it stays counted in the depth and becomes
+// claimable again once delay has passed
+func (q *databaseQueue) Retry(item Item, delay time.Duration) error {
+	return q.queueRepo.Release(item.JobID, item.Attempts, time.Now().Add(delay))
+}
+
+// Depth counts leased jobs until they are acknowledged. It is tracked by this
+// process, so it is approximate when several servers share the table.
+func (q *databaseQueue) Depth() int {
+	return int(q.depth.Load())
+}
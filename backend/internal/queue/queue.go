@@ -0,0 +1,107 @@
+// Package queue buffers telemetry between the HTTP handlers and the workers
+// that persist it.
+package queue
+
+import (
+	"errors"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+var ErrFull = errors.New("telemetry queue is full")
+
+// Item is one telemetry row waiting to be persisted
+type Item struct {
+	Telemetry models.TelemetryData
+	Attempts  int
+	JobID     uint // Row of the database backend, 0 in memory
+}
+
+// Queue is the ingestion backend. Implementations must be safe for
+// concurrent use by the handlers and every worker.
+type Queue interface {
+	// Enqueue adds an item, returning ErrFull when the queue is at capacity
+	Enqueue(item Item) error
+	// Dequeue waits up to wait for at least one item and returns at most max
+	Dequeue(max int, wait time.Duration) ([]Item, error)
+	// Ack removes dequeued items once they are persisted or handed on to a
+	// retry or the dead letters. Unacknowledged items of the database
+	// backend are delivered again after their lease expires.
+	Ack(items []Item) error
+	// Retry puts a dequeued item back with its Attempts, to be delivered
+	// again after delay. The item keeps its place in the capacity, so a
+	// retry never fails because the queue filled up meanwhile.
+	Retry(item Item, delay time.Duration) error
+	// Depth is the number of items waiting
+	Depth() int
+}
+
+type memoryQueue struct {
+	items chan Item
+}
+
+// NewMemoryQueue returns a bounded in-process queue. Its content is lost when
+// the server stops.
+func NewMemoryQueue(capacity int) Queue {
+	return &memoryQueue{items: make(chan Item, capacity)}
+}
+
+func (q *memoryQueue) Enqueue(item Item) error {
+	select {
+	case q.items <- item:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+func (q *memoryQueue) Dequeue(max int, wait time.Duration) ([]Item, error) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	var items []Item
+	select {
+	case item := <-q.items:
+		items = append(items, item)
+	case <-timer.C:
+		return nil, nil
+	}
+
+	for len(items) < max {
+		select {
+		case item := <-q.items:
+			items = append(items, item)
+		default:
+			return items, nil
+		}
+	}
+	return items, nil
+}
+
+// Ack is a no-op: dequeued items have already left the channel
+func (q *memoryQueue) Ack(items []Item) error {
+	return nil
+}
+
+// Retry waits for room in the channel instead of failing when it is full:
+// the item already counted against the capacity when first enqueued
+func (q *memoryQueue) Retry(item Item, delay time.Duration) error {
+	time.AfterFunc(delay, func() { q.items <- item })
+	return nil
+}
+
+func (q *memoryQueue) Depth() int {
+	return len(q.items)
+}
+
+// Config selects the queue backend and sizes the worker pool that drains it
+type Config struct {
+	Backend       string // "memory" or "database"
+	Capacity      int
+	Workers       int
+	BatchSize     int
+	FlushInterval time.Duration
+	MaxAttempts   int
+	RetryBackoff  time.Duration
+}
@@ -0,0 +1,40 @@
+package queue
+
+import (
+	"testing"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+func TestMemoryRetryIgnoresCapacity(t *testing.T) {
+	q := NewMemoryQueue(1)
+
+	if err := q.Enqueue(Item{Telemetry: models.TelemetryData{Sequence: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	failed, _ := q.Dequeue(1, time.Second)
+	if err := q.Enqueue(Item{Telemetry: models.TelemetryData{Sequence: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed[0].Attempts++
+	if err := q.Retry(failed[0], 0); err != nil {
+		t.Fatalf("retry of a dequeued item failed on a full queue: %v", err)
+	}
+
+	var sequences []int64
+	for len(sequences) < 2 {
+		items, _ := q.Dequeue(1, time.Second)
+		if len(items) == 0 {
+			t.Fatalf("dequeued %v, want both items", sequences)
+		}
+		sequences = append(sequences, items[0].Telemetry.Sequence)
+		if items[0].Telemetry.Sequence == 1 && items[0].Attempts != 1 {
+			t.Errorf("retried item on attempt %d, want 1", items[0].Attempts)
+		}
+	}
+	if sequences[0] != 2 || sequences[1] != 1 {
+		t.Errorf("dequeued %v, want the retry after the waiting item", sequences)
+	}
+}
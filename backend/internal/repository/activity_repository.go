@@ -47,3 +47,13 @@ func (r *activityRepository) CountSubmissions(activityID uint) (int64, error) {
 	err := r.db.Model(&models.Submission{}).Where("activity_id = ?", activityID).Count(&count).Error
 	return count, err
 }
+
+func (r *activityRepository) FindBySemesterID(semesterID uint) ([]models.Activity, error) {
+	var activities []models.Activity
+	err := r.db.Where("semester_id = ?", semesterID).Find(&activities).Error
+	return activities, err
+}
+
+func (r *activityRepository) Update(activity *models.Activity) error {
+	return r.db.Save(activity).Error
+}
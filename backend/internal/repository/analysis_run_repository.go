@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type analysisRunRepository struct {
+	db *gorm.DB
+}
+
+func NewAnalysisRunRepository(db *gorm.DB) AnalysisRunRepository {
+	return &analysisRunRepository{db: db}
+}
+
+func (r *analysisRunRepository) Create(run *models.AnalysisRun) error {
+	if err := run.MarshalResults(); err != nil {
+		return err
+	}
+	return r.db.Create(run).Error
+}
+
+// CreateApplied stores a run and makes it the submission's current result.
+// Only the analysis columns are written, so labels and cohort results set
+// meanwhile are kept.
+func (r *analysisRunRepository) CreateApplied(run *models.AnalysisRun, submission *models.Submission) error {
+	if err := run.MarshalResults(); err != nil {
+		return err
+	}
+	if err := submission.MarshalSignals(); err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		return tx.Model(submission).
+			Select(
+				"authorship_score", "confidence", "confidence_score",
+				"signals", "detector_results",
+				"baseline_deviation", "identity_consistency", "analysis_version",
+			).
+			Updates(submission).Error
+	})
+}
+
+func (r *analysisRunRepository) FindBySubmissionID(submissionID uint) ([]models.AnalysisRun, error) {
+	return r.find(r.db.Where("submission_id = ?", submissionID).Order("created_at desc"))
+}
+
+func (r *analysisRunRepository) FindByJobID(jobID uint) ([]models.AnalysisRun, error) {
+	return r.find(r.db.Where("job_id = ?", jobID).Order("submission_id asc"))
+}
+
+// FindPrevious returns the latest run of a submission created before run
+func (r *analysisRunRepository) FindPrevious(run *models.AnalysisRun) (*models.AnalysisRun, error) {
+	var previous models.AnalysisRun
+	err := r.db.Where("submission_id = ? AND id < ?", run.SubmissionID, run.ID).
+		Order("id desc").
+		First(&previous).Error
+	if err != nil {
+		return nil, err
+	}
+
+	previous.UnmarshalResults()
+
+	return &previous, nil
+}
+
+func (r *analysisRunRepository) find(query *gorm.DB) ([]models.AnalysisRun, error) {
+	var runs []models.AnalysisRun
+	if err := query.Find(&runs).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range runs {
+		runs[i].UnmarshalResults()
+	}
+
+	return runs, nil
+}
+
+type reanalysisJobRepository struct {
+	db *gorm.DB
+}
+
+func NewReanalysisJobRepository(db *gorm.DB) ReanalysisJobRepository {
+	return &reanalysisJobRepository{db: db}
+}
+
+func (r *reanalysisJobRepository) Create(job *models.ReanalysisJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *reanalysisJobRepository) Update(job *models.ReanalysisJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *reanalysisJobRepository) FindByID(id uint) (*models.ReanalysisJob, error) {
+	var job models.ReanalysisJob
+	err := r.db.First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
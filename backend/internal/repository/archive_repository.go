@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"time"
+
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type archiveRepository struct {
+	db *gorm.DB
+}
+
+func NewArchiveRepository(db *gorm.DB) ArchiveRepository {
+	return &archiveRepository{db: db}
+}
+
+func (r *archiveRepository) FindCompactableSessions(before time.Time) ([]models.TelemetryData, error) {
+	var keys []models.TelemetryData
+	err := r.db.Model(&models.TelemetryData{}).
+		Select("activity_id, student_id, session_id").
+		Where("is_final = ? AND created_at < ?", false, before).
+		Group("activity_id, student_id, session_id").
+		Find(&keys).Error
+	return keys, err
+}
+
+func (r *archiveRepository) FindCompactableRows(activityID, studentID, sessionID uint, before time.Time) ([]models.TelemetryData, error) {
+	var rows []models.TelemetryData
+	err := r.db.Where("activity_id = ? AND student_id = ? AND session_id = ? AND is_final = ? AND created_at < ?",
+		activityID, studentID, sessionID, false, before).
+		Order("timestamp asc").
+		Find(&rows).Error
+	return rows, err
+}
+
+func (r *archiveRepository) FindBySession(activityID, studentID, sessionID uint) (*models.TelemetryArchive, error) {
+	var archive models.TelemetryArchive
+	err := r.db.Where("activity_id = ? AND student_id = ? AND session_id = ?", activityID, studentID, sessionID).
+		First(&archive).Error
+	if err != nil {
+		return nil, err
+	}
+	return &archive, nil
+}
+
+func (r *archiveRepository) FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryArchive, error) {
+	var archives []models.TelemetryArchive
+	err := r.db.Where("activity_id = ? AND student_id = ?", activityID, studentID).
+		Order("first_timestamp asc").
+		Find(&archives).Error
+	return archives, err
+}
+
+func (r *archiveRepository) Compact(archive *models.TelemetryArchive, rowIDs []uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(archive).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.TelemetryData{}, rowIDs).Error
+	})
+}
+
+func (r *archiveRepository) FindRawExpired(activityIDs []uint, before int64) ([]models.TelemetryArchive, error) {
+	var archives []models.TelemetryArchive
+	err := r.db.Where("activity_id IN ? AND last_timestamp < ? AND raw_purged_at IS NULL", activityIDs, before).
+		Find(&archives).Error
+	return archives, err
+}
+
+func (r *archiveRepository) FindExpired(activityIDs []uint, before int64) ([]models.TelemetryArchive, error) {
+	var archives []models.TelemetryArchive
+	err := r.db.Where("activity_id IN ? AND last_timestamp < ?", activityIDs, before).
+		Find(&archives).Error
+	return archives, err
+}
+
+func (r *archiveRepository) Update(archive *models.TelemetryArchive) error {
+	return r.db.Save(archive).Error
+}
+
+func (r *archiveRepository) Delete(archive *models.TelemetryArchive) error {
+	return r.db.Delete(archive).Error
+}
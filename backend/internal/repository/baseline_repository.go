@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type baselineRepository struct {
+	db *gorm.DB
+}
+
+func NewBaselineRepository(db *gorm.DB) BaselineRepository {
+	return &baselineRepository{db: db}
+}
+
+func (r *baselineRepository) FindByStudentID(studentID uint) (*models.StudentBaseline, error) {
+	var baseline models.StudentBaseline
+	err := r.db.Where("student_id = ?", studentID).First(&baseline).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := baseline.UnmarshalStats(); err != nil {
+		return nil, err
+	}
+
+	return &baseline, nil
+}
+
+func (r *baselineRepository) Save(baseline *models.StudentBaseline) error {
+	if err := baseline.MarshalStats(); err != nil {
+		return err
+	}
+	return r.db.Save(baseline).Error
+}
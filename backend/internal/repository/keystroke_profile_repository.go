@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type keystrokeProfileRepository struct {
+	db *gorm.DB
+}
+
+func NewKeystrokeProfileRepository(db *gorm.DB) KeystrokeProfileRepository {
+	return &keystrokeProfileRepository{db: db}
+}
+
+func (r *keystrokeProfileRepository) FindByStudentID(studentID uint) (*models.KeystrokeProfile, error) {
+	var profile models.KeystrokeProfile
+	err := r.db.Where("student_id = ?", studentID).First(&profile).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := profile.UnmarshalDigraphs(); err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+func (r *keystrokeProfileRepository) Save(profile *models.KeystrokeProfile) error {
+	if err := profile.MarshalDigraphs(); err != nil {
+		return err
+	}
+	return r.db.Save(profile).Error
+}
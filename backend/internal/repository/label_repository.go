@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type labelRepository struct {
+	db *gorm.DB
+}
+
+func NewLabelRepository(db *gorm.DB) LabelRepository {
+	return &labelRepository{db: db}
+}
+
+func (r *labelRepository) Create(label *models.SubmissionLabel) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(label).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Submission{}).
+			Where("id = ?", label.SubmissionID).
+			Update("label", label.Label).Error
+	})
+}
+
+func (r *labelRepository) FindBySubmissionID(submissionID uint) ([]models.SubmissionLabel, error) {
+	var labels []models.SubmissionLabel
+	err := r.db.Where("submission_id = ?", submissionID).Order("created_at desc").Find(&labels).Error
+	return labels, err
+}
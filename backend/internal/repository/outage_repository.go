@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type outageRepository struct {
+	db *gorm.DB
+}
+
+func NewOutageRepository(db *gorm.DB) OutageRepository {
+	return &outageRepository{db: db}
+}
+
+func (r *outageRepository) Create(outage *models.TelemetryOutage) error {
+	return r.db.Create(outage).Error
+}
+
+func (r *outageRepository) Update(outage *models.TelemetryOutage) error {
+	return r.db.Save(outage).Error
+}
+
+func (r *outageRepository) FindLatest(activityID, studentID, sessionID uint) (*models.TelemetryOutage, error) {
+	var outage models.TelemetryOutage
+	err := r.db.Where("activity_id = ? AND student_id = ? AND session_id = ?", activityID, studentID, sessionID).
+		Order("ended_at desc").
+		First(&outage).Error
+	if err != nil {
+		return nil, err
+	}
+	return &outage, nil
+}
+
+func (r *outageRepository) FindByActivityID(activityID uint) ([]models.TelemetryOutage, error) {
+	var outages []models.TelemetryOutage
+	err := r.db.Where("activity_id = ?", activityID).
+		Order("student_id asc, started_at asc").
+		Find(&outages).Error
+	return outages, err
+}
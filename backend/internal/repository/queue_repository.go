@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"time"
+
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type queueRepository struct {
+	db *gorm.DB
+}
+
+func NewQueueRepository(db *gorm.DB) QueueRepository {
+	return &queueRepository{db: db}
+}
+
+func (r *queueRepository) Push(job *models.TelemetryJob) error {
+	return r.db.Create(job).Error
+}
+
+// Claim leases and returns up to limit of the oldest jobs that are not leased
+// or whose lease expired. Rows locked by another worker are skipped, so
+// several workers can claim concurrently. Claimed jobs are only removed by
+// Delete, once handled.
+func (r *queueRepository) Claim(limit int, lease time.Duration) ([]models.TelemetryJob, error) {
+	var jobs []models.TelemetryJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("leased_until IS NULL OR leased_until < ?", now).
+			Order("id asc").
+			Limit(limit).
+			Find(&jobs).Error
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+
+		ids := make([]uint, len(jobs))
+		for i := range jobs {
+			ids[i] = jobs[i].ID
+		}
+		return tx.Model(&models.TelemetryJob{}).
+			Where("id IN ?", ids).
+			Update("leased_until", now.Add(lease)).Error
+	})
+	return jobs, err
+}
+
+func (r *queueRepository) Delete(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Where("id IN ?", ids).Delete(&models.TelemetryJob{}).Error
+}
+
+// Release sets the lease to availableAt, after which Claim picks the job up
+// again
+func (r *queueRepository) Release(id uint, attempts int, availableAt time.Time) error {
+	return r.db.Model(&models.TelemetryJob{}).
+		Where("id = ?", id).
+		Updates(map[string]interface{}{"attempts": attempts, "leased_until": availableAt}).Error
+}
+
+func (r *queueRepository) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.TelemetryJob{}).Count(&count).Error
+	return count, err
+}
+
+func (r *queueRepository) CreateDeadLetter(deadLetter *models.TelemetryDeadLetter) error {
+	return r.db.Create(deadLetter).Error
+}
@@ -1,11 +1,16 @@
 package repository
 
-import "dalivim/internal/models"
+import (
+	"time"
+
+	"dalivim/internal/models"
+)
 
 type UserRepository interface {
 	Create(user *models.User) error
 	FindByEmail(email string) (*models.User, error)
 	FindByID(id uint) (*models.User, error)
+	FindByStudentTokenHash(hash string) (*models.User, error)
 	FindAllStudents() ([]models.User, error)
 	FindByRole(role string) ([]models.User, error)
 	Update(user *models.User) error
@@ -17,15 +22,109 @@ type ActivityRepository interface {
 	FindByProfessorID(professorID uint) ([]models.Activity, error)
 	FindByInviteToken(token string) (*models.Activity, error)
 	CountSubmissions(activityID uint) (int64, error)
+	FindBySemesterID(semesterID uint) ([]models.Activity, error)
+	Update(activity *models.Activity) error
 }
 
 type SubmissionRepository interface {
 	Create(submission *models.Submission) error
+	CreateWithTelemetry(submission *models.Submission, telemetry *models.TelemetryData) error
+	// CompleteAnalysis applies the analysis of a submission saved with
+	// AnalysisPending. apply sets the result on the locked row and returns
+	// the run recording it; updateBaseline adds the submission to the
+	// student's baseline. applied is false when it was already analyzed.
+	CompleteAnalysis(id uint, apply func(submission *models.Submission) *models.AnalysisRun, updateBaseline func(baseline *models.StudentBaseline)) (applied bool, err error)
+	FindAnalysisPending(limit int) ([]models.Submission, error)
+	CountAnalysisPending(activityID uint) (int64, error)
+	FindByIdempotencyKey(key string) (*models.Submission, error)
 	FindByActivityID(activityID uint) ([]models.Submission, error)
+	FindByStudentID(studentID uint) ([]models.Submission, error)
 	FindByID(id uint) (*models.Submission, error)
+	UpdateCohort(submissions []models.Submission) error
+	// UpdatePasteProvenance saves the paste provenance and signals only
+	UpdatePasteProvenance(submission *models.Submission) error
+	FindLabeledByActivityIDs(activityIDs []uint) ([]models.Submission, error)
 }
 
 type TelemetryRepository interface {
+	// Create and CreateBatch skip batches whose session sequence is stored
 	Create(telemetry *models.TelemetryData) error
+	CreateBatch(telemetry []models.TelemetryData) error
 	FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryData, error)
+	FindFinalWithRawEvents(activityIDs []uint, before int64) ([]models.TelemetryData, error)
+	ClearRawEvents(id uint) error
+}
+
+type SessionRepository interface {
+	Create(session *models.TelemetrySession) error
+	FindByID(id uint) (*models.TelemetrySession, error)
+	Update(session *models.TelemetrySession) error
+}
+
+type QueueRepository interface {
+	Push(job *models.TelemetryJob) error
+	Claim(limit int, lease time.Duration) ([]models.TelemetryJob, error)
+	Delete(ids []uint) error
+	// Release returns a claimed job to the queue, claimable from availableAt
+	Release(id uint, attempts int, availableAt time.Time) error
+	Count() (int64, error)
+	CreateDeadLetter(deadLetter *models.TelemetryDeadLetter) error
+}
+
+type ArchiveRepository interface {
+	// FindCompactableSessions returns the distinct (activity, student, session)
+	// keys having non-final rows created before the given time
+	FindCompactableSessions(before time.Time) ([]models.TelemetryData, error)
+	FindCompactableRows(activityID, studentID, sessionID uint, before time.Time) ([]models.TelemetryData, error)
+	FindBySession(activityID, studentID, sessionID uint) (*models.TelemetryArchive, error)
+	FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryArchive, error)
+	// Compact saves the archive and deletes the rows it absorbed atomically
+	Compact(archive *models.TelemetryArchive, rowIDs []uint) error
+	FindRawExpired(activityIDs []uint, before int64) ([]models.TelemetryArchive, error)
+	FindExpired(activityIDs []uint, before int64) ([]models.TelemetryArchive, error)
+	Update(archive *models.TelemetryArchive) error
+	Delete(archive *models.TelemetryArchive) error
+}
+
+type OutageRepository interface {
+	Create(outage *models.TelemetryOutage) error
+	Update(outage *models.TelemetryOutage) error
+	FindLatest(activityID, studentID, sessionID uint) (*models.TelemetryOutage, error)
+	FindByActivityID(activityID uint) ([]models.TelemetryOutage, error)
+}
+
+type RuleRepository interface {
+	FindForActivity(activityID uint) ([]models.AnalysisRule, error)
+	ReplaceForActivity(activityID uint, rules []models.AnalysisRule) error
+	ReplaceGlobal(rules []models.AnalysisRule) error
+}
+
+type BaselineRepository interface {
+	FindByStudentID(studentID uint) (*models.StudentBaseline, error)
+	Save(baseline *models.StudentBaseline) error
+}
+
+type KeystrokeProfileRepository interface {
+	FindByStudentID(studentID uint) (*models.KeystrokeProfile, error)
+	Save(profile *models.KeystrokeProfile) error
+}
+
+type LabelRepository interface {
+	// Create stores a label and makes it the submission's current label
+	Create(label *models.SubmissionLabel) error
+	FindBySubmissionID(submissionID uint) ([]models.SubmissionLabel, error)
+}
+
+type AnalysisRunRepository interface {
+	Create(run *models.AnalysisRun) error
+	CreateApplied(run *models.AnalysisRun, submission *models.Submission) error
+	FindBySubmissionID(submissionID uint) ([]models.AnalysisRun, error)
+	FindByJobID(jobID uint) ([]models.AnalysisRun, error)
+	FindPrevious(run *models.AnalysisRun) (*models.AnalysisRun, error)
+}
+
+type ReanalysisJobRepository interface {
+	Create(job *models.ReanalysisJob) error
+	Update(job *models.ReanalysisJob) error
+	FindByID(id uint) (*models.ReanalysisJob, error)
 }
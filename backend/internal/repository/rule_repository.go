@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ruleRepository struct {
+	db *gorm.DB
+}
+
+func NewRuleRepository(db *gorm.DB) RuleRepository {
+	return &ruleRepository{db: db}
+}
+
+// FindForActivity returns the global overrides and those of the activity
+func (r *ruleRepository) FindForActivity(activityID uint) ([]models.AnalysisRule, error) {
+	var rules []models.AnalysisRule
+	err := r.db.Where("activity_id IS NULL OR activity_id = ?", activityID).Find(&rules).Error
+	return rules, err
+}
+
+func (r *ruleRepository) ReplaceForActivity(activityID uint, rules []models.AnalysisRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("activity_id = ?", activityID).Delete(&models.AnalysisRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+}
+
+func (r *ruleRepository) ReplaceGlobal(rules []models.AnalysisRule) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("activity_id IS NULL").Delete(&models.AnalysisRule{}).Error; err != nil {
+			return err
+		}
+		if len(rules) == 0 {
+			return nil
+		}
+		return tx.Create(&rules).Error
+	})
+}
@@ -15,8 +15,14 @@ func NewSemesterRepository(db *gorm.DB) SemesterRepository {
 	return &semesterRepository{db: db}
 }
 
+// Create writes the retention columns even when zero, which would otherwise
+// be replaced by their column defaults
 func (r *semesterRepository) Create(semester *models.Semester) error {
-	return r.db.Create(semester).Error
+	return r.db.Select(
+		"Year", "Period", "StartDate", "EndDate",
+		"RawRetentionDays", "FeatureRetentionDays",
+		"CreatedBy", "CreatedAt", "UpdatedAt",
+	).Create(semester).Error
 }
 
 func (r *semesterRepository) FindActive() (*models.Semester, error) {
@@ -43,3 +49,20 @@ func (r *semesterRepository) FindByYearAndPeriod(year, period int) (*models.Seme
 	}
 	return &semester, nil
 }
+
+func (r *semesterRepository) FindByID(id uint) (*models.Semester, error) {
+	var semester models.Semester
+	err := r.db.First(&semester, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &semester, nil
+}
+
+func (r *semesterRepository) Update(semester *models.Semester) error {
+	return r.db.Save(semester).Error
+}
+
+func (r *semesterRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Semester{}, id).Error
+}
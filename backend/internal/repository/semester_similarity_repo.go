@@ -1,6 +1,10 @@
 package repository
 
-import "dalivim/internal/models"
+import (
+	"time"
+
+	"dalivim/internal/models"
+)
 
 // SemesterRepository handles semester data operations
 type SemesterRepository interface {
@@ -8,15 +12,29 @@ type SemesterRepository interface {
 	FindActive() (*models.Semester, error)
 	FindAll() ([]models.Semester, error)
 	FindByYearAndPeriod(year, period int) (*models.Semester, error)
+	FindByID(id uint) (*models.Semester, error)
+	Update(semester *models.Semester) error
+	Delete(id uint) error
 }
 
 // SimilarityRepository handles similarity detection data
 type SimilarityRepository interface {
-	CreateDetection(detection *models.SimilarityDetection) error
-	CreateCluster(cluster *models.SimilarityCluster) error
-	UpdateDetection(detection *models.SimilarityDetection) error
+	CreateRunDetection(detection *models.SimilarityRunDetection) error
+	FindRunDetections(jobID uint) ([]models.SimilarityRunDetection, error)
+	ReplaceForActivity(activityID uint, detections []models.SimilarityDetection, clusters []models.SimilarityCluster) error
 	FindByActivityID(activityID uint) ([]models.SimilarityDetection, error)
 	FindClustersByActivityID(activityID uint) ([]models.SimilarityCluster, error)
 	FindByClusterID(clusterID uint) ([]models.SimilarityDetection, error)
 	FindSuspiciousByActivityID(activityID uint) ([]models.SimilarityDetection, error)
 }
+
+// SimilarityJobRepository handles background similarity jobs
+type SimilarityJobRepository interface {
+	Create(job *models.SimilarityJob) error
+	Update(job *models.SimilarityJob) error
+	FindByID(id uint) (*models.SimilarityJob, error)
+	FindActiveByActivityID(activityID uint) (*models.SimilarityJob, error)
+	FindPreviousCompleted(activityID, jobID uint) (*models.SimilarityJob, error)
+	// CancelIfActive marks a job cancelled unless it has already ended
+	CancelIfActive(id uint, finishedAt time.Time) error
+}
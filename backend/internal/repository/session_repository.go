@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"dalivim/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) Create(session *models.TelemetrySession) error {
+	if err := session.MarshalSignals(); err != nil {
+		return err
+	}
+	return r.db.Create(session).Error
+}
+
+func (r *sessionRepository) FindByID(id uint) (*models.TelemetrySession, error) {
+	var session models.TelemetrySession
+	err := r.db.First(&session, id).Error
+	if err != nil {
+		return nil, err
+	}
+
+	session.UnmarshalSignals()
+
+	return &session, nil
+}
+
+func (r *sessionRepository) Update(session *models.TelemetrySession) error {
+	if err := session.MarshalSignals(); err != nil {
+		return err
+	}
+	return r.db.Save(session).Error
+}
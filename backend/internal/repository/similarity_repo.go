@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"time"
+
 	"dalivim/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type similarityRepository struct {
@@ -14,16 +17,51 @@ func NewSimilarityRepository(db *gorm.DB) SimilarityRepository {
 	return &similarityRepository{db: db}
 }
 
-func (r *similarityRepository) CreateDetection(detection *models.SimilarityDetection) error {
+func (r *similarityRepository) CreateRunDetection(detection *models.SimilarityRunDetection) error {
 	return r.db.Create(detection).Error
 }
 
-func (r *similarityRepository) CreateCluster(cluster *models.SimilarityCluster) error {
-	return r.db.Create(cluster).Error
+func (r *similarityRepository) FindRunDetections(jobID uint) ([]models.SimilarityRunDetection, error) {
+	var detections []models.SimilarityRunDetection
+	err := r.db.Where("job_id = ?", jobID).
+		Order("similarity_score desc").
+		Find(&detections).Error
+	return detections, err
 }
 
-func (r *similarityRepository) UpdateDetection(detection *models.SimilarityDetection) error {
-	return r.db.Save(detection).Error
+// ReplaceForActivity swaps the current detections and clusters of an
+// activity in one transaction. Detections within a cluster's members get its
+// ID.
+func (r *similarityRepository) ReplaceForActivity(activityID uint, detections []models.SimilarityDetection, clusters []models.SimilarityCluster) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("activity_id = ?", activityID).Delete(&models.SimilarityDetection{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("activity_id = ?", activityID).Delete(&models.SimilarityCluster{}).Error; err != nil {
+			return err
+		}
+
+		for i := range clusters {
+			if err := tx.Create(&clusters[i]).Error; err != nil {
+				return err
+			}
+
+			members := make(map[uint]bool, len(clusters[i].SubmissionIDs))
+			for _, id := range clusters[i].SubmissionIDs {
+				members[id] = true
+			}
+			for j := range detections {
+				if members[detections[j].SubmissionID1] && members[detections[j].SubmissionID2] {
+					detections[j].ClusterID = &clusters[i].ID
+				}
+			}
+		}
+
+		if len(detections) == 0 {
+			return nil
+		}
+		return tx.Omit(clause.Associations).CreateInBatches(detections, 500).Error
+	})
 }
 
 func (r *similarityRepository) FindByActivityID(activityID uint) ([]models.SimilarityDetection, error) {
@@ -59,3 +97,60 @@ func (r *similarityRepository) FindSuspiciousByActivityID(activityID uint) ([]mo
 		Find(&detections).Error
 	return detections, err
 }
+
+type similarityJobRepository struct {
+	db *gorm.DB
+}
+
+func NewSimilarityJobRepository(db *gorm.DB) SimilarityJobRepository {
+	return &similarityJobRepository{db: db}
+}
+
+func (r *similarityJobRepository) Create(job *models.SimilarityJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r *similarityJobRepository) Update(job *models.SimilarityJob) error {
+	return r.db.Save(job).Error
+}
+
+func (r *similarityJobRepository) FindByID(id uint) (*models.SimilarityJob, error) {
+	var job models.SimilarityJob
+	err := r.db.First(&job, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (r *similarityJobRepository) CancelIfActive(id uint, finishedAt time.Time) error {
+	return r.db.Model(&models.SimilarityJob{}).
+		Where("id = ? AND status IN ?", id, []string{models.JobStatusPending, models.JobStatusRunning}).
+		Updates(map[string]interface{}{"status": models.JobStatusCancelled, "finished_at": finishedAt}).Error
+}
+
+// FindActiveByActivityID returns the pending or running job of an activity
+func (r *similarityJobRepository) FindActiveByActivityID(activityID uint) (*models.SimilarityJob, error) {
+	var job models.SimilarityJob
+	err := r.db.Where("activity_id = ? AND status IN ?", activityID,
+		[]string{models.JobStatusPending, models.JobStatusRunning}).
+		Order("id desc").
+		First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// FindPreviousCompleted returns the last completed job of an activity before
+// jobID
+func (r *similarityJobRepository) FindPreviousCompleted(activityID, jobID uint) (*models.SimilarityJob, error) {
+	var job models.SimilarityJob
+	err := r.db.Where("activity_id = ? AND id < ? AND status = ?", activityID, jobID, models.JobStatusCompleted).
+		Order("id desc").
+		First(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
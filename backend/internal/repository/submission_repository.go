@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"errors"
+
 	"dalivim/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type submissionRepository struct {
@@ -22,6 +25,127 @@ func (r *submissionRepository) Create(submission *models.Submission) error {
 	return r.db.Create(submission).Error
 }
 
+// CreateWithTelemetry stores the final telemetry and the submission it
+// produced atomically
+func (r *submissionRepository) CreateWithTelemetry(submission *models.Submission, telemetry *models.TelemetryData) error {
+	if err := submission.MarshalSignals(); err != nil {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(telemetry).Error; err != nil {
+			return err
+		}
+		submission.FinalTelemetryID = telemetry.ID
+		return tx.Create(submission).Error
+	})
+}
+
+// CompleteAnalysis locks the submission, so a cohort pass or a second
+// worker cannot interleave, and stores the run, the analysis columns and the
+// baseline in one transaction
+func (r *submissionRepository) CompleteAnalysis(
+	id uint,
+	apply func(submission *models.Submission) *models.AnalysisRun,
+	updateBaseline func(baseline *models.StudentBaseline),
+) (bool, error) {
+	applied := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var submission models.Submission
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND analysis_pending", id).
+			First(&submission).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		submission.UnmarshalSignals()
+
+		run := apply(&submission)
+		submission.AnalysisPending = false
+		if err := submission.MarshalSignals(); err != nil {
+			return err
+		}
+		if err := run.MarshalResults(); err != nil {
+			return err
+		}
+
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		err = tx.Model(&submission).
+			Select(
+				"authorship_score", "confidence", "confidence_score",
+				"signals", "detector_results",
+				"baseline_deviation", "identity_consistency", "analysis_version",
+				"paste_provenance", "analysis_pending",
+			).
+			Updates(&submission).Error
+		if err != nil {
+			return err
+		}
+
+		applied = true
+		return updateStudentBaseline(tx, submission.StudentID, updateBaseline)
+	})
+	return applied && err == nil, err
+}
+
+func (r *submissionRepository) FindAnalysisPending(limit int) ([]models.Submission, error) {
+	var submissions []models.Submission
+	err := r.db.Where("analysis_pending").Order("id asc").Limit(limit).Find(&submissions).Error
+	return submissions, err
+}
+
+func (r *submissionRepository) CountAnalysisPending(activityID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Submission{}).
+		Where("activity_id = ? AND analysis_pending", activityID).
+		Count(&count).Error
+	return count, err
+}
+
+func updateStudentBaseline(tx *gorm.DB, studentID uint, update func(baseline *models.StudentBaseline)) error {
+	// Create the row first, so concurrent submissions lock the same one
+	err := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "student_id"}}, DoNothing: true}).
+		Create(&models.StudentBaseline{StudentID: studentID}).Error
+	if err != nil {
+		return err
+	}
+
+	var baseline models.StudentBaseline
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("student_id = ?", studentID).
+		First(&baseline).Error
+	if err != nil {
+		return err
+	}
+	if err := baseline.UnmarshalStats(); err != nil {
+		return err
+	}
+
+	update(&baseline)
+
+	if err := baseline.MarshalStats(); err != nil {
+		return err
+	}
+	return tx.Save(&baseline).Error
+}
+
+func (r *submissionRepository) FindByIdempotencyKey(key string) (*models.Submission, error) {
+	var submission models.Submission
+	err := r.db.Where("idempotency_key = ?", key).First(&submission).Error
+	if err != nil {
+		return nil, err
+	}
+
+	submission.UnmarshalSignals()
+
+	return &submission, nil
+}
+
 func (r *submissionRepository) FindByActivityID(activityID uint) ([]models.Submission, error) {
 	var submissions []models.Submission
 	err := r.db.Where("activity_id = ?", activityID).Order("created_at desc").Find(&submissions).Error
@@ -37,6 +161,20 @@ func (r *submissionRepository) FindByActivityID(activityID uint) ([]models.Submi
 	return submissions, nil
 }
 
+func (r *submissionRepository) FindByStudentID(studentID uint) ([]models.Submission, error) {
+	var submissions []models.Submission
+	err := r.db.Where("student_id = ?", studentID).Order("created_at desc").Find(&submissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range submissions {
+		submissions[i].UnmarshalSignals()
+	}
+
+	return submissions, nil
+}
+
 func (r *submissionRepository) FindByID(id uint) (*models.Submission, error) {
 	var submission models.Submission
 	err := r.db.First(&submission, id).Error
@@ -49,3 +187,44 @@ func (r *submissionRepository) FindByID(id uint) (*models.Submission, error) {
 
 	return &submission, nil
 }
+
+// UpdateCohort stores the cohort results of several submissions in one
+// transaction. Only the cohort columns are written, so labels set meanwhile
+// are kept.
+func (r *submissionRepository) UpdateCohort(submissions []models.Submission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		for i := range submissions {
+			if err := submissions[i].MarshalSignals(); err != nil {
+				return err
+			}
+			err := tx.Model(&submissions[i]).
+				Select("cohort_percentile", "cohort_analyzed_at", "signals", "detector_results").
+				Updates(&submissions[i]).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *submissionRepository) UpdatePasteProvenance(submission *models.Submission) error {
+	if err := submission.MarshalSignals(); err != nil {
+		return err
+	}
+	return r.db.Model(submission).Select("paste_provenance", "signals").Updates(submission).Error
+}
+
+func (r *submissionRepository) FindLabeledByActivityIDs(activityIDs []uint) ([]models.Submission, error) {
+	var submissions []models.Submission
+	err := r.db.Where("activity_id IN ? AND label <> ''", activityIDs).Order("id asc").Find(&submissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range submissions {
+		submissions[i].UnmarshalSignals()
+	}
+
+	return submissions, nil
+}
@@ -4,8 +4,17 @@ import (
 	"dalivim/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// skipStoredSequence makes inserting a batch already stored a no-op, such as
+// a queue item delivered again after its lease expired
+var skipStoredSequence = clause.OnConflict{
+	Columns:     []clause.Column{{Name: "session_id"}, {Name: "sequence"}},
+	TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: models.TelemetrySequenceIndexWhere}}},
+	DoNothing:   true,
+}
+
 type telemetryRepository struct {
 	db *gorm.DB
 }
@@ -15,7 +24,11 @@ func NewTelemetryRepository(db *gorm.DB) TelemetryRepository {
 }
 
 func (r *telemetryRepository) Create(telemetry *models.TelemetryData) error {
-	return r.db.Create(telemetry).Error
+	return r.db.Clauses(skipStoredSequence).Create(telemetry).Error
+}
+
+func (r *telemetryRepository) CreateBatch(telemetry []models.TelemetryData) error {
+	return r.db.Clauses(skipStoredSequence).Create(&telemetry).Error
 }
 
 func (r *telemetryRepository) FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryData, error) {
@@ -25,3 +38,14 @@ func (r *telemetryRepository) FindByActivityAndStudent(activityID, studentID uin
 		Find(&telemetry).Error
 	return telemetry, err
 }
+
+func (r *telemetryRepository) FindFinalWithRawEvents(activityIDs []uint, before int64) ([]models.TelemetryData, error) {
+	var telemetry []models.TelemetryData
+	err := r.db.Where("activity_id IN ? AND is_final = ? AND timestamp < ? AND raw_events <> ''", activityIDs, true, before).
+		Find(&telemetry).Error
+	return telemetry, err
+}
+
+func (r *telemetryRepository) ClearRawEvents(id uint) error {
+	return r.db.Model(&models.TelemetryData{}).Where("id = ?", id).Update("raw_events", "").Error
+}
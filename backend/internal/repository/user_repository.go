@@ -36,6 +36,15 @@ func (r *userRepository) FindByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
+func (r *userRepository) FindByStudentTokenHash(hash string) (*models.User, error) {
+	var user models.User
+	err := r.db.Where("student_token_hash = ?", hash).First(&user).Error
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 func (r *userRepository) FindAllStudents() ([]models.User, error) {
 	var users []models.User
 	err := r.db.Where("role = ?", "student").Find(&users).Error
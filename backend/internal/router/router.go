@@ -11,20 +11,44 @@ import (
 )
 
 type Router struct {
-	authHandler      *handler.AuthHandler
-	activityHandler  *handler.ActivityHandler
-	telemetryHandler *handler.TelemetryHandler
+	authHandler       *handler.AuthHandler
+	activityHandler   *handler.ActivityHandler
+	telemetryHandler  *handler.TelemetryHandler
+	streamHandler     *handler.StreamHandler
+	proctorHandler    *handler.ProctoringHandler
+	rulesHandler      *handler.AnalysisRulesHandler
+	cohortHandler     *handler.CohortHandler
+	labelHandler      *handler.LabelHandler
+	reanalysisHandler *handler.ReanalysisHandler
+	similarityHandler *handler.SimilarityHandler
+	semesterHandler   *handler.SemesterHandler
 }
 
 func NewRouter(
 	authHandler *handler.AuthHandler,
 	activityHandler *handler.ActivityHandler,
 	telemetryHandler *handler.TelemetryHandler,
+	streamHandler *handler.StreamHandler,
+	proctorHandler *handler.ProctoringHandler,
+	rulesHandler *handler.AnalysisRulesHandler,
+	cohortHandler *handler.CohortHandler,
+	labelHandler *handler.LabelHandler,
+	reanalysisHandler *handler.ReanalysisHandler,
+	similarityHandler *handler.SimilarityHandler,
+	semesterHandler *handler.SemesterHandler,
 ) *Router {
 	return &Router{
-		authHandler:      authHandler,
-		activityHandler:  activityHandler,
-		telemetryHandler: telemetryHandler,
+		authHandler:       authHandler,
+		activityHandler:   activityHandler,
+		telemetryHandler:  telemetryHandler,
+		streamHandler:     streamHandler,
+		proctorHandler:    proctorHandler,
+		rulesHandler:      rulesHandler,
+		cohortHandler:     cohortHandler,
+		labelHandler:      labelHandler,
+		reanalysisHandler: reanalysisHandler,
+		similarityHandler: similarityHandler,
+		semesterHandler:   semesterHandler,
 	}
 }
 
@@ -35,7 +59,7 @@ func (r *Router) Setup() *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Stream-Auth", "Idempotency-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -58,6 +82,10 @@ func (r *Router) Setup() *gin.Engine {
 
 		// Telemetry (public)
 		api.POST("/telemetry", r.telemetryHandler.Process)
+
+		// Telemetry streaming (authenticated with the session stream credential)
+		api.GET("/telemetry/sessions/:sessionId/stream", r.streamHandler.Subscribe)
+		api.POST("/telemetry/sessions/:sessionId/frames", r.streamHandler.Push)
 	}
 
 	// Protected routes
@@ -68,9 +96,63 @@ func (r *Router) Setup() *gin.Engine {
 		protected.POST("/activities", r.activityHandler.Create)
 		protected.GET("/activities", r.activityHandler.GetAll)
 		protected.GET("/activities/:id", r.activityHandler.GetByID)
+		protected.POST("/activities/:id/close", r.activityHandler.Close)
 
 		// Submissions
 		protected.GET("/activities/:id/submissions", r.telemetryHandler.GetSubmissions)
+		protected.GET("/activities/:id/outages", r.telemetryHandler.GetOutages)
+
+		// Telemetry ingestion metrics
+		protected.GET("/telemetry/metrics", r.telemetryHandler.GetPipelineMetrics)
+
+		// Analysis rules
+		protected.GET("/activities/:id/analysis-rules", r.rulesHandler.Get)
+		protected.PUT("/activities/:id/analysis-rules", r.rulesHandler.Update)
+		protected.GET("/analysis-rules", r.rulesHandler.GetGlobal)
+		protected.PUT("/analysis-rules", r.rulesHandler.UpdateGlobal)
+
+		// Cohort comparison
+		protected.POST("/activities/:id/cohort-analysis", r.cohortHandler.Analyze)
+
+		// Professor labels
+		protected.POST("/submissions/:id/labels", r.labelHandler.Create)
+		protected.GET("/submissions/:id/labels", r.labelHandler.History)
+		protected.GET("/activities/:id/labels/export", r.labelHandler.Export)
+		protected.GET("/labels/export", r.labelHandler.Export)
+
+		// Analysis history and re-analysis
+		protected.GET("/submissions/:id/analysis-runs", r.reanalysisHandler.Runs)
+		protected.POST("/activities/:id/reanalyze", r.reanalysisHandler.StartActivity)
+		protected.POST("/semesters/:id/reanalyze", r.reanalysisHandler.StartSemester)
+		protected.GET("/reanalysis-jobs/:id", r.reanalysisHandler.GetJob)
+		protected.GET("/reanalysis-jobs/:id/comparison", r.reanalysisHandler.Compare)
+
+		// Code similarity between submissions
+		protected.POST("/activities/:id/similarity/run", r.similarityHandler.Run)
+		protected.GET("/activities/:id/similarities", r.similarityHandler.GetSimilarities)
+		protected.GET("/activities/:id/clusters", r.similarityHandler.GetClusters)
+		protected.GET("/similarity-jobs/:id", r.similarityHandler.GetJob)
+		protected.POST("/similarity-jobs/:id/cancel", r.similarityHandler.CancelJob)
+		protected.GET("/similarity-jobs/:id/detections", r.similarityHandler.GetJobDetections)
+		protected.GET("/similarity-jobs/:id/comparison", r.similarityHandler.CompareJob)
+
+		// Semesters
+		protected.GET("/semesters", r.semesterHandler.GetAll)
+		protected.POST("/semesters", r.semesterHandler.Create)
+		protected.GET("/semesters/active", r.semesterHandler.GetActive)
+		protected.POST("/semesters/active/refresh-students", r.semesterHandler.RefreshStudents)
+		protected.GET("/semesters/:id", r.semesterHandler.GetByID)
+		protected.PUT("/semesters/:id", r.semesterHandler.Update)
+		protected.DELETE("/semesters/:id", r.semesterHandler.Delete)
+	}
+
+	// Server-Sent Event feeds for browsers, which also take the token from
+	// X-Stream-Auth or ?auth=
+	streams := api.Group("")
+	streams.Use(middleware.StreamAuthMiddleware())
+	{
+		// Live proctoring feed
+		streams.GET("/activities/:id/live", r.proctorHandler.Live)
 	}
 
 	return router
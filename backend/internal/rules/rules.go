@@ -0,0 +1,177 @@
+// Package rules holds the thresholds and weights used by the authorship
+// analysis, with built-in defaults that can be overridden from a YAML file,
+// globally in the database and per activity.
+package rules
+
+import (
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule configures one analysis signal. Weight is added to the suspicion
+// score when the signal fires; negative weights mark evidence of genuine
+// authorship.
+type Rule struct {
+	Enabled   bool    `yaml:"enabled" json:"enabled"`
+	Threshold float64 `yaml:"threshold" json:"threshold"`
+	Weight    float64 `yaml:"weight" json:"weight"`
+}
+
+// Set maps rule names to their configuration
+type Set map[string]Rule
+
+// Rule names
+const (
+	HighPasteRatio       = "high_paste_ratio"
+	ModeratePasteRatio   = "moderate_paste_ratio"
+	PasteFromPeer        = "paste_from_peer_submission"
+	ExternalPaste        = "external_paste"
+	LowEditRatio         = "low_edit_ratio"
+	HighlyLinearEditing  = "highly_linear_editing"
+	MultiplePasteEvents  = "multiple_paste_events"
+	FastCompletion       = "fast_completion_no_testing"
+	FrequentFocusLoss    = "frequent_focus_loss"
+	LowTypingVariance    = "low_typing_variance"
+	LinearNavigationOnly = "linear_navigation_only"
+	NonLinearNavigation  = "non_linear_navigation"
+	NoUndoUsage          = "no_undo_usage"
+	UndoUsage            = "undo_usage"
+	BaselineDeviation    = "baseline_deviation"
+	ConsistentBaseline   = "consistent_with_baseline"
+	CohortOutlier        = "cohort_outlier"
+	IdentityMismatch     = "identity_mismatch"
+	AICodeStyle          = "ai_code_style"
+	StyleShift           = "style_shift"
+	NewLanguageFeatures  = "new_language_features"
+	UntypedCode          = "untyped_code"
+	IdleThenBurst        = "idle_then_burst"
+)
+
+// Idiom rules mark a language idiom as above the course level for the
+// stylometry detector. A course that teaches an idiom disables its rule.
+// Threshold is how many uses make the idiom count and weight how much it
+// counts towards the idioms of generated code.
+const (
+	IdiomComprehension     = "idiom_comprehension"
+	IdiomLambda            = "idiom_lambda"
+	IdiomFString           = "idiom_f_string"
+	IdiomEnumerateZip      = "idiom_enumerate_zip"
+	IdiomContextManager    = "idiom_context_manager"
+	IdiomGenerator         = "idiom_generator"
+	IdiomDecorator         = "idiom_decorator"
+	IdiomTypeHints         = "idiom_type_hints"
+	IdiomMainGuard         = "idiom_main_guard"
+	IdiomExceptionHandling = "idiom_exception_handling"
+	IdiomFunctional        = "idiom_functional"
+	IdiomStreams           = "idiom_streams"
+	IdiomDestructuring     = "idiom_destructuring"
+)
+
+// Defaults returns the built-in rule set
+func Defaults() Set {
+	return Set{
+		HighPasteRatio:       {Enabled: true, Threshold: 0.6, Weight: 0.3},
+		ModeratePasteRatio:   {Enabled: true, Threshold: 0.3, Weight: 0.15},
+		PasteFromPeer:        {Enabled: true, Threshold: 0, Weight: 0.4},
+		ExternalPaste:        {Enabled: true, Threshold: 0.3, Weight: 0.2},
+		LowEditRatio:         {Enabled: true, Threshold: 0.02, Weight: 0.25},
+		HighlyLinearEditing:  {Enabled: true, Threshold: 0.9, Weight: 0.2},
+		MultiplePasteEvents:  {Enabled: true, Threshold: 3, Weight: 0.15},
+		FastCompletion:       {Enabled: true, Threshold: 120, Weight: 0.2},
+		FrequentFocusLoss:    {Enabled: true, Threshold: 5, Weight: 0.1},
+		LowTypingVariance:    {Enabled: true, Threshold: 0.3, Weight: 0.15},
+		LinearNavigationOnly: {Enabled: true, Threshold: 0.05, Weight: 0.1},
+		NonLinearNavigation:  {Enabled: true, Threshold: 0.2, Weight: -0.1},
+		NoUndoUsage:          {Enabled: true, Threshold: 200, Weight: 0.05},
+		UndoUsage:            {Enabled: true, Threshold: 200, Weight: -0.05},
+		BaselineDeviation:    {Enabled: true, Threshold: 3, Weight: 0.2},
+		ConsistentBaseline:   {Enabled: true, Threshold: 1, Weight: -0.1},
+		CohortOutlier:        {Enabled: true, Threshold: 3.5, Weight: 0.2},
+		IdentityMismatch:     {Enabled: true, Threshold: 0.4, Weight: 0.3},
+		AICodeStyle:          {Enabled: true, Threshold: 0.6, Weight: 0.25},
+		StyleShift:           {Enabled: true, Threshold: 0.3, Weight: 0.2},
+		NewLanguageFeatures:  {Enabled: true, Threshold: 3, Weight: 0.1},
+		UntypedCode:          {Enabled: true, Threshold: 0.05, Weight: 0.5},
+		IdleThenBurst:        {Enabled: true, Threshold: 60, Weight: 0.25},
+
+		IdiomComprehension:     {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomLambda:            {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomFString:           {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomEnumerateZip:      {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomContextManager:    {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomGenerator:         {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomDecorator:         {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomTypeHints:         {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomMainGuard:         {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomExceptionHandling: {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomFunctional:        {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomStreams:           {Enabled: true, Threshold: 1, Weight: 1},
+		IdiomDestructuring:     {Enabled: true, Threshold: 1, Weight: 1},
+	}
+}
+
+// Get returns the rule, or a disabled rule when it is unknown
+func (s Set) Get(name string) Rule {
+	return s[name]
+}
+
+// Merge returns a copy of s with overrides applied on top
+func (s Set) Merge(overrides Set) Set {
+	merged := make(Set, len(s)+len(overrides))
+	for name, rule := range s {
+		merged[name] = rule
+	}
+	for name, rule := range overrides {
+		merged[name] = rule
+	}
+	return merged
+}
+
+// Override changes some fields of a rule, as written in the YAML file or
+// sent to the API; omitted fields keep the value they override
+type Override struct {
+	Enabled   *bool    `yaml:"enabled" json:"enabled"`
+	Threshold *float64 `yaml:"threshold" json:"threshold"`
+	Weight    *float64 `yaml:"weight" json:"weight"`
+}
+
+// Apply returns the rule with the fields of the override set
+func (o Override) Apply(rule Rule) Rule {
+	if o.Enabled != nil {
+		rule.Enabled = *o.Enabled
+	}
+	if o.Threshold != nil {
+		rule.Threshold = *o.Threshold
+	}
+	if o.Weight != nil {
+		rule.Weight = *o.Weight
+	}
+	return rule
+}
+
+// LoadFile reads a YAML rule file and applies it over the defaults. The file
+// maps rule names to any of enabled/threshold/weight.
+func LoadFile(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrides map[string]Override
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid rule file %s: %w", path, err)
+	}
+
+	set := Defaults()
+	for name, override := range overrides {
+		rule, ok := set[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid rule file %s: unknown rule %q", path, name)
+		}
+		set[name] = override.Apply(rule)
+	}
+
+	return set, nil
+}
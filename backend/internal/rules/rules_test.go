@@ -0,0 +1,36 @@
+package rules
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOverrideKeepsOmittedFields(t *testing.T) {
+	threshold := 300.0
+	rule := Override{Threshold: &threshold}.Apply(Rule{Enabled: true, Threshold: 120, Weight: 0.2})
+
+	if rule != (Rule{Enabled: true, Threshold: 300, Weight: 0.2}) {
+		t.Errorf("rule = %+v, want only the threshold changed", rule)
+	}
+}
+
+func TestLoadFileAppliesOverridesOnDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	os.WriteFile(path, []byte("fast_completion_no_testing:\n  threshold: 300\n"), 0o644)
+
+	set, err := LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rule := set.Get(FastCompletion)
+	if !rule.Enabled || rule.Threshold != 300 || rule.Weight != Defaults()[FastCompletion].Weight {
+		t.Errorf("rule = %+v, want the default with threshold 300", rule)
+	}
+
+	os.WriteFile(path, []byte("no_such_rule:\n  weight: 1\n"), 0o644)
+	if _, err := LoadFile(path); err == nil {
+		t.Error("unknown rule accepted")
+	}
+}
@@ -0,0 +1,93 @@
+package scoring
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Sample is one labeled submission. Label is 1 when the submission was not
+// genuinely authored, 0 when it was, and -1 when unlabeled.
+type Sample struct {
+	SubmissionID uint
+	Features     map[string]float64
+	Label        int
+}
+
+// CSV columns besides the features
+const (
+	ColumnSubmissionID = "submission_id"
+	ColumnLabel        = "label"
+)
+
+// ReadSamples reads a CSV with a header row holding submission_id, label and
+// feature columns. Other columns are ignored, as are empty feature cells.
+func ReadSamples(r io.Reader) ([]Sample, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("missing header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[name] = i
+	}
+	labelColumn, ok := columns[ColumnLabel]
+	if !ok {
+		return nil, fmt.Errorf("missing %q column", ColumnLabel)
+	}
+
+	var samples []Sample
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sample := Sample{Features: map[string]float64{}, Label: -1}
+		if i, ok := columns[ColumnSubmissionID]; ok && i < len(record) {
+			id, _ := strconv.ParseUint(record[i], 10, 32)
+			sample.SubmissionID = uint(id)
+		}
+		if labelColumn < len(record) && record[labelColumn] != "" {
+			label, err := strconv.Atoi(record[labelColumn])
+			if err != nil || (label != 0 && label != 1) {
+				return nil, fmt.Errorf("line %d: invalid label %q", line, record[labelColumn])
+			}
+			sample.Label = label
+		}
+		for _, name := range Features {
+			i, ok := columns[name]
+			if !ok || i >= len(record) || record[i] == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s %q", line, name, record[i])
+			}
+			sample.Features[name] = value
+		}
+
+		samples = append(samples, sample)
+	}
+
+	return samples, nil
+}
+
+// Labeled keeps the samples that have a label
+func Labeled(samples []Sample) []Sample {
+	labeled := make([]Sample, 0, len(samples))
+	for _, sample := range samples {
+		if sample.Label >= 0 {
+			labeled = append(labeled, sample)
+		}
+	}
+	return labeled
+}
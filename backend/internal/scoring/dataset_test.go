@@ -0,0 +1,45 @@
+package scoring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadSamplesLeavesEmptyCellsMissing(t *testing.T) {
+	data := "submission_id,label,pasteCharRatio,undoFrequency\n" +
+		"1,1,0.8,\n" +
+		"2,0,0.1,2.5\n"
+
+	samples, err := ReadSamples(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("read %d samples, want 2", len(samples))
+	}
+	if _, ok := samples[0].Features["undoFrequency"]; ok {
+		t.Error("empty cell read as a value")
+	}
+	if got := samples[1].Features["undoFrequency"]; got != 2.5 {
+		t.Errorf("undoFrequency = %v, want 2.5", got)
+	}
+}
+
+func TestMissingFeaturesTakeTheTrainingMean(t *testing.T) {
+	model := &Model{
+		Features: []string{"undoFrequency"},
+		Means:    []float64{4},
+		Stds:     []float64{2},
+		Weights:  []float64{1.5},
+		Bias:     0.2,
+	}
+
+	missing := model.Predict(map[string]float64{})
+	atMean := model.Predict(map[string]float64{"undoFrequency": 4})
+	if missing != atMean {
+		t.Errorf("missing feature predicts %v, the mean predicts %v", missing, atMean)
+	}
+	if zero := model.Predict(map[string]float64{"undoFrequency": 0}); zero == missing {
+		t.Error("a zero value is scored as missing")
+	}
+}
@@ -0,0 +1,103 @@
+package scoring
+
+import "math"
+
+// Samples predicted at or above this probability count as not genuine
+const DecisionThreshold = 0.5
+
+// Number of bins of the calibration curve
+const calibrationBins = 10
+
+// Metrics measure a model on labeled samples
+type Metrics struct {
+	Samples     int                `json:"samples"`
+	Accuracy    float64            `json:"accuracy"`
+	Precision   float64            `json:"precision"`
+	Recall      float64            `json:"recall"`
+	F1          float64            `json:"f1"`
+	LogLoss     float64            `json:"logLoss"`
+	Calibration []CalibrationPoint `json:"calibration"`
+}
+
+// CalibrationPoint compares the mean predicted probability of a bin with the
+// observed share of positive labels in it
+type CalibrationPoint struct {
+	From      float64 `json:"from"`
+	To        float64 `json:"to"`
+	Count     int     `json:"count"`
+	Predicted float64 `json:"predicted"`
+	Observed  float64 `json:"observed"`
+}
+
+// Evaluate measures a model on labeled samples
+func Evaluate(model *Model, samples []Sample) Metrics {
+	samples = Labeled(samples)
+	metrics := Metrics{Samples: len(samples)}
+	if len(samples) == 0 {
+		return metrics
+	}
+
+	bins := make([]CalibrationPoint, calibrationBins)
+	for i := range bins {
+		bins[i].From = float64(i) / calibrationBins
+		bins[i].To = float64(i+1) / calibrationBins
+	}
+
+	var truePositive, falsePositive, falseNegative, correct int
+	logLoss := 0.0
+	for _, sample := range samples {
+		p := model.Predict(sample.Features)
+		predicted := 0
+		if p >= DecisionThreshold {
+			predicted = 1
+		}
+
+		switch {
+		case predicted == 1 && sample.Label == 1:
+			truePositive++
+		case predicted == 1 && sample.Label == 0:
+			falsePositive++
+		case predicted == 0 && sample.Label == 1:
+			falseNegative++
+		}
+		if predicted == sample.Label {
+			correct++
+		}
+
+		clipped := min(max(p, 1e-15), 1-1e-15)
+		if sample.Label == 1 {
+			logLoss -= math.Log(clipped)
+		} else {
+			logLoss -= math.Log(1 - clipped)
+		}
+
+		bin := min(int(p*calibrationBins), calibrationBins-1)
+		bins[bin].Count++
+		bins[bin].Predicted += p
+		bins[bin].Observed += float64(sample.Label)
+	}
+
+	n := float64(len(samples))
+	metrics.Accuracy = float64(correct) / n
+	metrics.LogLoss = logLoss / n
+	if truePositive+falsePositive > 0 {
+		metrics.Precision = float64(truePositive) / float64(truePositive+falsePositive)
+	}
+	if truePositive+falseNegative > 0 {
+		metrics.Recall = float64(truePositive) / float64(truePositive+falseNegative)
+	}
+	if metrics.Precision+metrics.Recall > 0 {
+		metrics.F1 = 2 * metrics.Precision * metrics.Recall / (metrics.Precision + metrics.Recall)
+	}
+
+	for _, bin := range bins {
+		if bin.Count == 0 {
+			continue
+		}
+		bin.Predicted /= float64(bin.Count)
+		bin.Observed /= float64(bin.Count)
+		metrics.Calibration = append(metrics.Calibration, bin)
+	}
+
+	return metrics
+}
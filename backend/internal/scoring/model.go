@@ -0,0 +1,135 @@
+// Package scoring trains and applies statistical authorship models from
+// professor-labeled submissions.
+package scoring
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Features used by models, as named in telemetry features
+var Features = []string{
+	"avgKeystrokeInterval",
+	"stdKeystrokeInterval",
+	"pasteEvents",
+	"pasteCharRatio",
+	"deleteRatio",
+	"focusLossCount",
+	"linearEditingScore",
+	"burstiness",
+	"timeToFirstRun",
+	"executionCount",
+	"totalTime",
+	"totalKeystrokes",
+	"nonLinearNavigationRatio",
+	"undoFrequency",
+}
+
+// Model is a logistic regression over standardized features. It predicts the
+// probability that a submission was not genuinely authored.
+type Model struct {
+	Version   string    `json:"version"`
+	Kind      string    `json:"kind"` // Always "logistic_regression"
+	TrainedAt time.Time `json:"trainedAt"`
+	Samples   int       `json:"samples"`
+	Features  []string  `json:"features"`
+	Means     []float64 `json:"means"`
+	Stds      []float64 `json:"stds"`
+	Weights   []float64 `json:"weights"`
+	Bias      float64   `json:"bias"`
+	Metrics   *Metrics  `json:"metrics,omitempty"` // Measured on the holdout set
+}
+
+const KindLogisticRegression = "logistic_regression"
+
+// Predict returns the probability that a submission is not genuine. Missing
+// features take the training mean.
+func (m *Model) Predict(features map[string]float64) float64 {
+	z := m.Bias
+	for i, name := range m.Features {
+		value, ok := features[name]
+		if !ok {
+			continue
+		}
+		z += m.Weights[i] * m.standardize(i, value)
+	}
+	return sigmoid(z)
+}
+
+// Contribution is how far one feature moved a prediction: the feature's
+// weight times its standardized value, in log-odds. Positive contributions
+// point to a submission not genuinely authored.
+type Contribution struct {
+	Feature      string  `json:"feature"`
+	Value        float64 `json:"value"`
+	Contribution float64 `json:"contribution"`
+}
+
+// Contributions explains Predict: the bias plus every contribution is the
+// log-odds of the prediction. Missing features contribute nothing and are
+// left out. The largest contributions, either way, come first.
+func (m *Model) Contributions(features map[string]float64) []Contribution {
+	contributions := []Contribution{}
+	for i, name := range m.Features {
+		value, ok := features[name]
+		if !ok {
+			continue
+		}
+		contributions = append(contributions, Contribution{
+			Feature:      name,
+			Value:        value,
+			Contribution: m.Weights[i] * m.standardize(i, value),
+		})
+	}
+
+	sort.SliceStable(contributions, func(i, j int) bool {
+		return math.Abs(contributions[i].Contribution) > math.Abs(contributions[j].Contribution)
+	})
+	return contributions
+}
+
+func (m *Model) standardize(i int, value float64) float64 {
+	if m.Stds[i] == 0 {
+		return 0
+	}
+	return (value - m.Means[i]) / m.Stds[i]
+}
+
+// Load reads a model artifact
+func Load(path string) (*Model, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var model Model
+	if err := json.Unmarshal(data, &model); err != nil {
+		return nil, fmt.Errorf("invalid model %s: %w", path, err)
+	}
+	if model.Kind != KindLogisticRegression {
+		return nil, fmt.Errorf("invalid model %s: unsupported kind %q", path, model.Kind)
+	}
+	n := len(model.Features)
+	if len(model.Weights) != n || len(model.Means) != n || len(model.Stds) != n {
+		return nil, fmt.Errorf("invalid model %s: %d features but %d weights", path, n, len(model.Weights))
+	}
+
+	return &model, nil
+}
+
+// Save writes a model artifact
+func (m *Model) Save(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func sigmoid(z float64) float64 {
+	return 1 / (1 + math.Exp(-z))
+}
@@ -0,0 +1,133 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+var ErrNotEnoughSamples = errors.New("not enough labeled samples of each class")
+
+// Options tune training
+type Options struct {
+	Version      string
+	Epochs       int
+	LearningRate float64
+	L2           float64 // Regularization strength
+	Holdout      float64 // Share of samples kept for evaluation
+	Seed         int64
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Epochs:       2000,
+		LearningRate: 0.1,
+		L2:           0.01,
+		Holdout:      0.2,
+		Seed:         1,
+	}
+}
+
+// Train fits a logistic regression with batch gradient descent on labeled
+// samples. A shuffled holdout share is kept out of training and used to
+// compute the model metrics.
+func Train(samples []Sample, opts Options) (*Model, error) {
+	samples = Labeled(samples)
+
+	shuffled := append([]Sample(nil), samples...)
+	rng := rand.New(rand.NewSource(opts.Seed))
+	rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+	holdout := int(float64(len(shuffled)) * opts.Holdout)
+	test, train := shuffled[:holdout], shuffled[holdout:]
+
+	positives := 0
+	for _, sample := range train {
+		positives += sample.Label
+	}
+	if positives < 2 || len(train)-positives < 2 {
+		return nil, ErrNotEnoughSamples
+	}
+
+	model := &Model{
+		Version:   opts.Version,
+		Kind:      KindLogisticRegression,
+		TrainedAt: time.Now(),
+		Samples:   len(train),
+		Features:  append([]string(nil), Features...),
+		Means:     make([]float64, len(Features)),
+		Stds:      make([]float64, len(Features)),
+		Weights:   make([]float64, len(Features)),
+	}
+	model.fitScaling(train)
+
+	// Standardized design matrix; missing features are the mean (0)
+	x := make([][]float64, len(train))
+	for i, sample := range train {
+		x[i] = make([]float64, len(Features))
+		for j, name := range Features {
+			if value, ok := sample.Features[name]; ok {
+				x[i][j] = model.standardize(j, value)
+			}
+		}
+	}
+
+	n := float64(len(train))
+	for epoch := 0; epoch < opts.Epochs; epoch++ {
+		gradients := make([]float64, len(Features))
+		biasGradient := 0.0
+
+		for i, sample := range train {
+			z := model.Bias
+			for j := range Features {
+				z += model.Weights[j] * x[i][j]
+			}
+			diff := sigmoid(z) - float64(sample.Label)
+			for j := range Features {
+				gradients[j] += diff * x[i][j]
+			}
+			biasGradient += diff
+		}
+
+		for j := range Features {
+			model.Weights[j] -= opts.LearningRate * (gradients[j]/n + opts.L2*model.Weights[j])
+		}
+		model.Bias -= opts.LearningRate * biasGradient / n
+	}
+
+	if len(test) > 0 {
+		metrics := Evaluate(model, test)
+		model.Metrics = &metrics
+	}
+
+	return model, nil
+}
+
+// fitScaling sets the mean and standard deviation of each feature
+func (m *Model) fitScaling(samples []Sample) {
+	for j, name := range m.Features {
+		var values []float64
+		for _, sample := range samples {
+			if value, ok := sample.Features[name]; ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		mean := 0.0
+		for _, value := range values {
+			mean += value
+		}
+		mean /= float64(len(values))
+
+		variance := 0.0
+		for _, value := range values {
+			variance += (value - mean) * (value - mean)
+		}
+		m.Means[j] = mean
+		m.Stds[j] = math.Sqrt(variance / float64(len(values)))
+	}
+}
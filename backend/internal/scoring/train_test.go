@@ -0,0 +1,85 @@
+package scoring
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// separableSamples labels submissions pasting most of their code
+func separableSamples(count int) []Sample {
+	samples := make([]Sample, count)
+	for i := range samples {
+		label := i % 2
+		samples[i] = Sample{
+			SubmissionID: uint(i + 1),
+			Label:        label,
+			Features: map[string]float64{
+				"pasteCharRatio":  0.1 + 0.7*float64(label) + 0.01*float64(i%5),
+				"totalKeystrokes": 500 - 400*float64(label) + float64(i%7),
+			},
+		}
+	}
+	return samples
+}
+
+func TestTrainSeparatesTheClasses(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Version = "test"
+
+	model, err := Train(separableSamples(40), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Version != "test" || model.Samples != 32 || model.Metrics == nil {
+		t.Errorf("model %q on %d samples, metrics %v; want 32 training samples and holdout metrics", model.Version, model.Samples, model.Metrics)
+	}
+
+	pasted := model.Predict(map[string]float64{"pasteCharRatio": 0.85, "totalKeystrokes": 100})
+	typed := model.Predict(map[string]float64{"pasteCharRatio": 0.1, "totalKeystrokes": 500})
+	if pasted < 0.9 || typed > 0.1 {
+		t.Errorf("predicted %v for pasted code and %v for typed code", pasted, typed)
+	}
+}
+
+func TestTrainIsReproducible(t *testing.T) {
+	first, _ := Train(separableSamples(40), DefaultOptions())
+	second, _ := Train(separableSamples(40), DefaultOptions())
+
+	for i := range first.Weights {
+		if first.Weights[i] != second.Weights[i] {
+			t.Fatalf("weight %s differs between runs with the same seed", first.Features[i])
+		}
+	}
+}
+
+func TestTrainNeedsBothClasses(t *testing.T) {
+	samples := separableSamples(40)
+	for i := range samples {
+		samples[i].Label = 0
+	}
+
+	if _, err := Train(samples, DefaultOptions()); !errors.Is(err, ErrNotEnoughSamples) {
+		t.Errorf("err = %v, want ErrNotEnoughSamples", err)
+	}
+}
+
+func TestContributionsExplainThePrediction(t *testing.T) {
+	model, err := Train(separableSamples(40), DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	features := map[string]float64{"pasteCharRatio": 0.85, "totalKeystrokes": 100}
+	z := model.Bias
+	for _, contribution := range model.Contributions(features) {
+		z += contribution.Contribution
+	}
+
+	if got, want := sigmoid(z), model.Predict(features); math.Abs(got-want) > 1e-12 {
+		t.Errorf("bias plus contributions gives %v, want the prediction %v", got, want)
+	}
+	if len(model.Contributions(map[string]float64{})) != 0 {
+		t.Error("missing features contributed")
+	}
+}
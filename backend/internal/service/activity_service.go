@@ -3,16 +3,46 @@ package service
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
 
 	"dalivim/internal/models"
 	"dalivim/internal/repository"
 )
 
+var (
+	ErrActivityClosed      = errors.New("activity is closed")
+	ErrUnknownStudentToken = errors.New("unknown student token")
+)
+
 type ActivityService interface {
-	Create(professorID uint, title, description, language string, timeLimit int) (*models.Activity, error)
+	Create(professorID uint, title, description, starterCode, language string, timeLimit int, latePolicy string) (*models.Activity, error)
 	GetByID(id uint) (*models.Activity, error)
 	GetByProfessorID(professorID uint) ([]ActivityWithCount, error)
-	JoinActivity(inviteToken string) (*models.Activity, *models.User, error)
+	// JoinActivity opens a session for an anonymous student. A student
+	// token from an earlier join makes it the same student again; without
+	// one a new student is created and its token issued.
+	JoinActivity(inviteToken, studentToken string) (*JoinResult, error)
+	// Close ends an activity and runs the close hooks in the background.
+	// Closing an already closed activity does nothing.
+	Close(id uint) (*models.Activity, error)
+	// OnClose registers a hook run after an activity is closed
+	OnClose(hook func(activity *models.Activity) error)
+}
+
+// JoinResult is returned to a student joining an activity. SessionKey is the
+// secret used to sign telemetry batches and is only ever sent here; StreamAuth
+// is derived from it and opens the session's telemetry stream. StudentToken
+// is only set when a new student was created.
+type JoinResult struct {
+	Activity     *models.Activity `json:"activity"`
+	Student      *models.User     `json:"student"`
+	SessionID    uint             `json:"sessionId"`
+	SessionKey   string           `json:"sessionKey"`
+	StreamAuth   string           `json:"streamAuth"`
+	StudentToken string           `json:"studentToken,omitempty"`
 }
 
 type ActivityWithCount struct {
@@ -23,22 +53,37 @@ type ActivityWithCount struct {
 type activityService struct {
 	activityRepo repository.ActivityRepository
 	userRepo     repository.UserRepository
+	sessionRepo  repository.SessionRepository
+
+	mu         sync.RWMutex
+	closeHooks []func(activity *models.Activity) error
 }
 
-func NewActivityService(activityRepo repository.ActivityRepository, userRepo repository.UserRepository) ActivityService {
+func NewActivityService(
+	activityRepo repository.ActivityRepository,
+	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+) ActivityService {
 	return &activityService{
 		activityRepo: activityRepo,
 		userRepo:     userRepo,
+		sessionRepo:  sessionRepo,
 	}
 }
 
-func (s *activityService) Create(professorID uint, title, description, language string, timeLimit int) (*models.Activity, error) {
+func (s *activityService) Create(professorID uint, title, description, starterCode, language string, timeLimit int, latePolicy string) (*models.Activity, error) {
+	if latePolicy == "" {
+		latePolicy = LatePolicyFlag
+	}
+
 	activity := &models.Activity{
 		ProfessorID: professorID,
 		Title:       title,
 		Description: description,
+		StarterCode: starterCode,
 		Language:    language,
 		TimeLimit:   timeLimit,
+		LatePolicy:  latePolicy,
 		InviteToken: generateInviteToken(),
 	}
 
@@ -71,24 +116,105 @@ func (s *activityService) GetByProfessorID(professorID uint) ([]ActivityWithCoun
 	return result, nil
 }
 
-func (s *activityService) JoinActivity(inviteToken string) (*models.Activity, *models.User, error) {
+func (s *activityService) JoinActivity(inviteToken, studentToken string) (*JoinResult, error) {
 	activity, err := s.activityRepo.FindByInviteToken(inviteToken)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	if activity.ClosedAt != nil {
+		return nil, ErrActivityClosed
+	}
+
+	// Returning students keep their identity, so their baseline, typing
+	// profile and past style follow them across activities
+	student, issuedToken, err := s.resolveStudent(studentToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Issue the telemetry session and its signing key
+	session := &models.TelemetrySession{
+		ActivityID: activity.ID,
+		StudentID:  student.ID,
+		SessionKey: generateSessionKey(),
 	}
 
-	// Create anonymous student
+	if err := s.sessionRepo.Create(session); err != nil {
+		return nil, err
+	}
+
+	return &JoinResult{
+		Activity:     activity,
+		Student:      student,
+		SessionID:    session.ID,
+		SessionKey:   session.SessionKey,
+		StreamAuth:   StreamAuth(session.SessionKey, session.ID),
+		StudentToken: issuedToken,
+	}, nil
+}
+
+// resolveStudent finds the student a token was issued to, or creates an
+// anonymous student and returns its new token
+func (s *activityService) resolveStudent(studentToken string) (*models.User, string, error) {
+	if studentToken != "" {
+		student, err := s.userRepo.FindByStudentTokenHash(sha256Hex([]byte(studentToken)))
+		if err != nil || student.Role != "student" {
+			return nil, "", ErrUnknownStudentToken
+		}
+		return student, "", nil
+	}
+
+	token := generateSessionKey()
+	hash := sha256Hex([]byte(token))
 	student := &models.User{
-		Email: generateAnonymousEmail(),
-		Name:  "Anonymous Student",
-		Role:  "student",
+		Email:            generateAnonymousEmail(),
+		Name:             "Anonymous Student",
+		Role:             "student",
+		StudentTokenHash: &hash,
 	}
 
 	if err := s.userRepo.Create(student); err != nil {
-		return nil, nil, err
+		return nil, "", err
+	}
+	return student, token, nil
+}
+
+func (s *activityService) Close(id uint) (*models.Activity, error) {
+	activity, err := s.activityRepo.FindByID(id)
+	if err != nil {
+		return nil, err
 	}
+	if activity.ClosedAt != nil {
+		return activity, nil
+	}
+
+	now := time.Now()
+	activity.ClosedAt = &now
+	if err := s.activityRepo.Update(activity); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	hooks := append([]func(*models.Activity) error(nil), s.closeHooks...)
+	s.mu.RUnlock()
 
-	return activity, student, nil
+	closed := *activity
+	go func() {
+		for _, hook := range hooks {
+			if err := hook(&closed); err != nil {
+				log.Printf("close hook of activity %d: %v", closed.ID, err)
+			}
+		}
+	}()
+
+	return activity, nil
+}
+
+func (s *activityService) OnClose(hook func(activity *models.Activity) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeHooks = append(s.closeHooks, hook)
 }
 
 func generateInviteToken() string {
@@ -97,6 +223,12 @@ func generateInviteToken() string {
 	return hex.EncodeToString(bytes)
 }
 
+func generateSessionKey() string {
+	bytes := make([]byte, 32)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
 func generateAnonymousEmail() string {
 	bytes := make([]byte, 8)
 	rand.Read(bytes)
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+type joinActivityRepo struct {
+	repository.ActivityRepository
+}
+
+func (joinActivityRepo) FindByInviteToken(token string) (*models.Activity, error) {
+	return &models.Activity{ID: 1, InviteToken: token}, nil
+}
+
+type joinUserRepo struct {
+	repository.UserRepository
+	users []models.User
+}
+
+func (r *joinUserRepo) Create(user *models.User) error {
+	user.ID = uint(len(r.users) + 1)
+	r.users = append(r.users, *user)
+	return nil
+}
+
+func (r *joinUserRepo) FindByStudentTokenHash(hash string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.StudentTokenHash != nil && *user.StudentTokenHash == hash {
+			return &user, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+type joinSessionRepo struct {
+	repository.SessionRepository
+	created int
+}
+
+func (r *joinSessionRepo) Create(session *models.TelemetrySession) error {
+	r.created++
+	session.ID = uint(r.created)
+	return nil
+}
+
+func TestJoinWithStudentTokenKeepsTheStudent(t *testing.T) {
+	userRepo := &joinUserRepo{}
+	service := NewActivityService(joinActivityRepo{}, userRepo, &joinSessionRepo{})
+
+	first, err := service.JoinActivity("invite", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.StudentToken == "" {
+		t.Fatal("first join issued no student token")
+	}
+
+	again, err := service.JoinActivity("invite", first.StudentToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Student.ID != first.Student.ID {
+		t.Errorf("student = %d, want %d", again.Student.ID, first.Student.ID)
+	}
+	if again.StudentToken != "" {
+		t.Error("returning join issued another token")
+	}
+	if again.SessionID == first.SessionID {
+		t.Error("returning join reused the session")
+	}
+	if len(userRepo.users) != 1 {
+		t.Errorf("%d students created, want 1", len(userRepo.users))
+	}
+
+	if _, err := service.JoinActivity("invite", "unknown"); !errors.Is(err, ErrUnknownStudentToken) {
+		t.Errorf("err = %v, want ErrUnknownStudentToken", err)
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dalivim/internal/models"
+)
+
+// Aggregators
+const (
+	AggregatorSum      = "sum"      // Sum of detector scores
+	AggregatorWeighted = "weighted" // Sum of detector scores times their weight
+	AggregatorMax      = "max"      // Highest detector score
+)
+
+// Aggregator combines detector results into a suspicion score in [0, 1].
+// Aggregate also sets the contribution of every signal detail to what it
+// added to that score, so the contributions add up to it.
+type Aggregator interface {
+	Name() string
+	Aggregate(results []models.DetectorResult) float64
+}
+
+// NewAggregator builds the named aggregator. Weights are only used by the
+// weighted aggregator; detectors without a weight count fully.
+func NewAggregator(name string, weights map[string]float64) (Aggregator, error) {
+	switch name {
+	case "", AggregatorSum:
+		return weightedAggregator{name: AggregatorSum}, nil
+	case AggregatorWeighted:
+		return weightedAggregator{name: AggregatorWeighted, weights: weights}, nil
+	case AggregatorMax:
+		return maxAggregator{}, nil
+	default:
+		return nil, fmt.Errorf("unknown aggregator %q", name)
+	}
+}
+
+// ParseDetectorWeights parses "detector=weight" pairs separated by commas
+func ParseDetectorWeights(value string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		name, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid detector weight %q", pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid detector weight %q: %w", pair, err)
+		}
+		weights[strings.TrimSpace(name)] = weight
+	}
+	return weights, nil
+}
+
+type weightedAggregator struct {
+	name    string
+	weights map[string]float64
+}
+
+func (a weightedAggregator) Name() string { return a.name }
+
+func (a weightedAggregator) Aggregate(results []models.DetectorResult) float64 {
+	total := 0.0
+	for _, result := range results {
+		total += result.Score * a.weight(result.Detector)
+	}
+	score := clamp01(total)
+
+	// Clamping shrinks every contribution alike
+	scale := 1.0
+	if total != score {
+		scale = score / total
+	}
+	for i := range results {
+		distributeScore(&results[i], results[i].Score*a.weight(results[i].Detector)*scale)
+	}
+	return score
+}
+
+func (a weightedAggregator) weight(detector string) float64 {
+	if weight, ok := a.weights[detector]; ok {
+		return weight
+	}
+	return 1
+}
+
+type maxAggregator struct{}
+
+func (maxAggregator) Name() string { return AggregatorMax }
+
+// Aggregate credits the whole score to the highest scoring detector
+func (maxAggregator) Aggregate(results []models.DetectorResult) float64 {
+	score := 0.0
+	winner := -1
+	for i, result := range results {
+		if result.Score > score {
+			score = result.Score
+			winner = i
+		}
+	}
+	score = clamp01(score)
+
+	for i := range results {
+		if i == winner {
+			distributeScore(&results[i], score)
+		} else {
+			distributeScore(&results[i], 0)
+		}
+	}
+	return score
+}
+
+// distributeScore splits what a detector added to the score among its
+// signal details, in proportion to the rule weights they were fired with.
+// Details fired without a weight of their own share it evenly.
+func distributeScore(result *models.DetectorResult, total float64) {
+	if len(result.Details) == 0 {
+		return
+	}
+	weights := 0.0
+	for _, detail := range result.Details {
+		weights += detail.Contribution
+	}
+	for i := range result.Details {
+		if weights != 0 {
+			result.Details[i].Contribution = total * result.Details[i].Contribution / weights
+		} else {
+			result.Details[i].Contribution = total / float64(len(result.Details))
+		}
+	}
+}
+
+func clamp01(value float64) float64 {
+	if value < 0 {
+		return 0
+	}
+	return min(value, 1.0)
+}
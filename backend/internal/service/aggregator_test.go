@@ -0,0 +1,87 @@
+package service
+
+import (
+	"math"
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func detectorResult(name string, contributions ...float64) models.DetectorResult {
+	result := models.DetectorResult{Detector: name}
+	for _, contribution := range contributions {
+		result.Score += contribution
+		result.Details = append(result.Details, models.SignalDetail{Detector: name, Contribution: contribution})
+	}
+	return result
+}
+
+func totalContribution(results []models.DetectorResult) float64 {
+	total := 0.0
+	for _, result := range results {
+		for _, detail := range result.Details {
+			total += detail.Contribution
+		}
+	}
+	return total
+}
+
+func TestContributionsAddUpToScore(t *testing.T) {
+	aggregators := []Aggregator{
+		weightedAggregator{name: AggregatorSum},
+		weightedAggregator{name: AggregatorWeighted, weights: map[string]float64{"paste": 2, "timing": 0.5}},
+		maxAggregator{},
+	}
+	for _, aggregator := range aggregators {
+		results := []models.DetectorResult{
+			detectorResult("paste", 0.4, 0.3),
+			detectorResult("timing", 0.25, -0.1),
+			detectorResult("stylometry", 0.2),
+		}
+		score := aggregator.Aggregate(results)
+		if got := totalContribution(results); math.Abs(got-score) > 1e-9 {
+			t.Errorf("%s: contributions add up to %v, score is %v", aggregator.Name(), got, score)
+		}
+	}
+}
+
+func TestWeightedContributionsScaleWithClamp(t *testing.T) {
+	results := []models.DetectorResult{
+		detectorResult("paste", 0.8),
+		detectorResult("timing", 0.4),
+	}
+	score := weightedAggregator{name: AggregatorSum}.Aggregate(results)
+	if score != 1 {
+		t.Fatalf("score = %v, want 1", score)
+	}
+	if got := results[0].Details[0].Contribution; math.Abs(got-0.8/1.2) > 1e-9 {
+		t.Errorf("paste contribution = %v, want %v", got, 0.8/1.2)
+	}
+}
+
+func TestMaxCreditsOnlyTheWinner(t *testing.T) {
+	results := []models.DetectorResult{
+		detectorResult("paste", 0.3, 0.2),
+		detectorResult("timing", 0.4),
+	}
+	maxAggregator{}.Aggregate(results)
+	if got := results[1].Details[0].Contribution; got != 0 {
+		t.Errorf("timing contribution = %v, want 0", got)
+	}
+	if got := results[0].Details[0].Contribution; math.Abs(got-0.3) > 1e-9 {
+		t.Errorf("paste contribution = %v, want 0.3", got)
+	}
+}
+
+func TestDistributeScoreSplitsUnweightedDetails(t *testing.T) {
+	result := models.DetectorResult{
+		Score:   0.3,
+		Details: []models.SignalDetail{{}, {}, {}},
+	}
+	distributeScore(&result, result.Score)
+	for _, detail := range result.Details {
+		if math.Abs(detail.Contribution-0.1) > 1e-9 {
+			t.Errorf("contribution = %v, want 0.1", detail.Contribution)
+		}
+	}
+}
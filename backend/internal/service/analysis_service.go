@@ -1,94 +1,334 @@
 package service
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+	"dalivim/internal/scoring"
+)
+
+var ErrUnknownRule = errors.New("unknown analysis rule")
+
+// How long resolved rule sets are cached before the database is read again
+const ruleCacheTTL = 30 * time.Second
+
 type AnalysisResult struct {
 	AuthorshipScore float64  `json:"authorship_score"`
-	Confidence      string   `json:"confidence"`
+	Confidence      string   `json:"confidence"` // high, medium, low or insufficient_data
+	ConfidenceScore float64  `json:"confidence_score"`
 	Signals         []string `json:"signals"`
+
+	// SignalDetails explains each signal, including rules that lowered the score
+	SignalDetails []models.SignalDetail `json:"signalDetails"`
+
+	// BaselineDeviation is how far the session is from the student's own
+	// previous submissions, when enough of them exist
+	BaselineDeviation *float64 `json:"baselineDeviation,omitempty"`
+
+	// IdentityConsistency is how well the typing rhythm matches the
+	// student's keystroke profile, from 0 to 1
+	IdentityConsistency *float64 `json:"identityConsistency,omitempty"`
+
+	// Detectors holds the result of each detector
+	Detectors []models.DetectorResult `json:"detectors"`
+
+	// ModelVersion is set when the score comes from a trained model, and
+	// ModelContributions then explain the score feature by feature
+	ModelVersion       string                 `json:"modelVersion,omitempty"`
+	ModelContributions []scoring.Contribution `json:"modelContributions,omitempty"`
+
+	// AnalysisVersion identifies the detectors, scorer and rules that
+	// produced the result
+	AnalysisVersion string `json:"analysisVersion"`
+
+	detectorVersions string
+	scorer           string
+	rulesHash        string
+}
+
+// Evidence returns a measured value reported by a detector
+func (r AnalysisResult) Evidence(detector, key string) (float64, bool) {
+	for _, result := range r.Detectors {
+		if result.Detector == detector {
+			value, ok := result.Evidence[key]
+			return value, ok
+		}
+	}
+	return 0, false
 }
 
 type AnalysisService interface {
-	Analyze(features map[string]interface{}) AnalysisResult
+	Analyze(input AnalysisInput) AnalysisResult
+	// GetRules returns the effective rules of an activity: defaults, then
+	// global overrides, then the activity's own overrides
+	GetRules(activityID uint) (rules.Set, error)
+	// SetActivityRules replaces the overrides of an activity
+	SetActivityRules(activityID uint, overrides map[string]rules.Override) error
+	// GetGlobalRules returns the rules of activities without overrides
+	GetGlobalRules() (rules.Set, error)
+	// SetGlobalRules replaces the global overrides. Only professors may.
+	SetGlobalRules(professorID uint, overrides map[string]rules.Override) error
+}
+
+type cachedRules struct {
+	set      rules.Set
+	loadedAt time.Time
 }
 
-type analysisService struct{}
+type analysisService struct {
+	ruleRepo   repository.RuleRepository
+	userRepo   repository.UserRepository
+	defaults   rules.Set
+	registry   *DetectorRegistry
+	aggregator Aggregator
+	model      *scoring.Model // Replaces the aggregator when set
+
+	mu    sync.Mutex
+	cache map[uint]cachedRules
+}
 
-func NewAnalysisService() AnalysisService {
-	return &analysisService{}
+func NewAnalysisService(
+	ruleRepo repository.RuleRepository,
+	userRepo repository.UserRepository,
+	defaults rules.Set,
+	registry *DetectorRegistry,
+	aggregator Aggregator,
+	model *scoring.Model,
+) AnalysisService {
+	return &analysisService{
+		ruleRepo:   ruleRepo,
+		userRepo:   userRepo,
+		defaults:   defaults,
+		registry:   registry,
+		aggregator: aggregator,
+		model:      model,
+		cache:      make(map[uint]cachedRules),
+	}
 }
 
-func (s *analysisService) Analyze(features map[string]interface{}) AnalysisResult {
+func (s *analysisService) Analyze(input AnalysisInput) AnalysisResult {
+	set, err := s.GetRules(input.ActivityID)
+	if err != nil {
+		set = s.defaults
+	}
+	input.Rules = set
+
+	// Run every registered detector
 	signals := []string{}
-	suspicionScore := 0.0
+	results := []models.DetectorResult{}
+	for _, detector := range s.registry.Detectors() {
+		result := detector.Detect(input)
+		signals = append(signals, result.Signals...)
+		results = append(results, result)
+	}
+
+	// Calculate authorship score. A trained model scores from the features;
+	// detectors still provide the signals, but not the score, so their
+	// details are only informational.
+	var authorshipScore float64
+	var modelVersion, scorer string
+	var contributions []scoring.Contribution
+	if s.model != nil {
+		features := numericFeatures(input.Features)
+		authorshipScore = 1.0 - s.model.Predict(features)
+		contributions = s.model.Contributions(features)
+		modelVersion = s.model.Version
+		scorer = "model:" + modelVersion
+		for i := range results {
+			for j := range results[i].Details {
+				results[i].Details[j].Informational = true
+			}
+		}
+	} else {
+		authorshipScore = 1.0 - s.aggregator.Aggregate(results)
+		scorer = s.aggregator.Name()
+	}
+
+	// Collected after aggregation, which sets their contributions
+	details := []models.SignalDetail{}
+	for _, result := range results {
+		details = append(details, result.Details...)
+	}
+
+	// Determine confidence from the amount of evidence and detector agreement
+	confidenceScore, confidence := calibrateConfidence(input.Features, results, authorshipScore)
+
+	analysis := AnalysisResult{
+		AuthorshipScore: authorshipScore,
+		Confidence:      confidence,
+		ConfidenceScore: confidenceScore,
+		Signals:         signals,
+		SignalDetails:   details,
+		Detectors:       results,
+		ModelVersion:    modelVersion,
+
+		ModelContributions: contributions,
+	}
+	analysis.stampVersion(results, scorer, set)
+	if deviation, ok := analysis.Evidence(BaselineDetectorName, "deviation"); ok {
+		analysis.BaselineDeviation = &deviation
+	}
+	if consistency, ok := analysis.Evidence(IdentityDetectorName, "consistency"); ok {
+		analysis.IdentityConsistency = &consistency
+	}
+
+	return analysis
+}
+
+func (s *analysisService) GetRules(activityID uint) (rules.Set, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[activityID]
+	s.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < ruleCacheTTL {
+		return cached.set, nil
+	}
+
+	stored, err := s.ruleRepo.FindForActivity(activityID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Global rows come first so activity rows override them
+	set := s.defaults.Merge(nil)
+	for _, scope := range []bool{false, true} {
+		for _, rule := range stored {
+			if (rule.ActivityID != nil) == scope {
+				set[rule.Name] = storedOverride(rule).Apply(set[rule.Name])
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[activityID] = cachedRules{set: set, loadedAt: time.Now()}
+	s.mu.Unlock()
 
-	// Paste ratio check
-	pasteRatio := getFloat(features, "pasteCharRatio")
-	if pasteRatio > 0.6 {
-		signals = append(signals, "high_paste_ratio")
-		suspicionScore += 0.3
-	} else if pasteRatio > 0.3 {
-		signals = append(signals, "moderate_paste_ratio")
-		suspicionScore += 0.15
+	return set, nil
+}
+
+func (s *analysisService) SetActivityRules(activityID uint, overrides map[string]rules.Override) error {
+	stored, err := s.storedRules(&activityID, overrides)
+	if err != nil {
+		return err
 	}
 
-	// Delete ratio check
-	deleteRatio := getFloat(features, "deleteRatio")
-	if deleteRatio < 0.02 {
-		signals = append(signals, "low_edit_ratio")
-		suspicionScore += 0.25
+	if err := s.ruleRepo.ReplaceForActivity(activityID, stored); err != nil {
+		return err
 	}
 
-	// Linear editing check
-	linearScore := getFloat(features, "linearEditingScore")
-	if linearScore > 0.9 {
-		signals = append(signals, "highly_linear_editing")
-		suspicionScore += 0.2
+	s.mu.Lock()
+	delete(s.cache, activityID)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// GetGlobalRules reads the rules without activity overrides; activity IDs
+// start at 1
+func (s *analysisService) GetGlobalRules() (rules.Set, error) {
+	return s.GetRules(0)
+}
+
+func (s *analysisService) SetGlobalRules(professorID uint, overrides map[string]rules.Override) error {
+	user, err := s.userRepo.FindByID(professorID)
+	if err != nil || user.Role != "professor" {
+		return ErrNotProfessor
 	}
 
-	// Paste events check
-	pasteEvents := getInt(features, "pasteEvents")
-	if pasteEvents > 3 {
-		signals = append(signals, "multiple_paste_events")
-		suspicionScore += 0.15
+	stored, err := s.storedRules(nil, overrides)
+	if err != nil {
+		return err
 	}
 
-	// Fast completion check
-	execCount := getInt(features, "executionCount")
-	totalTime := getFloat(features, "totalTime")
-	if execCount == 0 && totalTime < 120 {
-		signals = append(signals, "fast_completion_no_testing")
-		suspicionScore += 0.2
+	if err := s.ruleRepo.ReplaceGlobal(stored); err != nil {
+		return err
 	}
 
-	// Focus loss check
-	focusLoss := getInt(features, "focusLossCount")
-	if focusLoss > 5 {
-		signals = append(signals, "frequent_focus_loss")
-		suspicionScore += 0.1
+	// Every activity inherits the global rules
+	s.mu.Lock()
+	s.cache = make(map[uint]cachedRules)
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *analysisService) storedRules(activityID *uint, overrides map[string]rules.Override) ([]models.AnalysisRule, error) {
+	stored := make([]models.AnalysisRule, 0, len(overrides))
+	for name, override := range overrides {
+		if _, ok := s.defaults[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRule, name)
+		}
+		stored = append(stored, models.AnalysisRule{
+			ActivityID: activityID,
+			Name:       name,
+			Enabled:    override.Enabled,
+			Threshold:  override.Threshold,
+			Weight:     override.Weight,
+		})
 	}
+	return stored, nil
+}
 
-	// Keystroke variance check
-	burstiness := getFloat(features, "burstiness")
-	if burstiness < 0.3 {
-		signals = append(signals, "low_typing_variance")
-		suspicionScore += 0.15
+func storedOverride(rule models.AnalysisRule) rules.Override {
+	return rules.Override{Enabled: rule.Enabled, Threshold: rule.Threshold, Weight: rule.Weight}
+}
+
+// stampVersion records what produced the result. The analysis version is a
+// short hash of the detector versions, the scorer and the rules.
+func (r *AnalysisResult) stampVersion(results []models.DetectorResult, scorer string, set rules.Set) {
+	versions := make([]string, len(results))
+	for i, result := range results {
+		versions[i] = result.Detector + "@" + result.Version
 	}
+	r.detectorVersions = strings.Join(versions, ",")
+	r.scorer = scorer
 
-	// Calculate authorship score
-	authorshipScore := 1.0 - min(suspicionScore, 1.0)
+	// Maps are marshaled with sorted keys, so equal sets hash equally
+	rulesJSON, _ := json.Marshal(set)
+	r.rulesHash = shortHash(string(rulesJSON))
+	r.AnalysisVersion = shortHash(r.detectorVersions + "|" + r.scorer + "|" + r.rulesHash)
+}
 
-	// Determine confidence
-	confidence := "low"
-	if len(signals) >= 4 {
-		confidence = "high"
-	} else if len(signals) >= 2 {
-		confidence = "medium"
+// newAnalysisRun records an analysis of a submission
+func newAnalysisRun(submission *models.Submission, analysis AnalysisResult, trigger string) *models.AnalysisRun {
+	return &models.AnalysisRun{
+		SubmissionID:     submission.ID,
+		ActivityID:       submission.ActivityID,
+		Trigger:          trigger,
+		AnalysisVersion:  analysis.AnalysisVersion,
+		DetectorVersions: analysis.detectorVersions,
+		Scorer:           analysis.scorer,
+		RulesHash:        analysis.rulesHash,
+		AuthorshipScore:  analysis.AuthorshipScore,
+		Confidence:       analysis.Confidence,
+		ConfidenceScore:  analysis.ConfidenceScore,
+		SignalsArray:     analysis.Signals,
+		DetectorArray:    analysis.Detectors,
 	}
+}
 
-	return AnalysisResult{
-		AuthorshipScore: authorshipScore,
-		Confidence:      confidence,
-		Signals:         signals,
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:6])
+}
+
+// numericFeatures keeps the numeric telemetry features
+func numericFeatures(features map[string]interface{}) map[string]float64 {
+	numeric := make(map[string]float64, len(features))
+	for name, value := range features {
+		if f, ok := value.(float64); ok {
+			numeric[name] = f
+		}
 	}
+	return numeric
 }
 
 func getFloat(m map[string]interface{}, key string) float64 {
@@ -100,6 +340,14 @@ func getFloat(m map[string]interface{}, key string) float64 {
 	return 0.0
 }
 
+// getOptionalFloat is nil when the feature is missing
+func getOptionalFloat(m map[string]interface{}, key string) *float64 {
+	if f, ok := m[key].(float64); ok {
+		return &f
+	}
+	return nil
+}
+
 func getInt(m map[string]interface{}, key string) int {
 	if v, ok := m[key]; ok {
 		if f, ok := v.(float64); ok {
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+	"dalivim/internal/scoring"
+)
+
+type fakeRuleRepo struct {
+	repository.RuleRepository
+	stored []models.AnalysisRule
+}
+
+func (r *fakeRuleRepo) FindForActivity(activityID uint) ([]models.AnalysisRule, error) {
+	var found []models.AnalysisRule
+	for _, rule := range r.stored {
+		if rule.ActivityID == nil || *rule.ActivityID == activityID {
+			found = append(found, rule)
+		}
+	}
+	return found, nil
+}
+
+func (r *fakeRuleRepo) ReplaceForActivity(activityID uint, stored []models.AnalysisRule) error {
+	kept := []models.AnalysisRule{}
+	for _, rule := range r.stored {
+		if rule.ActivityID == nil || *rule.ActivityID != activityID {
+			kept = append(kept, rule)
+		}
+	}
+	r.stored = append(kept, stored...)
+	return nil
+}
+
+func TestActivityOverrideKeepsOmittedFields(t *testing.T) {
+	disabled := false
+	globalWeight := 0.5
+	ruleRepo := &fakeRuleRepo{stored: []models.AnalysisRule{
+		{Name: rules.FastCompletion, Weight: &globalWeight},
+		{Name: rules.FrequentFocusLoss, Enabled: &disabled},
+	}}
+	service := NewAnalysisService(ruleRepo, nil, rules.Defaults(), NewDetectorRegistry(), weightedAggregator{name: AggregatorSum}, nil)
+
+	threshold := 300.0
+	err := service.SetActivityRules(1, map[string]rules.Override{
+		rules.FastCompletion: {Threshold: &threshold},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set, err := service.GetRules(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule := set.Get(rules.FastCompletion); !rule.Enabled || rule.Threshold != 300 || rule.Weight != 0.5 {
+		t.Errorf("%s = %+v, want enabled, threshold 300 and the global weight", rules.FastCompletion, rule)
+	}
+	if set.Get(rules.FrequentFocusLoss).Enabled {
+		t.Errorf("%s enabled, want the global override", rules.FrequentFocusLoss)
+	}
+
+	if err := service.SetActivityRules(1, map[string]rules.Override{"no_such_rule": {}}); err == nil {
+		t.Error("unknown rule accepted")
+	}
+}
+
+func TestModelScoreReportsFeatureContributions(t *testing.T) {
+	registry := NewDetectorRegistry()
+	for _, detector := range DefaultDetectors() {
+		if err := registry.Register(detector); err != nil {
+			t.Fatal(err)
+		}
+	}
+	model := &scoring.Model{
+		Version:  "test",
+		Kind:     scoring.KindLogisticRegression,
+		Features: []string{"pasteCharRatio", "totalKeystrokes"},
+		Means:    []float64{0.2, 400},
+		Stds:     []float64{0.2, 100},
+		Weights:  []float64{2, -1},
+	}
+	service := NewAnalysisService(&fakeRuleRepo{}, nil, rules.Defaults(), registry, weightedAggregator{name: AggregatorSum}, model)
+
+	analysis := service.Analyze(AnalysisInput{
+		ActivityID: 1,
+		IsFinal:    true,
+		Features:   map[string]interface{}{"pasteCharRatio": 0.8, "totalKeystrokes": 100.0, "pasteEvents": 3.0},
+	})
+
+	if len(analysis.ModelContributions) != 2 || analysis.ModelContributions[0].Feature != "pasteCharRatio" {
+		t.Fatalf("contributions = %+v, want pasteCharRatio first", analysis.ModelContributions)
+	}
+	if !almostEqual(analysis.ModelContributions[0].Contribution, 6) {
+		t.Errorf("pasteCharRatio contributed %v, want weight 2 times 3 standard deviations", analysis.ModelContributions[0].Contribution)
+	}
+	if len(analysis.SignalDetails) == 0 {
+		t.Fatal("no rule fired on a mostly pasted submission")
+	}
+	for _, detail := range analysis.SignalDetails {
+		if !detail.Informational {
+			t.Errorf("%s is not marked informational under a model", detail.Signal)
+		}
+	}
+}
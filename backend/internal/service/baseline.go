@@ -0,0 +1,105 @@
+package service
+
+import (
+	"math"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+// BaselineDetectorName names the per-student baseline detector
+const BaselineDetectorName = "baseline"
+
+// Features tracked in student baselines
+var baselineFeatures = []string{
+	"avgKeystrokeInterval",
+	"stdKeystrokeInterval",
+	"burstiness",
+	"deleteRatio",
+	"linearEditingScore",
+	"pasteCharRatio",
+	"pasteEvents",
+}
+
+// A baseline is only compared against once it has this many submissions
+const minBaselineSubmissions = 3
+
+// baselineDetector scores how far a session is from the student's own
+// previous submissions, so a student who always types in bursts is not
+// penalized for it
+type baselineDetector struct {
+	baselineRepo repository.BaselineRepository
+}
+
+func NewBaselineDetector(baselineRepo repository.BaselineRepository) Detector {
+	return &baselineDetector{baselineRepo: baselineRepo}
+}
+
+func (d *baselineDetector) Name() string     { return BaselineDetectorName }
+func (d *baselineDetector) Version() string  { return "1" }
+func (d *baselineDetector) Inputs() []string { return baselineFeatures }
+
+func (d *baselineDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	baseline, err := d.baselineRepo.FindByStudentID(input.StudentID)
+	if err != nil || baseline.SubmissionCount < minBaselineSubmissions {
+		result.Skipped = true
+		return result
+	}
+
+	// Root mean square of the per-feature z-scores
+	sumSquares, compared := 0.0, 0
+	for _, feature := range baselineFeatures {
+		if _, ok := input.Features[feature]; !ok {
+			continue
+		}
+		stats, ok := baseline.Features[feature]
+		if !ok || stats.Count < minBaselineSubmissions {
+			continue
+		}
+
+		z := (getFloat(input.Features, feature) - stats.Mean) / baselineScale(stats)
+		result.Evidence[feature+"Z"] = z
+		sumSquares += z * z
+		compared++
+	}
+
+	if compared == 0 {
+		result.Skipped = true
+		return result
+	}
+
+	deviation := math.Sqrt(sumSquares / float64(compared))
+	result.Evidence["deviation"] = deviation
+	result.Evidence["baselineSubmissions"] = float64(baseline.SubmissionCount)
+
+	set := input.Rules
+	if deviation > set.Get(rules.BaselineDeviation).Threshold {
+		fireRule(&result, set, rules.BaselineDeviation, deviation, nil)
+	} else if deviation < set.Get(rules.ConsistentBaseline).Threshold {
+		fireRule(&result, set, rules.ConsistentBaseline, deviation, nil)
+	}
+
+	return result
+}
+
+// baselineScale keeps near-constant features from producing huge z-scores
+func baselineScale(stats models.FeatureStats) float64 {
+	return math.Max(stats.Std(), math.Max(0.1*math.Abs(stats.Mean), 0.01))
+}
+
+// addToBaseline adds the features of a final submission to the student's
+// baseline
+func addToBaseline(baseline *models.StudentBaseline, features map[string]interface{}) {
+	for _, feature := range baselineFeatures {
+		if _, ok := features[feature]; !ok {
+			continue
+		}
+		stats := baseline.Features[feature]
+		stats.Add(getFloat(features, feature))
+		baseline.Features[feature] = stats
+	}
+	baseline.SubmissionCount++
+}
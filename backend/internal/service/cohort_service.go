@@ -0,0 +1,286 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+// CohortDetectorName names the detector result added by the cohort pass
+const CohortDetectorName = "cohort"
+
+// Robust z-scores need a cohort of at least this many submissions
+const minCohortSize = 5
+
+var ErrCohortTooSmall = errors.New("not enough submissions for a cohort analysis")
+
+// cohortFeature is a submission feature compared across the cohort.
+// direction is 1 when high values are suspicious, -1 when low values are,
+// and 0 when both are. value reports false when the submission lacks the
+// feature, which then stays out of the comparison.
+type cohortFeature struct {
+	name      string
+	direction int
+	value     func(s *models.Submission) (float64, bool)
+}
+
+var cohortFeatures = []cohortFeature{
+	{"avgKeystrokeInterval", 0, func(s *models.Submission) (float64, bool) { return s.AvgKeystrokeInterval, true }},
+	{"burstiness", -1, func(s *models.Submission) (float64, bool) { return s.Burstiness, true }},
+	{"deleteRatio", -1, func(s *models.Submission) (float64, bool) { return s.DeleteRatio, true }},
+	{"linearEditingScore", 1, func(s *models.Submission) (float64, bool) { return s.LinearEditingScore, true }},
+	{"pasteCharRatio", 1, func(s *models.Submission) (float64, bool) { return s.PasteCharRatio, true }},
+	{"pasteEvents", 1, func(s *models.Submission) (float64, bool) { return float64(s.PasteEvents), true }},
+	{"focusLossCount", 1, func(s *models.Submission) (float64, bool) { return float64(s.FocusLossCount), true }},
+	{"totalTime", -1, func(s *models.Submission) (float64, bool) { return s.TotalTime, true }},
+	{"executionCount", -1, func(s *models.Submission) (float64, bool) { return float64(s.ExecutionCount), true }},
+	{"nonLinearNavigationRatio", -1, optionalFeature(func(s *models.Submission) *float64 { return s.NonLinearNavigation })},
+	{"undoFrequency", -1, optionalFeature(func(s *models.Submission) *float64 { return s.UndoFrequency })},
+}
+
+func optionalFeature(field func(s *models.Submission) *float64) func(s *models.Submission) (float64, bool) {
+	return func(s *models.Submission) (float64, bool) {
+		if value := field(s); value != nil {
+			return *value, true
+		}
+		return 0, false
+	}
+}
+
+// FeatureDistribution summarizes one feature across the cohort
+type FeatureDistribution struct {
+	Median float64 `json:"median"`
+	MAD    float64 `json:"mad"`    // Median absolute deviation
+	MeanAD float64 `json:"meanAd"` // Mean absolute deviation from the median
+}
+
+// CohortReport is the result of a cohort pass over an activity
+type CohortReport struct {
+	ActivityID uint                           `json:"activityId"`
+	CohortSize int                            `json:"cohortSize"`
+	Features   map[string]FeatureDistribution `json:"features"`
+	Outliers   int                            `json:"outliers"` // Submissions with at least one outlier feature
+	AnalyzedAt time.Time                      `json:"analyzedAt"`
+}
+
+type CohortService interface {
+	// AnalyzeActivity compares every submission of an activity with the
+	// others, storing outlier signals and cohort percentiles on them
+	AnalyzeActivity(activityID uint) (*CohortReport, error)
+}
+
+type cohortService struct {
+	submissionRepo  repository.SubmissionRepository
+	analysisService AnalysisService
+}
+
+func NewCohortService(
+	submissionRepo repository.SubmissionRepository,
+	analysisService AnalysisService,
+) CohortService {
+	return &cohortService{
+		submissionRepo:  submissionRepo,
+		analysisService: analysisService,
+	}
+}
+
+func (s *cohortService) AnalyzeActivity(activityID uint) (*CohortReport, error) {
+	found, err := s.submissionRepo.FindByActivityID(activityID)
+	if err != nil {
+		return nil, err
+	}
+	// Submissions still waiting for their analysis have no score to compare
+	submissions := make([]models.Submission, 0, len(found))
+	for _, submission := range found {
+		if !submission.AnalysisPending {
+			submissions = append(submissions, submission)
+		}
+	}
+	if len(submissions) < minCohortSize {
+		return nil, ErrCohortTooSmall
+	}
+
+	set, err := s.analysisService.GetRules(activityID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CohortReport{
+		ActivityID: activityID,
+		CohortSize: len(submissions),
+		Features:   map[string]FeatureDistribution{},
+		AnalyzedAt: time.Now(),
+	}
+
+	values := make(map[string][]float64, len(cohortFeatures))
+	present := make(map[string][]bool, len(cohortFeatures))
+	for _, feature := range cohortFeatures {
+		column := make([]float64, len(submissions))
+		has := make([]bool, len(submissions))
+		known := []float64{}
+		for i := range submissions {
+			column[i], has[i] = feature.value(&submissions[i])
+			if has[i] {
+				known = append(known, column[i])
+			}
+		}
+		values[feature.name] = column
+		present[feature.name] = has
+		if len(known) > 0 {
+			report.Features[feature.name] = distribution(known)
+		}
+	}
+
+	suspicion := make([]float64, len(submissions))
+	for i := range submissions {
+		suspicion[i] = 1 - submissions[i].AuthorshipScore
+	}
+
+	for i := range submissions {
+		submission := &submissions[i]
+
+		result := models.DetectorResult{
+			Detector: CohortDetectorName,
+			Version:  "1",
+			Signals:  []string{},
+			Evidence: map[string]float64{},
+			Details:  []models.SignalDetail{},
+		}
+
+		rule := set.Get(rules.CohortOutlier)
+		for _, feature := range cohortFeatures {
+			if !present[feature.name][i] {
+				continue
+			}
+			z := robustZ(values[feature.name][i], report.Features[feature.name])
+			result.Evidence[feature.name+"Z"] = z
+
+			if !rule.Enabled || !suspiciousZ(z, feature.direction, rule.Threshold) {
+				continue
+			}
+			if len(result.Signals) == 0 {
+				result.Signals = append(result.Signals, rules.CohortOutlier)
+				result.Score += rule.Weight
+			}
+			result.Details = append(result.Details, models.SignalDetail{
+				Signal:      rules.CohortOutlier,
+				Detector:    CohortDetectorName,
+				Value:       z,
+				Threshold:   rule.Threshold,
+				Explanation: explainCohortOutlier(feature.name, z, rule.Threshold),
+			})
+		}
+		if len(result.Signals) > 0 {
+			report.Outliers++
+		}
+		// The rule weight is shared by every outlier feature
+		distributeScore(&result, result.Score)
+
+		percentile := percentileRank(suspicion, suspicion[i])
+		submission.CohortPercentile = &percentile
+		submission.CohortAnalyzedAt = &report.AnalyzedAt
+
+		// Replace the result of a previous pass
+		replaceCohortResult(submission, result)
+	}
+
+	if err := s.submissionRepo.UpdateCohort(submissions); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// replaceCohortResult swaps the cohort detector result and signal of a
+// submission. The authorship score is left as computed at submission time.
+func replaceCohortResult(submission *models.Submission, result models.DetectorResult) {
+	detectors := []models.DetectorResult{}
+	for _, existing := range submission.DetectorArray {
+		if existing.Detector != CohortDetectorName {
+			detectors = append(detectors, existing)
+		}
+	}
+	submission.DetectorArray = append(detectors, result)
+
+	signals := []string{}
+	for _, signal := range submission.SignalsArray {
+		if signal != rules.CohortOutlier {
+			signals = append(signals, signal)
+		}
+	}
+	submission.SignalsArray = append(signals, result.Signals...)
+}
+
+func distribution(values []float64) FeatureDistribution {
+	med := median(values)
+	deviations := make([]float64, len(values))
+	total := 0.0
+	for i, value := range values {
+		deviations[i] = math.Abs(value - med)
+		total += deviations[i]
+	}
+	return FeatureDistribution{
+		Median: med,
+		MAD:    median(deviations),
+		MeanAD: total / float64(len(values)),
+	}
+}
+
+// robustZ is the modified z-score of Iglewicz and Hoaglin. When more than
+// half the cohort shares the median the MAD is zero, and the mean absolute
+// deviation is used instead.
+func robustZ(value float64, dist FeatureDistribution) float64 {
+	switch {
+	case dist.MAD > 0:
+		return 0.6745 * (value - dist.Median) / dist.MAD
+	case dist.MeanAD > 0:
+		return (value - dist.Median) / (1.253314 * dist.MeanAD)
+	default:
+		return 0
+	}
+}
+
+func suspiciousZ(z float64, direction int, threshold float64) bool {
+	switch direction {
+	case 1:
+		return z > threshold
+	case -1:
+		return z < -threshold
+	default:
+		return math.Abs(z) > threshold
+	}
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// percentileRank is the share of values strictly below value, counting ties
+// as half, from 0 to 100
+func percentileRank(values []float64, value float64) float64 {
+	below, equal := 0, 0
+	for _, v := range values {
+		switch {
+		case v < value:
+			below++
+		case v == value:
+			equal++
+		}
+	}
+	return (float64(below) + float64(equal-1)/2) / float64(len(values)-1) * 100
+}
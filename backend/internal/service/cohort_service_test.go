@@ -0,0 +1,30 @@
+package service
+
+import "testing"
+
+func TestRobustZ(t *testing.T) {
+	spread := distribution([]float64{1, 2, 3, 4, 100})
+	if spread.Median != 3 || spread.MAD != 1 {
+		t.Fatalf("distribution = %+v, want median 3 and MAD 1", spread)
+	}
+	if z := robustZ(100, spread); !almostEqual(z, 0.6745*97) {
+		t.Errorf("robustZ(100) = %v, want %v", z, 0.6745*97)
+	}
+	if z := robustZ(3, spread); z != 0 {
+		t.Errorf("robustZ(median) = %v, want 0", z)
+	}
+
+	// Most of the cohort shares the median: the MAD is zero and the mean
+	// absolute deviation scales the score
+	shared := distribution([]float64{0, 0, 0, 0, 10})
+	if shared.MAD != 0 || shared.MeanAD != 2 {
+		t.Fatalf("distribution = %+v, want MAD 0 and mean deviation 2", shared)
+	}
+	if z := robustZ(10, shared); !almostEqual(z, 10/(1.253314*2)) {
+		t.Errorf("robustZ(10) = %v, want %v", z, 10/(1.253314*2))
+	}
+
+	if z := robustZ(5, distribution([]float64{4, 4, 4})); z != 0 {
+		t.Errorf("robustZ over an identical cohort = %v, want 0", z)
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"dalivim/internal/models"
+	"dalivim/internal/scoring"
+)
+
+// Confidence labels
+const (
+	ConfidenceHigh             = "high"
+	ConfidenceMedium           = "medium"
+	ConfidenceLow              = "low"
+	ConfidenceInsufficientData = "insufficient_data"
+)
+
+const (
+	// Below these, a session is too short to judge
+	minConfidenceKeystrokes = 30
+	minConfidenceSeconds    = 60.0
+
+	// Evidence is complete from these amounts on
+	fullEvidenceKeystrokes = 300.0
+	fullEvidenceSeconds    = 600.0
+
+	highConfidence   = 0.7
+	mediumConfidence = 0.4
+)
+
+// calibrateConfidence rates how much a result can be trusted, from 0 to 1.
+// Evidence is the amount of data: keystrokes, session length and the share
+// of detectors that had their inputs. Agreement is the share of those
+// detectors that back the verdict: the ones raising suspicion when the
+// submission is judged not genuine, the others when it is judged authored.
+// Confidence is evidence scaled by agreement between one half and one.
+func calibrateConfidence(features map[string]interface{}, results []models.DetectorResult, authorshipScore float64) (float64, string) {
+	keystrokes := getFloat(features, "totalKeystrokes")
+	seconds := getFloat(features, "totalTime")
+
+	ran, suspicious := 0, 0
+	for _, result := range results {
+		if result.Skipped {
+			continue
+		}
+		ran++
+		if result.Score > 0 {
+			suspicious++
+		}
+	}
+
+	backing := ran - suspicious
+	if 1-authorshipScore >= scoring.DecisionThreshold {
+		backing = suspicious
+	}
+
+	coverage, agreement := 0.0, 1.0
+	if len(results) > 0 {
+		coverage = float64(ran) / float64(len(results))
+	}
+	if ran > 0 {
+		agreement = float64(backing) / float64(ran)
+	}
+
+	evidence := 0.4*min(keystrokes/fullEvidenceKeystrokes, 1) +
+		0.3*min(seconds/fullEvidenceSeconds, 1) +
+		0.3*coverage
+	confidence := evidence * (0.5 + 0.5*agreement)
+
+	switch {
+	case keystrokes < minConfidenceKeystrokes || seconds < minConfidenceSeconds:
+		return confidence, ConfidenceInsufficientData
+	case confidence >= highConfidence:
+		return confidence, ConfidenceHigh
+	case confidence >= mediumConfidence:
+		return confidence, ConfidenceMedium
+	default:
+		return confidence, ConfidenceLow
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestAgreementFollowsTheVerdict(t *testing.T) {
+	features := map[string]interface{}{"totalKeystrokes": 300.0, "totalTime": 600.0}
+	results := []models.DetectorResult{
+		{Detector: "paste", Score: 0.6},
+		{Detector: "timing"},
+		{Detector: "focus"},
+		{Detector: "navigation", Score: -0.1},
+	}
+
+	// One detector of four backs a suspicious verdict, three a clean one
+	suspicious, _ := calibrateConfidence(features, results, 0.4)
+	clean, _ := calibrateConfidence(features, results, 0.9)
+	if want := 1 * (0.5 + 0.5*0.25); !almostEqual(suspicious, want) {
+		t.Errorf("suspicious verdict confidence = %v, want %v", suspicious, want)
+	}
+	if want := 1 * (0.5 + 0.5*0.75); !almostEqual(clean, want) {
+		t.Errorf("clean verdict confidence = %v, want %v", clean, want)
+	}
+}
+
+func TestSkippedDetectorsDoNotVote(t *testing.T) {
+	features := map[string]interface{}{"totalKeystrokes": 300.0, "totalTime": 600.0}
+	results := []models.DetectorResult{
+		{Detector: "paste", Score: 0.6},
+		{Detector: "timing", Skipped: true},
+	}
+
+	score, _ := calibrateConfidence(features, results, 0.4)
+	if want := (0.4 + 0.3 + 0.3*0.5) * 1.0; !almostEqual(score, want) {
+		t.Errorf("confidence = %v, want %v", score, want)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	const epsilon = 1e-9
+	return a-b < epsilon && b-a < epsilon
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+)
+
+var ErrDuplicateDetector = errors.New("detector already registered")
+
+// AnalysisInput is everything a detector may look at for one batch
+type AnalysisInput struct {
+	ActivityID uint
+	StudentID  uint
+	IsFinal    bool
+	Code       string
+	Features   map[string]interface{}
+	RawEvents  map[string]interface{}
+	Provenance []PasteProvenance // Paste origins, only for final batches
+	Keystrokes *KeystrokeTimings // Whole-session keystroke dynamics, only for final batches
+
+	// Session holds the editor events of the whole session and
+	// Reconciliation accounts for the final code from its edits, only for
+	// final batches
+	Session        *SessionEvents
+	Reconciliation *CodeReconciliation
+
+	// Rules are the effective rules of the activity, set by AnalysisService
+	Rules rules.Set
+}
+
+// Detector is one independent authorship heuristic. Name identifies the
+// detector in stored results and aggregator weights; Version changes whenever
+// its logic does. Inputs lists the features and raw event kinds it reads.
+type Detector interface {
+	Name() string
+	Version() string
+	Inputs() []string
+	Detect(input AnalysisInput) models.DetectorResult
+}
+
+// DetectorRegistry holds the detectors run by AnalysisService, in
+// registration order
+type DetectorRegistry struct {
+	mu        sync.RWMutex
+	detectors []Detector
+}
+
+func NewDetectorRegistry() *DetectorRegistry {
+	return &DetectorRegistry{}
+}
+
+func (r *DetectorRegistry) Register(detector Detector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.detectors {
+		if existing.Name() == detector.Name() {
+			return fmt.Errorf("%w: %s", ErrDuplicateDetector, detector.Name())
+		}
+	}
+	r.detectors = append(r.detectors, detector)
+	return nil
+}
+
+func (r *DetectorRegistry) Detectors() []Detector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Detector(nil), r.detectors...)
+}
+
+// DefaultDetectors returns the built-in heuristic detectors
+func DefaultDetectors() []Detector {
+	return []Detector{
+		pasteDetector{},
+		editingDetector{},
+		timingDetector{},
+		focusDetector{},
+		navigationDetector{},
+	}
+}
+
+// newDetectorResult starts the result of a detector
+func newDetectorResult(detector Detector) models.DetectorResult {
+	return models.DetectorResult{
+		Detector: detector.Name(),
+		Version:  detector.Version(),
+		Signals:  []string{},
+		Evidence: map[string]float64{},
+		Details:  []models.SignalDetail{},
+	}
+}
+
+// fireRule records a rule's signal and adds its weight when the rule is
+// enabled. value is the measure compared with the rule threshold and events
+// point at what caused it. Rules with a negative weight count as evidence of
+// authorship: they are explained but add no signal.
+func fireRule(result *models.DetectorResult, set rules.Set, name string, value float64, events []models.EventPointer) {
+	rule := set.Get(name)
+	if !rule.Enabled {
+		return
+	}
+	if rule.Weight > 0 {
+		result.Signals = append(result.Signals, name)
+	}
+	result.Score += rule.Weight
+	result.Details = append(result.Details, models.SignalDetail{
+		Signal:       name,
+		Detector:     result.Detector,
+		Value:        value,
+		Threshold:    rule.Threshold,
+		Contribution: rule.Weight,
+		Explanation:  explainSignal(name, value, rule.Threshold),
+		Events:       events,
+	})
+}
+
+// pastePointers points at every paste event of the batch
+func pastePointers(rawEvents map[string]interface{}) []models.EventPointer {
+	var pastes []models.PasteEvent
+	decodeEvents(rawEvents, "pasteEvents", &pastes)
+
+	pointers := make([]models.EventPointer, 0, len(pastes))
+	for _, paste := range pastes {
+		pointers = append(pointers, models.EventPointer{Kind: "pasteEvents", Start: paste.Timestamp})
+	}
+	return pointers
+}
+
+// provenancePointers points at the pastes attributed to source
+func provenancePointers(provenance []PasteProvenance, source string) []models.EventPointer {
+	pointers := []models.EventPointer{}
+	for _, paste := range provenance {
+		if paste.Source == source {
+			pointers = append(pointers, models.EventPointer{Kind: "pasteEvents", Start: paste.Timestamp})
+		}
+	}
+	return pointers
+}
+
+// focusPointers points at every period spent outside the editor
+func focusPointers(rawEvents map[string]interface{}) []models.EventPointer {
+	var events []models.FocusEvent
+	decodeEvents(rawEvents, "focusEvents", &events)
+
+	pointers := []models.EventPointer{}
+	var blurAt int64
+	for _, event := range events {
+		switch event.Type {
+		case "blur":
+			blurAt = event.Timestamp
+		case "focus":
+			start := blurAt
+			if event.AwayDuration > 0 {
+				start = event.Timestamp - event.AwayDuration
+			}
+			pointers = append(pointers, models.EventPointer{Kind: "focusEvents", Start: start, End: event.Timestamp})
+			blurAt = 0
+		}
+	}
+	if blurAt != 0 {
+		pointers = append(pointers, models.EventPointer{Kind: "focusEvents", Start: blurAt})
+	}
+	return pointers
+}
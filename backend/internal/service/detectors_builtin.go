@@ -0,0 +1,186 @@
+package service
+
+import (
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+)
+
+// pasteDetector looks at how much of the code was pasted and where it came from
+type pasteDetector struct{}
+
+func (pasteDetector) Name() string    { return "paste" }
+func (pasteDetector) Version() string { return "1" }
+
+func (pasteDetector) Inputs() []string {
+	return []string{"pasteCharRatio", "pasteEvents", "pastePeerChars", "pasteExternalChars", "pastePeerCount", "codeLength"}
+}
+
+func (d pasteDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+	features, set := input.Features, input.Rules
+
+	// When paste provenance is known, pastes from the student's own code or
+	// the starter code do not count
+	pasteRatio := getFloat(features, "pasteCharRatio")
+	if _, ok := features["pastePeerChars"]; ok {
+		suspicious := getFloat(features, "pastePeerChars") + getFloat(features, "pasteExternalChars")
+		total := suspicious +
+			getFloat(features, "pasteSelfChars") +
+			getFloat(features, "pasteStarterChars") +
+			getFloat(features, "pasteTrivialChars")
+		if total > 0 {
+			pasteRatio *= suspicious / total
+		}
+	}
+	result.Evidence["pasteRatio"] = pasteRatio
+
+	pastes := pastePointers(input.RawEvents)
+	if high := set.Get(rules.HighPasteRatio); high.Enabled && pasteRatio > high.Threshold {
+		fireRule(&result, set, rules.HighPasteRatio, pasteRatio, pastes)
+	} else if pasteRatio > set.Get(rules.ModeratePasteRatio).Threshold {
+		fireRule(&result, set, rules.ModeratePasteRatio, pasteRatio, pastes)
+	}
+
+	// Paste provenance
+	peerCount := getInt(features, "pastePeerCount")
+	result.Evidence["pastePeerCount"] = float64(peerCount)
+	if float64(peerCount) > set.Get(rules.PasteFromPeer).Threshold {
+		fireRule(&result, set, rules.PasteFromPeer, float64(peerCount), provenancePointers(input.Provenance, PasteSourcePeer))
+	}
+	if codeLength := getFloat(features, "codeLength"); codeLength > 0 {
+		externalRatio := getFloat(features, "pasteExternalChars") / codeLength
+		result.Evidence["externalPasteRatio"] = externalRatio
+		if externalRatio > set.Get(rules.ExternalPaste).Threshold {
+			fireRule(&result, set, rules.ExternalPaste, externalRatio, provenancePointers(input.Provenance, PasteSourceExternal))
+		}
+	}
+
+	pasteEvents := getInt(features, "pasteEvents")
+	result.Evidence["pasteEvents"] = float64(pasteEvents)
+	if float64(pasteEvents) > set.Get(rules.MultiplePasteEvents).Threshold {
+		fireRule(&result, set, rules.MultiplePasteEvents, float64(pasteEvents), pastes)
+	}
+
+	return result
+}
+
+// editingDetector looks at whether the code was revised while written
+type editingDetector struct{}
+
+func (editingDetector) Name() string    { return "editing" }
+func (editingDetector) Version() string { return "1" }
+
+func (editingDetector) Inputs() []string {
+	return []string{"deleteRatio", "linearEditingScore", "undoFrequency", "totalKeystrokes"}
+}
+
+func (d editingDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+	features, set := input.Features, input.Rules
+
+	deleteRatio := getFloat(features, "deleteRatio")
+	result.Evidence["deleteRatio"] = deleteRatio
+	if deleteRatio < set.Get(rules.LowEditRatio).Threshold {
+		fireRule(&result, set, rules.LowEditRatio, deleteRatio, nil)
+	}
+
+	linearScore := getFloat(features, "linearEditingScore")
+	result.Evidence["linearEditingScore"] = linearScore
+	if linearScore > set.Get(rules.HighlyLinearEditing).Threshold {
+		fireRule(&result, set, rules.HighlyLinearEditing, linearScore, nil)
+	}
+
+	// Long sessions without a single undo are unusual. The threshold is the
+	// keystroke count from which the check applies.
+	if _, ok := features["undoFrequency"]; ok {
+		keystrokes := float64(getInt(features, "totalKeystrokes"))
+		undoFrequency := getFloat(features, "undoFrequency")
+		result.Evidence["undoFrequency"] = undoFrequency
+		if undoFrequency == 0 && keystrokes > set.Get(rules.NoUndoUsage).Threshold {
+			fireRule(&result, set, rules.NoUndoUsage, keystrokes, nil)
+		} else if undoFrequency > 0 && keystrokes > set.Get(rules.UndoUsage).Threshold {
+			fireRule(&result, set, rules.UndoUsage, keystrokes, nil)
+		}
+	}
+
+	return result
+}
+
+// timingDetector looks at typing rhythm and how quickly the task was done
+type timingDetector struct{}
+
+func (timingDetector) Name() string    { return "timing" }
+func (timingDetector) Version() string { return "1" }
+
+func (timingDetector) Inputs() []string {
+	return []string{"executionCount", "totalTime", "burstiness"}
+}
+
+func (d timingDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+	features, set := input.Features, input.Rules
+
+	totalTime := getFloat(features, "totalTime")
+	result.Evidence["totalTime"] = totalTime
+	if getInt(features, "executionCount") == 0 && totalTime < set.Get(rules.FastCompletion).Threshold {
+		fireRule(&result, set, rules.FastCompletion, totalTime, nil)
+	}
+
+	burstiness := getFloat(features, "burstiness")
+	result.Evidence["burstiness"] = burstiness
+	if burstiness < set.Get(rules.LowTypingVariance).Threshold {
+		fireRule(&result, set, rules.LowTypingVariance, burstiness, nil)
+	}
+
+	return result
+}
+
+// focusDetector looks at how often the student left the editor
+type focusDetector struct{}
+
+func (focusDetector) Name() string     { return "focus" }
+func (focusDetector) Version() string  { return "1" }
+func (focusDetector) Inputs() []string { return []string{"focusLossCount"} }
+
+func (d focusDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	focusLoss := getInt(input.Features, "focusLossCount")
+	result.Evidence["focusLossCount"] = float64(focusLoss)
+	if float64(focusLoss) > input.Rules.Get(rules.FrequentFocusLoss).Threshold {
+		fireRule(&result, input.Rules, rules.FrequentFocusLoss, float64(focusLoss), focusPointers(input.RawEvents))
+	}
+
+	return result
+}
+
+// navigationDetector looks at cursor movement: authors move around their
+// code, copyists don't
+type navigationDetector struct{}
+
+func (navigationDetector) Name() string    { return "navigation" }
+func (navigationDetector) Version() string { return "1" }
+
+func (navigationDetector) Inputs() []string {
+	return []string{"cursorEvents", "nonLinearNavigationRatio"}
+}
+
+func (d navigationDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+	features, set := input.Features, input.Rules
+
+	if getInt(features, "cursorEvents") < minCursorEvents {
+		result.Skipped = true
+		return result
+	}
+
+	navigationRatio := getFloat(features, "nonLinearNavigationRatio")
+	result.Evidence["nonLinearNavigationRatio"] = navigationRatio
+	if navigationRatio < set.Get(rules.LinearNavigationOnly).Threshold {
+		fireRule(&result, set, rules.LinearNavigationOnly, navigationRatio, nil)
+	} else if navigationRatio > set.Get(rules.NonLinearNavigation).Threshold {
+		fireRule(&result, set, rules.NonLinearNavigation, navigationRatio, nil)
+	}
+
+	return result
+}
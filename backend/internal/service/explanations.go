@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"dalivim/internal/rules"
+)
+
+// Explanation languages
+const (
+	LangPortuguese = "pt-BR"
+	LangEnglish    = "en"
+)
+
+// signalExplanation holds the texts of a signal. Templates receive the
+// formatted value as %[1]s and threshold as %[2]s; percent values are
+// ratios shown as percentages.
+type signalExplanation struct {
+	ptBR    string
+	en      string
+	percent bool
+}
+
+var signalExplanations = map[string]signalExplanation{
+	rules.HighPasteRatio: {
+		ptBR:    "%[1]s do código foi colado de fora do editor (limite %[2]s)",
+		en:      "%[1]s of the code was pasted from outside the editor (limit %[2]s)",
+		percent: true,
+	},
+	rules.ModeratePasteRatio: {
+		ptBR:    "%[1]s do código foi colado (acima de %[2]s)",
+		en:      "%[1]s of the code was pasted (above %[2]s)",
+		percent: true,
+	},
+	rules.PasteFromPeer: {
+		ptBR: "%[1]s colagem(ns) coincidem com a submissão de outro estudante",
+		en:   "%[1]s paste(s) match another student's submission",
+	},
+	rules.ExternalPaste: {
+		ptBR:    "%[1]s do código veio de colagens de origem desconhecida (limite %[2]s)",
+		en:      "%[1]s of the code came from pastes of unknown origin (limit %[2]s)",
+		percent: true,
+	},
+	rules.LowEditRatio: {
+		ptBR:    "Apenas %[1]s das teclas foram exclusões (esperado ao menos %[2]s)",
+		en:      "Only %[1]s of keystrokes were deletions (expected at least %[2]s)",
+		percent: true,
+	},
+	rules.HighlyLinearEditing: {
+		ptBR:    "%[1]s das edições foram feitas de cima para baixo sem retornar (limite %[2]s)",
+		en:      "%[1]s of the edits were made top to bottom without going back (limit %[2]s)",
+		percent: true,
+	},
+	rules.MultiplePasteEvents: {
+		ptBR: "%[1]s eventos de colagem (limite %[2]s)",
+		en:   "%[1]s paste events (limit %[2]s)",
+	},
+	rules.FastCompletion: {
+		ptBR: "Concluído em %[1]s segundos sem executar o código (mínimo %[2]s)",
+		en:   "Finished in %[1]s seconds without running the code (minimum %[2]s)",
+	},
+	rules.FrequentFocusLoss: {
+		ptBR: "Saiu do editor %[1]s vezes (limite %[2]s)",
+		en:   "Left the editor %[1]s times (limit %[2]s)",
+	},
+	rules.LowTypingVariance: {
+		ptBR: "Ritmo de digitação incomumente regular: variação %[1]s (esperado ao menos %[2]s)",
+		en:   "Typing rhythm was unusually regular: burstiness %[1]s (expected at least %[2]s)",
+	},
+	rules.LinearNavigationOnly: {
+		ptBR:    "Apenas %[1]s dos movimentos do cursor voltaram ou saltaram (esperado ao menos %[2]s)",
+		en:      "Only %[1]s of cursor moves went back or jumped (expected at least %[2]s)",
+		percent: true,
+	},
+	rules.NonLinearNavigation: {
+		ptBR:    "%[1]s dos movimentos do cursor voltaram ou saltaram, como ao revisar o próprio código",
+		en:      "%[1]s of cursor moves went back or jumped, as when revising one's own code",
+		percent: true,
+	},
+	rules.NoUndoUsage: {
+		ptBR: "Nenhum desfazer em %[1]s teclas (verificado a partir de %[2]s)",
+		en:   "No undo in %[1]s keystrokes (checked from %[2]s)",
+	},
+	rules.UndoUsage: {
+		ptBR: "Usou desfazer ao longo de %[1]s teclas, como ao corrigir o próprio código",
+		en:   "Used undo over %[1]s keystrokes, as when correcting one's own code",
+	},
+	rules.BaselineDeviation: {
+		ptBR: "Comportamento %[1]s desvios-padrão distante das submissões anteriores do estudante (limite %[2]s)",
+		en:   "Behavior is %[1]s standard deviations away from the student's previous submissions (limit %[2]s)",
+	},
+	rules.IdentityMismatch: {
+		ptBR:    "O ritmo de digitação coincide apenas %[1]s com o perfil do estudante (mínimo %[2]s)",
+		en:      "Typing rhythm matches the student's profile by only %[1]s (minimum %[2]s)",
+		percent: true,
+	},
+	rules.AICodeStyle: {
+		ptBR:    "O estilo do código se parece %[1]s com o de código gerado por IA: comentários, nomes e idiomas (limite %[2]s)",
+		en:      "The code style resembles AI-generated code by %[1]s: comments, names and idioms (limit %[2]s)",
+		percent: true,
+	},
+	rules.StyleShift: {
+		ptBR:    "O estilo do código mudou %[1]s em relação às submissões anteriores do estudante (limite %[2]s)",
+		en:      "The code style moved %[1]s away from the student's previous submissions (limit %[2]s)",
+		percent: true,
+	},
+	rules.NewLanguageFeatures: {
+		ptBR: "%[1]s recursos da linguagem nunca usados nas submissões anteriores do estudante (limite %[2]s)",
+		en:   "%[1]s language features never used in the student's previous submissions (limit %[2]s)",
+	},
+	rules.UntypedCode: {
+		ptBR:    "%[1]s do código final não foi digitado nem colado no editor (limite %[2]s)",
+		en:      "%[1]s of the final code was neither typed nor pasted in the editor (limit %[2]s)",
+		percent: true,
+	},
+	rules.IdleThenBurst: {
+		ptBR: "%[1]s trecho(s) de digitação rápida e linear, quase sem correções, logo após pausas de ao menos %[2]s segundos",
+		en:   "%[1]s stretch(es) of fast, linear typing with almost no corrections right after pauses of at least %[2]s seconds",
+	},
+	rules.ConsistentBaseline: {
+		ptBR: "Comportamento consistente com as submissões anteriores do estudante (desvio %[1]s)",
+		en:   "Behavior is consistent with the student's previous submissions (deviation %[1]s)",
+	},
+}
+
+// explainCohortOutlier explains which feature made a submission an outlier
+// within its activity
+func explainCohortOutlier(feature string, z, threshold float64) map[string]string {
+	value := formatMeasure(math.Abs(z), false)
+	limit := formatMeasure(threshold, false)
+	direction := map[string]string{LangPortuguese: "acima", LangEnglish: "above"}
+	if z < 0 {
+		direction = map[string]string{LangPortuguese: "abaixo", LangEnglish: "below"}
+	}
+
+	return map[string]string{
+		LangPortuguese: fmt.Sprintf("%s está %s desvios robustos %s da mediana da turma (limite %s)",
+			feature, value, direction[LangPortuguese], limit),
+		LangEnglish: fmt.Sprintf("%s is %s robust deviations %s the class median (limit %s)",
+			feature, value, direction[LangEnglish], limit),
+	}
+}
+
+// explainSignal renders the explanation of a signal in every language
+func explainSignal(signal string, value, threshold float64) map[string]string {
+	explanation, ok := signalExplanations[signal]
+	if !ok {
+		explanation = signalExplanation{
+			ptBR: signal + ": valor %[1]s, limite %[2]s",
+			en:   signal + ": value %[1]s, threshold %[2]s",
+		}
+	}
+
+	formattedValue := formatMeasure(value, explanation.percent)
+	formattedThreshold := formatMeasure(threshold, explanation.percent)
+
+	return map[string]string{
+		LangPortuguese: fmt.Sprintf(explanation.ptBR, formattedValue, formattedThreshold),
+		LangEnglish:    fmt.Sprintf(explanation.en, formattedValue, formattedThreshold),
+	}
+}
+
+func formatMeasure(value float64, percent bool) string {
+	if percent {
+		return strconv.FormatFloat(math.Round(value*100), 'f', -1, 64) + "%"
+	}
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+const (
+	// analysisQueueSize bounds the submissions waiting for a worker. When it
+	// is full they stay pending in the database until the next scan.
+	analysisQueueSize = 1000
+	// pendingAnalysisScan is how often submissions still pending are queued
+	// again, such as those saved before a restart
+	pendingAnalysisScan = 30 * time.Second
+	// pendingAnalysisWait is how often WaitAnalyzed looks at the submissions
+	pendingAnalysisWait = 100 * time.Millisecond
+)
+
+// Start launches the final analysis workers and the scan for pending
+// submissions
+func (s *telemetryService) Start() {
+	for i := 0; i < s.analysisWorkers; i++ {
+		go s.analyzeFinals()
+	}
+	go s.scanPendingAnalyses()
+}
+
+// enqueueAnalysis hands a saved final to the workers. A submission already
+// queued or being analyzed is not queued twice.
+func (s *telemetryService) enqueueAnalysis(submissionID uint) {
+	s.inFlightMu.Lock()
+	defer s.inFlightMu.Unlock()
+
+	if s.inFlight[submissionID] {
+		return
+	}
+	select {
+	case s.analysisJobs <- submissionID:
+		s.inFlight[submissionID] = true
+	default:
+	}
+}
+
+func (s *telemetryService) analyzeFinals() {
+	for submissionID := range s.analysisJobs {
+		if err := s.analyzeFinal(submissionID); err != nil {
+			log.Printf("failed to analyze submission %d: %v", submissionID, err)
+		}
+
+		s.inFlightMu.Lock()
+		delete(s.inFlight, submissionID)
+		s.inFlightMu.Unlock()
+	}
+}
+
+func (s *telemetryService) scanPendingAnalyses() {
+	ticker := time.NewTicker(pendingAnalysisScan)
+	defer ticker.Stop()
+
+	for {
+		submissions, err := s.submissionRepo.FindAnalysisPending(analysisQueueSize)
+		if err != nil {
+			log.Printf("failed to find pending analyses: %v", err)
+		}
+		for _, submission := range submissions {
+			s.enqueueAnalysis(submission.ID)
+		}
+		<-ticker.C
+	}
+}
+
+// WaitAnalyzed waits until no submission of the activity is pending
+// analysis and reports whether that happened before timeout
+func (s *telemetryService) WaitAnalyzed(activityID uint, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		count, err := s.submissionRepo.CountAnalysisPending(activityID)
+		if err == nil && count == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(pendingAnalysisWait)
+	}
+}
+
+// analyzeFinal analyzes a final submission saved by ProcessTelemetry. The
+// input is rebuilt from the stored final batch, as a re-analysis does, after
+// the student's queued batches are persisted.
+func (s *telemetryService) analyzeFinal(submissionID uint) error {
+	submission, err := s.submissionRepo.FindByID(submissionID)
+	if err != nil {
+		return ErrSubmissionNotFound
+	}
+	if !submission.AnalysisPending {
+		return nil
+	}
+
+	batch := TelemetryBatch{
+		ActivityID: submission.ActivityID,
+		StudentID:  submission.StudentID,
+		SessionID:  submission.SessionID,
+		IsFinal:    true,
+		Code:       submission.Code,
+	}
+	stored, complete := s.studentTelemetry(batch)
+	final := storedFinal(stored, submission)
+	if final == nil {
+		return errors.New("final telemetry not found")
+	}
+
+	batch.Sequence = final.Sequence
+	batch.Timestamp = final.Timestamp
+	batch.Features = map[string]interface{}{}
+	batch.RawEvents = map[string]interface{}{}
+	json.Unmarshal([]byte(final.Features), &batch.Features)
+	json.Unmarshal([]byte(final.RawEvents), &batch.RawEvents)
+	features := batch.Features
+
+	// Attribute pastes to their origin
+	provenance := s.classifyPastes(batch)
+	pasteProvenanceFeatures(features, provenance)
+
+	// Replaying the session needs every batch of it: with some still
+	// queued or missing, untyped code would be reported falsely. The final
+	// batch is stored, so its events are among the stored ones.
+	var editorEvents *SessionEvents
+	var reconciliation *CodeReconciliation
+	if complete && replayable(stored, final) {
+		editorEvents = collectSessionEvents(stored, batch.SessionID, nil)
+		editorEvents.Start = sessionStart(batch.Timestamp, features)
+		reconciliation = s.sessionReconciliation(batch, editorEvents)
+	}
+	keystrokes := timingsOf(storedKeyEvents(stored))
+
+	analysis := s.analysisService.Analyze(AnalysisInput{
+		ActivityID: batch.ActivityID,
+		StudentID:  batch.StudentID,
+		IsFinal:    true,
+		Code:       batch.Code,
+		Features:   features,
+		RawEvents:  batch.RawEvents,
+		Provenance: provenance,
+		Keystrokes: keystrokes,
+
+		Session:        editorEvents,
+		Reconciliation: reconciliation,
+	})
+
+	provenanceJSON, _ := json.Marshal(provenance)
+	apply := func(locked *models.Submission) *models.AnalysisRun {
+		applyAnalysis(locked, analysis)
+		locked.PasteProvenance = string(provenanceJSON)
+		submission = locked
+
+		run := newAnalysisRun(locked, analysis, models.AnalysisTriggerSubmission)
+		run.Applied = true
+		return run
+	}
+	// The submission only joins the baseline after being compared with it
+	addFeatures := func(baseline *models.StudentBaseline) { addToBaseline(baseline, features) }
+
+	applied, err := s.submissionRepo.CompleteAnalysis(submissionID, apply, addFeatures)
+	if err != nil || !applied {
+		return err
+	}
+
+	if set, err := s.analysisService.GetRules(batch.ActivityID); err == nil {
+		if err := updateKeystrokeProfile(s.profileRepo, batch.StudentID, keystrokes, analysis, set); err != nil {
+			log.Printf("failed to update keystroke profile of student %d: %v", batch.StudentID, err)
+		}
+	}
+
+	s.recheckPeerPastes(submission)
+
+	batch.Features = features
+	s.proctoringService.Observe(batch, analysis, final.Integrity)
+	return nil
+}
+
+// storedFinal finds the telemetry row saved with a submission. Submissions
+// saved before the row was linked fall back to the session's last final.
+func storedFinal(stored []models.TelemetryData, submission *models.Submission) *models.TelemetryData {
+	if submission.FinalTelemetryID != 0 {
+		for i := range stored {
+			if stored[i].ID == submission.FinalTelemetryID {
+				return &stored[i]
+			}
+		}
+	}
+	return finalTelemetry(stored, submission.SessionID)
+}
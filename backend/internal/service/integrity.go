@@ -0,0 +1,213 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+
+	"dalivim/internal/models"
+)
+
+// Integrity signals raised while verifying a telemetry chain
+const (
+	SignalUnsignedTelemetry = "unsigned_telemetry"
+	SignalSessionMismatch   = "session_mismatch"
+	SignalInvalidSignature  = "invalid_signature"
+	SignalReplayedBatch     = "replayed_batch"
+	SignalMissingSegment    = "missing_segment"
+	SignalBrokenChain       = "broken_chain"
+)
+
+const integrityOK = "ok"
+
+// signBatch computes the HMAC-SHA256 of a batch with the session key.
+//
+// The signed message is "sequence|prevHash|timestamp|isFinal|sha256(code)|sha256(payload)",
+// where payload is the canonical JSON (see canonicalJSON) of the object
+// {"features":...,"rawEvents":...}. frontend/src/telemetrySigning.js is the
+// client side.
+func signBatch(key string, batch TelemetryBatch) string {
+	var payload bytes.Buffer
+	writeCanonicalJSON(&payload, map[string]interface{}{
+		"features":  batch.Features,
+		"rawEvents": batch.RawEvents,
+	})
+
+	message := fmt.Sprintf("%d|%s|%d|%t|%s|%s",
+		batch.Sequence,
+		batch.PrevHash,
+		batch.Timestamp,
+		batch.IsFinal,
+		sha256Hex([]byte(batch.Code)),
+		sha256Hex(payload.Bytes()),
+	)
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// canonicalJSON is what JSON.stringify produces with object keys sorted:
+// no whitespace, no HTML escaping and ECMAScript number formatting. Keys are
+// sorted by UTF-16 code units, as Array.prototype.sort orders them.
+func canonicalJSON(value interface{}) []byte {
+	var buf bytes.Buffer
+	writeCanonicalJSON(&buf, value)
+	return buf.Bytes()
+}
+
+func writeCanonicalJSON(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case float64:
+		buf.WriteString(formatJSNumber(v))
+	case string:
+		writeJSString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalJSON(buf, item)
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		if v == nil {
+			buf.WriteString("null")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSString(buf, key)
+			buf.WriteByte(':')
+			writeCanonicalJSON(buf, v[key])
+		}
+		buf.WriteByte('}')
+	default:
+		// Values not decoded from JSON are brought to the decoded form first
+		data, _ := json.Marshal(v)
+		var decoded interface{}
+		json.Unmarshal(data, &decoded)
+		writeCanonicalJSON(buf, decoded)
+	}
+}
+
+// formatJSNumber formats a number as ECMAScript's Number.prototype.toString
+func formatJSNumber(f float64) string {
+	if f == 0 {
+		return "0" // Including -0
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs < 1e-6 || abs >= 1e21 {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if format == 'e' {
+		// 1e-07 becomes 1e-7
+		n := len(s)
+		if n >= 4 && s[n-4] == 'e' && s[n-3] == '-' && s[n-2] == '0' {
+			s = s[:n-2] + s[n-1:]
+		}
+	}
+	return s
+}
+
+// writeJSString quotes a string as JSON.stringify does: only quotes,
+// backslashes and control characters are escaped
+func writeJSString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(buf, `\u%04x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+func lessUTF16(a, b string) bool {
+	x, y := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(x) && i < len(y); i++ {
+		if x[i] != y[i] {
+			return x[i] < y[i]
+		}
+	}
+	return len(x) < len(y)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyChain checks a batch against the session's hash chain, advances the
+// chain when the batch is valid and returns the integrity status of the batch.
+// Any problem is also recorded on the session.
+func verifyChain(session *models.TelemetrySession, batch TelemetryBatch) string {
+	if session.ActivityID != batch.ActivityID || session.StudentID != batch.StudentID {
+		session.AddIntegritySignal(SignalSessionMismatch)
+		return SignalSessionMismatch
+	}
+
+	expected := signBatch(session.SessionKey, batch)
+	if !hmac.Equal([]byte(expected), []byte(batch.Signature)) {
+		session.AddIntegritySignal(SignalInvalidSignature)
+		return SignalInvalidSignature
+	}
+
+	if batch.Sequence <= session.LastSequence {
+		session.AddIntegritySignal(SignalReplayedBatch)
+		return SignalReplayedBatch
+	}
+
+	status := integrityOK
+	if batch.Sequence > session.LastSequence+1 {
+		session.AddIntegritySignal(SignalMissingSegment)
+		status = SignalMissingSegment
+	} else if batch.PrevHash != session.LastHash {
+		session.AddIntegritySignal(SignalBrokenChain)
+		status = SignalBrokenChain
+	}
+
+	session.LastSequence = batch.Sequence
+	session.LastHash = batch.Signature
+	return status
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestSignBatchCoversCodeAndPayload(t *testing.T) {
+	batch := TelemetryBatch{Sequence: 1, Timestamp: 1000, Code: "x = 1", Features: map[string]interface{}{"totalKeystrokes": 5.0}}
+	signature := signBatch("secret", batch)
+
+	if signBatch("secret", batch) != signature {
+		t.Fatal("signature is not deterministic")
+	}
+
+	changes := map[string]func(b *TelemetryBatch){
+		"code":     func(b *TelemetryBatch) { b.Code = "x = 2" },
+		"features": func(b *TelemetryBatch) { b.Features = map[string]interface{}{"totalKeystrokes": 6.0} },
+		"sequence": func(b *TelemetryBatch) { b.Sequence = 2 },
+		"prevHash": func(b *TelemetryBatch) { b.PrevHash = "abc" },
+		"final":    func(b *TelemetryBatch) { b.IsFinal = true },
+	}
+	for name, change := range changes {
+		changed := batch
+		change(&changed)
+		if signBatch("secret", changed) == signature {
+			t.Errorf("changing the %s kept the signature", name)
+		}
+	}
+	if signBatch("other", batch) == signature {
+		t.Error("another key produced the same signature")
+	}
+}
+
+// The vector was produced by frontend/src/telemetrySigning.js from the body
+// below: the server must sign what it decodes exactly as the browser does
+func TestSignBatchMatchesTheBrowserClient(t *testing.T) {
+	body := `{"sequence":2,"prevHash":"a1b2","timestamp":1704358810000,"isFinal":true,` +
+		`"code":"if (a < b && c > d) { return \"ok\"; } // é",` +
+		`"features":{"9":2,"10":1,"pasteCharRatio":0.1,"totalTime":1e+21,"tiny":1.5e-7,"avgKeystrokeInterval":123.456,"totalKeystrokes":40,"Z":0},` +
+		`"rawEvents":{"pasteEvents":[{"content":"<script>&\u2028\n\u0001 \"q\" \\ 😀","length":3,"timestamp":5}],"keyEvents":[]}}`
+	// Sorted keys, U+2028, the emoji and the HTML characters are left as is
+	payload := `{"features":{"10":1,"9":2,"Z":0,"avgKeystrokeInterval":123.456,"pasteCharRatio":0.1,"tiny":1.5e-7,"totalKeystrokes":40,"totalTime":1e+21},` +
+		`"rawEvents":{"keyEvents":[],"pasteEvents":[{"content":"<script>&` + "\u2028" + `\n\u0001 \"q\" \\ ` + "\U0001F600" + `","length":3,"timestamp":5}]}}`
+
+	var batch struct {
+		Sequence  int64
+		PrevHash  string
+		Timestamp int64
+		IsFinal   bool
+		Code      string
+		Features  map[string]interface{}
+		RawEvents map[string]interface{}
+	}
+	if err := json.Unmarshal([]byte(body), &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := string(canonicalJSON(map[string]interface{}{"features": batch.Features, "rawEvents": batch.RawEvents})); got != payload {
+		t.Errorf("canonical payload\n%s\nwant\n%s", got, payload)
+	}
+
+	signature := signBatch("secret", TelemetryBatch{
+		Sequence:  batch.Sequence,
+		PrevHash:  batch.PrevHash,
+		Timestamp: batch.Timestamp,
+		IsFinal:   batch.IsFinal,
+		Code:      batch.Code,
+		Features:  batch.Features,
+		RawEvents: batch.RawEvents,
+	})
+	if want := "881989964dc53700fcadb7710fe4215fdd2bdf2b20ba8a8ec24e591bfeefbf82"; signature != want {
+		t.Errorf("signature = %s, want %s", signature, want)
+	}
+}
+
+// signedChain builds consecutive batches of a session signed with its key
+func signedChain(key string, count int) []TelemetryBatch {
+	batches := make([]TelemetryBatch, count)
+	prevHash := ""
+	for i := range batches {
+		batches[i] = TelemetryBatch{ActivityID: 1, StudentID: 2, Sequence: int64(i + 1), PrevHash: prevHash, Timestamp: int64(i * 1000)}
+		batches[i].Signature = signBatch(key, batches[i])
+		prevHash = batches[i].Signature
+	}
+	return batches
+}
+
+func TestVerifyChain(t *testing.T) {
+	batches := signedChain("secret", 3)
+
+	tests := []struct {
+		name    string
+		session models.TelemetrySession
+		batch   TelemetryBatch
+		want    string
+	}{
+		{"first batch", models.TelemetrySession{}, batches[0], integrityOK},
+		{"next batch", models.TelemetrySession{LastSequence: 1, LastHash: batches[0].Signature}, batches[1], integrityOK},
+		{"replayed", models.TelemetrySession{LastSequence: 2, LastHash: batches[1].Signature}, batches[1], SignalReplayedBatch},
+		{"skipped batch", models.TelemetrySession{LastSequence: 1, LastHash: batches[0].Signature}, batches[2], SignalMissingSegment},
+		{"other chain", models.TelemetrySession{LastSequence: 1, LastHash: "forged"}, batches[1], SignalBrokenChain},
+		{"other student", models.TelemetrySession{StudentID: 3}, batches[0], SignalSessionMismatch},
+	}
+	for _, tt := range tests {
+		session := tt.session
+		session.SessionKey = "secret"
+		session.ActivityID = 1
+		if session.StudentID == 0 {
+			session.StudentID = 2
+		}
+
+		if got := verifyChain(&session, tt.batch); got != tt.want {
+			t.Errorf("%s: verifyChain = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	tampered := batches[0]
+	tampered.Code = "injected"
+	session := models.TelemetrySession{ActivityID: 1, StudentID: 2, SessionKey: "secret"}
+	if got := verifyChain(&session, tampered); got != SignalInvalidSignature {
+		t.Errorf("tampered batch: verifyChain = %q, want %q", got, SignalInvalidSignature)
+	}
+	if session.LastSequence != 0 {
+		t.Error("tampered batch advanced the chain")
+	}
+	if len(session.IntegritySignalsArray) != 1 || session.IntegritySignalsArray[0] != SignalInvalidSignature {
+		t.Errorf("session signals = %v, want the invalid signature", session.IntegritySignalsArray)
+	}
+}
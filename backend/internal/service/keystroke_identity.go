@@ -0,0 +1,244 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+// IdentityDetectorName names the keystroke dynamics detector
+const IdentityDetectorName = "keystroke_identity"
+
+const (
+	// Gaps longer than this are pauses, not typing rhythm (ms)
+	maxKeystrokeGap = 2000.0
+	// A profile is only compared against once built from this many sessions
+	minProfileSessions = 2
+	// Minimum occurrences of a digraph in a session and in the profile
+	minSessionDigraphs = 3
+	minProfileDigraphs = 10
+	// Minimum measures (dwell, flight, digraphs) shared with the profile
+	minIdentityMeasures = 5
+	// Floor of profile deviations, below timer resolution (ms)
+	minTimingStd = 10.0
+)
+
+// KeystrokeTimings are the keystroke dynamics of a session, in ms
+type KeystrokeTimings struct {
+	Dwell    []float64            // Key hold times
+	Flight   []float64            // Release of a key to press of the next
+	Digraphs map[string][]float64 // Press to press latency of key pairs
+}
+
+// keystrokeTimings pairs key presses with their release. Latencies spanning
+// a pause are left out.
+func keystrokeTimings(events []models.KeyEvent) KeystrokeTimings {
+	timings := KeystrokeTimings{Digraphs: map[string][]float64{}}
+
+	sorted := append([]models.KeyEvent(nil), events...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	pressed := map[string]float64{}
+	var lastKey string
+	var lastDown, lastUp float64
+	for _, event := range sorted {
+		switch event.Type {
+		case "keydown":
+			if _, held := pressed[event.Key]; held {
+				continue // Auto-repeat
+			}
+			pressed[event.Key] = event.Timestamp
+
+			if lastKey != "" {
+				if latency := event.Timestamp - lastDown; latency > 0 && latency <= maxKeystrokeGap {
+					digraph := lastKey + ">" + event.Key
+					timings.Digraphs[digraph] = append(timings.Digraphs[digraph], latency)
+				}
+				if flight := event.Timestamp - lastUp; lastUp > 0 && flight <= maxKeystrokeGap && flight > -maxKeystrokeGap {
+					timings.Flight = append(timings.Flight, flight)
+				}
+			}
+			lastKey, lastDown = event.Key, event.Timestamp
+
+		case "keyup":
+			down, held := pressed[event.Key]
+			if !held {
+				continue
+			}
+			delete(pressed, event.Key)
+
+			if dwell := event.Timestamp - down; dwell >= 0 && dwell <= maxKeystrokeGap {
+				timings.Dwell = append(timings.Dwell, dwell)
+			}
+			lastUp = event.Timestamp
+		}
+	}
+
+	return timings
+}
+
+// identityConsistency compares session timings with a profile using the
+// scaled Manhattan distance: the mean of |session mean - profile mean| /
+// profile deviation over dwell, flight and shared digraphs. The distance is
+// mapped to a consistency in (0, 1], 1 being identical. ok is false when too
+// few measures are shared.
+func identityConsistency(timings KeystrokeTimings, profile *models.KeystrokeProfile) (consistency, distance float64, measures int, ok bool) {
+	total := 0.0
+	compare := func(values []float64, stats models.FeatureStats, minValues, minProfile int) {
+		if len(values) < minValues || stats.Count < minProfile {
+			return
+		}
+		total += math.Abs(mean(values)-stats.Mean) / math.Max(stats.Std(), minTimingStd)
+		measures++
+	}
+
+	compare(timings.Dwell, profile.Dwell, minSessionDigraphs, minProfileDigraphs)
+	compare(timings.Flight, profile.Flight, minSessionDigraphs, minProfileDigraphs)
+	for digraph, latencies := range timings.Digraphs {
+		compare(latencies, profile.Digraphs[digraph], minSessionDigraphs, minProfileDigraphs)
+	}
+
+	if measures < minIdentityMeasures {
+		return 0, 0, measures, false
+	}
+
+	distance = total / float64(measures)
+	return 1 / (1 + distance*distance), distance, measures, true
+}
+
+// identityDetector checks that the session was typed by the same person as
+// the student's earlier sessions
+type identityDetector struct {
+	profileRepo repository.KeystrokeProfileRepository
+}
+
+func NewIdentityDetector(profileRepo repository.KeystrokeProfileRepository) Detector {
+	return &identityDetector{profileRepo: profileRepo}
+}
+
+func (d *identityDetector) Name() string     { return IdentityDetectorName }
+func (d *identityDetector) Version() string  { return "1" }
+func (d *identityDetector) Inputs() []string { return []string{"keyEvents"} }
+
+func (d *identityDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	timings := input.Keystrokes
+	if timings == nil {
+		var events []models.KeyEvent
+		if !decodeEvents(input.RawEvents, "keyEvents", &events) {
+			result.Skipped = true
+			return result
+		}
+		sample := keystrokeTimings(events)
+		timings = &sample
+	}
+
+	profile, err := d.profileRepo.FindByStudentID(input.StudentID)
+	if err != nil || profile.SessionCount < minProfileSessions {
+		result.Skipped = true
+		return result
+	}
+
+	consistency, distance, measures, ok := identityConsistency(*timings, profile)
+	if !ok {
+		result.Skipped = true
+		return result
+	}
+
+	result.Evidence["consistency"] = consistency
+	result.Evidence["distance"] = distance
+	result.Evidence["measures"] = float64(measures)
+	result.Evidence["profileSessions"] = float64(profile.SessionCount)
+
+	if consistency < input.Rules.Get(rules.IdentityMismatch).Threshold {
+		fireRule(&result, input.Rules, rules.IdentityMismatch, consistency, nil)
+	}
+
+	return result
+}
+
+// sessionKeystrokes gathers the key events of every stored batch of the
+// student in the activity plus the final batch, which is not stored yet
+func sessionKeystrokes(stored []models.TelemetryData, batch TelemetryBatch) *KeystrokeTimings {
+	events := storedKeyEvents(stored)
+
+	var finalEvents []models.KeyEvent
+	if decodeEvents(batch.RawEvents, "keyEvents", &finalEvents) {
+		events = append(events, finalEvents...)
+	}
+
+	return timingsOf(events)
+}
+
+// storedKeyEvents collects the key events of the accepted stored batches
+func storedKeyEvents(stored []models.TelemetryData) []models.KeyEvent {
+	var events []models.KeyEvent
+	for _, telemetry := range acceptedBatches(stored) {
+		var batchEvents []models.KeyEvent
+		if decodeStoredEvents(telemetry.RawEvents, "keyEvents", &batchEvents) {
+			events = append(events, batchEvents...)
+		}
+	}
+	return events
+}
+
+func timingsOf(events []models.KeyEvent) *KeystrokeTimings {
+	if len(events) == 0 {
+		return nil
+	}
+	timings := keystrokeTimings(events)
+	return &timings
+}
+
+// updateKeystrokeProfile adds a session to the student's keystroke profile.
+// Sessions that do not match an established profile are left out so another
+// typist cannot shift it.
+func updateKeystrokeProfile(profileRepo repository.KeystrokeProfileRepository, studentID uint, timings *KeystrokeTimings, analysis AnalysisResult, set rules.Set) error {
+	if timings == nil || len(timings.Dwell) == 0 {
+		return nil
+	}
+	if consistency, ok := analysis.Evidence(IdentityDetectorName, "consistency"); ok &&
+		consistency < set.Get(rules.IdentityMismatch).Threshold {
+		return nil
+	}
+
+	profile, err := profileRepo.FindByStudentID(studentID)
+	if err != nil {
+		profile = &models.KeystrokeProfile{
+			StudentID: studentID,
+			Digraphs:  map[string]models.FeatureStats{},
+		}
+	}
+
+	for _, dwell := range timings.Dwell {
+		profile.Dwell.Add(dwell)
+	}
+	for _, flight := range timings.Flight {
+		profile.Flight.Add(flight)
+	}
+	for digraph, latencies := range timings.Digraphs {
+		stats := profile.Digraphs[digraph]
+		for _, latency := range latencies {
+			stats.Add(latency)
+		}
+		profile.Digraphs[digraph] = stats
+	}
+	profile.SessionCount++
+
+	return profileRepo.Save(profile)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total / float64(len(values))
+}
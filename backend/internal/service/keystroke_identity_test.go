@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestKeystrokeTimings(t *testing.T) {
+	events := []models.KeyEvent{
+		{Timestamp: 0, Type: "keydown", Key: "KeyA"},
+		{Timestamp: 80, Type: "keyup", Key: "KeyA"},
+		{Timestamp: 150, Type: "keydown", Key: "KeyB"},
+		{Timestamp: 180, Type: "keydown", Key: "KeyB"}, // Auto-repeat
+		{Timestamp: 240, Type: "keyup", Key: "KeyB"},
+		{Timestamp: 5000, Type: "keydown", Key: "KeyC"}, // After a pause
+		{Timestamp: 5100, Type: "keyup", Key: "KeyC"},
+		{Timestamp: 5200, Type: "keyup", Key: "KeyD"}, // Never pressed
+	}
+
+	timings := keystrokeTimings(events)
+
+	if len(timings.Dwell) != 3 || timings.Dwell[0] != 80 || timings.Dwell[1] != 90 || timings.Dwell[2] != 100 {
+		t.Errorf("dwell = %v, want [80 90 100]", timings.Dwell)
+	}
+	if len(timings.Flight) != 1 || timings.Flight[0] != 70 {
+		t.Errorf("flight = %v, want [70]", timings.Flight)
+	}
+	if latencies := timings.Digraphs["KeyA>KeyB"]; len(latencies) != 1 || latencies[0] != 150 {
+		t.Errorf("KeyA>KeyB = %v, want [150]", latencies)
+	}
+	if _, ok := timings.Digraphs["KeyB>KeyC"]; ok {
+		t.Error("digraph spanning a pause was kept")
+	}
+}
+
+func TestKeystrokeTimingsSortsEvents(t *testing.T) {
+	events := []models.KeyEvent{
+		{Timestamp: 60, Type: "keyup", Key: "KeyA"},
+		{Timestamp: 0, Type: "keydown", Key: "KeyA"},
+	}
+
+	if timings := keystrokeTimings(events); len(timings.Dwell) != 1 || timings.Dwell[0] != 60 {
+		t.Errorf("dwell = %v, want [60]", timings.Dwell)
+	}
+}
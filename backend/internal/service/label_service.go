@@ -0,0 +1,225 @@
+package service
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/scoring"
+)
+
+var (
+	ErrSubmissionNotFound = errors.New("submission not found")
+	ErrNotActivityOwner   = errors.New("not the professor of this activity")
+)
+
+// trainingLabels maps professor labels to the trainer's label: 1 when the
+// submission was not genuinely authored. Inconclusive submissions are not
+// exported, as the trainer would read them as unlabeled.
+var trainingLabels = map[string]string{
+	models.LabelConfirmedAuthored: "0",
+	models.LabelConfirmedCopied:   "1",
+	models.LabelAIAssisted:        "1",
+}
+
+// exportedDetectors have their score exported as "<detector>_score", to
+// compare them with the labels
+var exportedDetectors = []string{
+	TimelineDetectorName,
+	StylometryDetectorName,
+	TypingConsistencyDetectorName,
+	IdentityDetectorName,
+}
+
+type LabelService interface {
+	Label(professorID, submissionID uint, label, notes string) (*models.SubmissionLabel, error)
+	History(professorID, submissionID uint) ([]models.SubmissionLabel, error)
+	// Export writes the labeled submissions of a professor as CSV in the
+	// trainer's format, for one activity or all of them when activityID is 0
+	Export(w io.Writer, professorID, activityID uint) error
+}
+
+type labelService struct {
+	labelRepo      repository.LabelRepository
+	submissionRepo repository.SubmissionRepository
+	activityRepo   repository.ActivityRepository
+}
+
+func NewLabelService(
+	labelRepo repository.LabelRepository,
+	submissionRepo repository.SubmissionRepository,
+	activityRepo repository.ActivityRepository,
+) LabelService {
+	return &labelService{
+		labelRepo:      labelRepo,
+		submissionRepo: submissionRepo,
+		activityRepo:   activityRepo,
+	}
+}
+
+func (s *labelService) Label(professorID, submissionID uint, label, notes string) (*models.SubmissionLabel, error) {
+	submission, err := s.ownedSubmission(professorID, submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &models.SubmissionLabel{
+		SubmissionID: submission.ID,
+		ActivityID:   submission.ActivityID,
+		ProfessorID:  professorID,
+		Label:        label,
+		Notes:        notes,
+	}
+
+	if err := s.labelRepo.Create(entry); err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+func (s *labelService) History(professorID, submissionID uint) ([]models.SubmissionLabel, error) {
+	if _, err := s.ownedSubmission(professorID, submissionID); err != nil {
+		return nil, err
+	}
+	return s.labelRepo.FindBySubmissionID(submissionID)
+}
+
+func (s *labelService) Export(w io.Writer, professorID, activityID uint) error {
+	var activityIDs []uint
+	if activityID != 0 {
+		activity, err := s.activityRepo.FindByID(activityID)
+		if err != nil {
+			return err
+		}
+		if activity.ProfessorID != professorID {
+			return ErrNotActivityOwner
+		}
+		activityIDs = []uint{activity.ID}
+	} else {
+		activities, err := s.activityRepo.FindByProfessorID(professorID)
+		if err != nil {
+			return err
+		}
+		for _, activity := range activities {
+			activityIDs = append(activityIDs, activity.ID)
+		}
+	}
+
+	submissions := []models.Submission{}
+	if len(activityIDs) > 0 {
+		var err error
+		submissions, err = s.submissionRepo.FindLabeledByActivityIDs(activityIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer := csv.NewWriter(w)
+
+	header := []string{scoring.ColumnSubmissionID, "activity_id", scoring.ColumnLabel, "label_class", "authorship_score"}
+	for _, detector := range exportedDetectors {
+		header = append(header, detector+"_score")
+	}
+	header = append(header, scoring.Features...)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for i := range submissions {
+		submission := &submissions[i]
+		label, ok := trainingLabels[submission.Label]
+		if !ok {
+			continue
+		}
+		features := submissionFeatures(submission)
+
+		record := []string{
+			strconv.FormatUint(uint64(submission.ID), 10),
+			strconv.FormatUint(uint64(submission.ActivityID), 10),
+			label,
+			submission.Label,
+			strconv.FormatFloat(submission.AuthorshipScore, 'f', -1, 64),
+		}
+		// Detectors that were skipped or did not run are left empty
+		scores := detectorScores(submission)
+		for _, detector := range exportedDetectors {
+			score, ok := scores[detector]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, strconv.FormatFloat(score, 'f', -1, 64))
+		}
+		// Missing features are left empty, so training sees them as missing
+		for _, name := range scoring.Features {
+			value, ok := features[name]
+			if !ok {
+				record = append(record, "")
+				continue
+			}
+			record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+		}
+
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func (s *labelService) ownedSubmission(professorID, submissionID uint) (*models.Submission, error) {
+	submission, err := s.submissionRepo.FindByID(submissionID)
+	if err != nil {
+		return nil, ErrSubmissionNotFound
+	}
+
+	activity, err := s.activityRepo.FindByID(submission.ActivityID)
+	if err != nil || activity.ProfessorID != professorID {
+		return nil, ErrNotActivityOwner
+	}
+
+	return submission, nil
+}
+
+// submissionFeatures rebuilds the telemetry features stored on a
+// submission. Features the session did not produce are left out.
+func submissionFeatures(submission *models.Submission) map[string]float64 {
+	features := map[string]float64{
+		"avgKeystrokeInterval": submission.AvgKeystrokeInterval,
+		"stdKeystrokeInterval": submission.StdKeystrokeInterval,
+		"pasteEvents":          float64(submission.PasteEvents),
+		"pasteCharRatio":       submission.PasteCharRatio,
+		"deleteRatio":          submission.DeleteRatio,
+		"focusLossCount":       float64(submission.FocusLossCount),
+		"linearEditingScore":   submission.LinearEditingScore,
+		"burstiness":           submission.Burstiness,
+		"timeToFirstRun":       submission.TimeToFirstRun,
+		"executionCount":       float64(submission.ExecutionCount),
+		"totalTime":            submission.TotalTime,
+		"totalKeystrokes":      float64(submission.KeystrokeCount),
+	}
+	if submission.NonLinearNavigation != nil {
+		features["nonLinearNavigationRatio"] = *submission.NonLinearNavigation
+	}
+	if submission.UndoFrequency != nil {
+		features["undoFrequency"] = *submission.UndoFrequency
+	}
+	return features
+}
+
+// detectorScores maps the detectors that ran on a submission to their score
+func detectorScores(submission *models.Submission) map[string]float64 {
+	scores := map[string]float64{}
+	for _, result := range submission.DetectorArray {
+		if !result.Skipped {
+			scores[result.Detector] = result.Score
+		}
+	}
+	return scores
+}
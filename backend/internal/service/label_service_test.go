@@ -0,0 +1,75 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func (r *fakeSubmissionRepo) FindLabeledByActivityIDs(activityIDs []uint) ([]models.Submission, error) {
+	return append([]models.Submission(nil), r.submissions...), nil
+}
+
+func TestExportLeavesOutInconclusiveAndAddsDetectorScores(t *testing.T) {
+	submissionRepo := &fakeSubmissionRepo{submissions: []models.Submission{
+		{
+			ID: 1, ActivityID: 1, Label: models.LabelConfirmedCopied, AuthorshipScore: 0.2,
+			DetectorArray: []models.DetectorResult{
+				{Detector: TimelineDetectorName, Score: 0.25},
+				{Detector: StylometryDetectorName, Score: 0.45},
+				{Detector: TypingConsistencyDetectorName, Score: 0.5},
+				{Detector: IdentityDetectorName, Skipped: true},
+			},
+		},
+		{ID: 2, ActivityID: 1, Label: models.LabelInconclusive, AuthorshipScore: 0.5},
+		{ID: 3, ActivityID: 1, Label: models.LabelConfirmedAuthored, AuthorshipScore: 0.9},
+	}}
+	service := NewLabelService(nil, submissionRepo, &fakeActivityRepo{activity: models.Activity{ID: 1, ProfessorID: 4}})
+
+	var buf bytes.Buffer
+	if err := service.Export(&buf, 4, 1); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 3 {
+		t.Fatalf("got %d rows, want the header and the 2 conclusive submissions", len(records))
+	}
+	columns := map[string]int{}
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+
+	copied, authored := records[1], records[2]
+	if copied[columns["submission_id"]] != "1" || authored[columns["submission_id"]] != "3" {
+		t.Fatalf("exported submissions %s and %s, want 1 and 3", copied[0], authored[0])
+	}
+	if copied[columns["label"]] != "1" || authored[columns["label"]] != "0" {
+		t.Errorf("labels = %s and %s, want 1 and 0", copied[columns["label"]], authored[columns["label"]])
+	}
+
+	want := map[string]string{
+		"timeline_score":           "0.25",
+		"stylometry_score":         "0.45",
+		"typing_consistency_score": "0.5",
+		"keystroke_identity_score": "",
+	}
+	for column, value := range want {
+		i, ok := columns[column]
+		if !ok {
+			t.Errorf("missing %s column", column)
+			continue
+		}
+		if copied[i] != value {
+			t.Errorf("%s = %q, want %q", column, copied[i], value)
+		}
+		if authored[i] != "" {
+			t.Errorf("%s = %q without detector results, want it empty", column, authored[i])
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"encoding/json"
+
+	"dalivim/internal/models"
+)
+
+const (
+	// A cursor move of more than this many lines is a jump, not typing flow
+	navigationJumpLines = 3
+	// Below this many cursor events the navigation ratio is not meaningful
+	minCursorEvents = 20
+)
+
+// decodeEvents converts one RawEvents entry into typed events. Missing or
+// malformed entries yield no events.
+func decodeEvents(rawEvents map[string]interface{}, key string, out interface{}) bool {
+	value, ok := rawEvents[key]
+	if !ok {
+		return false
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, out) == nil
+}
+
+// decodeStoredEvents is decodeEvents for the RawEvents JSON of a stored
+// telemetry row
+func decodeStoredEvents(rawEvents, key string, out interface{}) bool {
+	var entries map[string]json.RawMessage
+	if rawEvents == "" || json.Unmarshal([]byte(rawEvents), &entries) != nil {
+		return false
+	}
+
+	value, ok := entries[key]
+	if !ok {
+		return false
+	}
+	return json.Unmarshal(value, out) == nil
+}
+
+// deriveNavigationFeatures computes navigation features from the cursor,
+// selection, undo/redo, scroll and find/replace events of a batch and adds
+// them to features. Features are only overwritten for event kinds present in
+// the batch, so clients that do not send them keep their own values.
+func deriveNavigationFeatures(features, rawEvents map[string]interface{}) {
+	var cursor []models.CursorEvent
+	if decodeEvents(rawEvents, "cursorEvents", &cursor) {
+		features["cursorEvents"] = float64(len(cursor))
+		features["nonLinearNavigationRatio"] = nonLinearNavigationRatio(cursor)
+	}
+
+	var undoRedo []models.UndoRedoEvent
+	if decodeEvents(rawEvents, "undoRedoEvents", &undoRedo) {
+		undos, redos := 0, 0
+		for _, event := range undoRedo {
+			switch event.Type {
+			case "undo":
+				undos++
+			case "redo":
+				redos++
+			}
+		}
+
+		features["undoCount"] = float64(undos)
+		features["redoCount"] = float64(redos)
+
+		// Undos per 100 keystrokes
+		keystrokes := getFloat(features, "totalKeystrokes")
+		if keystrokes > 0 {
+			features["undoFrequency"] = float64(undos) / keystrokes * 100
+		} else {
+			features["undoFrequency"] = 0.0
+		}
+	}
+
+	var selections []models.SelectionEvent
+	if decodeEvents(rawEvents, "selectionEvents", &selections) {
+		features["selectionCount"] = float64(len(selections))
+	}
+
+	var scrolls []models.ScrollEvent
+	if decodeEvents(rawEvents, "scrollEvents", &scrolls) {
+		features["scrollCount"] = float64(len(scrolls))
+	}
+
+	var findReplace []models.FindReplaceEvent
+	if decodeEvents(rawEvents, "findReplaceEvents", &findReplace) {
+		features["findReplaceCount"] = float64(len(findReplace))
+	}
+}
+
+// nonLinearNavigationRatio is the share of cursor moves that go backwards or
+// jump several lines. Someone writing code top to bottom from another source
+// rarely navigates; someone authoring it revisits earlier lines constantly.
+func nonLinearNavigationRatio(events []models.CursorEvent) float64 {
+	if len(events) < 2 {
+		return 0.0
+	}
+
+	nonLinear := 0
+	for i := 1; i < len(events); i++ {
+		delta := events[i].Line - events[i-1].Line
+		backwards := delta < 0 || (delta == 0 && events[i].Column < events[i-1].Column-1)
+		if backwards || delta > navigationJumpLines {
+			nonLinear++
+		}
+	}
+
+	return float64(nonLinear) / float64(len(events)-1)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestNonLinearNavigationRatio(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []models.CursorEvent
+		want   float64
+	}{
+		{name: "no events"},
+		{name: "single event", events: []models.CursorEvent{{Line: 1, Column: 1}}},
+		{
+			name: "typing top to bottom",
+			events: []models.CursorEvent{
+				{Line: 1, Column: 1}, {Line: 1, Column: 2}, {Line: 1, Column: 3},
+				{Line: 2, Column: 1}, {Line: 3, Column: 1},
+			},
+		},
+		{
+			name: "backspace is not a move back",
+			events: []models.CursorEvent{
+				{Line: 1, Column: 5}, {Line: 1, Column: 4}, {Line: 1, Column: 5},
+			},
+		},
+		{
+			name: "back to an earlier line",
+			events: []models.CursorEvent{
+				{Line: 5, Column: 1}, {Line: 6, Column: 1}, {Line: 2, Column: 1}, {Line: 2, Column: 2},
+			},
+			want: 1.0 / 3,
+		},
+		{
+			name: "back within the line",
+			events: []models.CursorEvent{
+				{Line: 1, Column: 10}, {Line: 1, Column: 3},
+			},
+			want: 1,
+		},
+		{
+			name: "jump several lines down",
+			events: []models.CursorEvent{
+				{Line: 1, Column: 1}, {Line: 4, Column: 1}, {Line: 20, Column: 1},
+			},
+			want: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ratio := nonLinearNavigationRatio(tt.events); !almostEqual(ratio, tt.want) {
+				t.Errorf("nonLinearNavigationRatio = %v, want %v", ratio, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveNavigationFeatures(t *testing.T) {
+	tests := []struct {
+		name      string
+		features  string
+		rawEvents string
+		want      map[string]float64
+		missing   []string
+	}{
+		{
+			name:      "no raw events",
+			features:  `{"totalKeystrokes": 100}`,
+			rawEvents: `{}`,
+			missing:   []string{"cursorEvents", "nonLinearNavigationRatio", "undoCount", "undoFrequency", "selectionCount"},
+		},
+		{
+			name:      "empty lists",
+			features:  `{"totalKeystrokes": 100}`,
+			rawEvents: `{"cursorEvents": [], "undoRedoEvents": [], "selectionEvents": [], "scrollEvents": [], "findReplaceEvents": []}`,
+			want: map[string]float64{
+				"cursorEvents": 0, "nonLinearNavigationRatio": 0,
+				"undoCount": 0, "redoCount": 0, "undoFrequency": 0,
+				"selectionCount": 0, "scrollCount": 0, "findReplaceCount": 0,
+			},
+		},
+		{
+			name:     "events of every kind",
+			features: `{"totalKeystrokes": 200}`,
+			rawEvents: `{
+				"cursorEvents": [
+					{"lineNumber": 1, "column": 1}, {"lineNumber": 2, "column": 1},
+					{"lineNumber": 1, "column": 4}
+				],
+				"undoRedoEvents": [{"type": "undo"}, {"type": "undo"}, {"type": "redo"}, {"type": "other"}],
+				"selectionEvents": [{"startLineNumber": 1}],
+				"scrollEvents": [{"firstVisibleLine": 1}, {"firstVisibleLine": 20}],
+				"findReplaceEvents": [{"type": "find"}]
+			}`,
+			want: map[string]float64{
+				"cursorEvents": 3, "nonLinearNavigationRatio": 0.5,
+				"undoCount": 2, "redoCount": 1, "undoFrequency": 1,
+				"selectionCount": 1, "scrollCount": 2, "findReplaceCount": 1,
+			},
+		},
+		{
+			name:      "undos without keystrokes",
+			features:  `{}`,
+			rawEvents: `{"undoRedoEvents": [{"type": "undo"}]}`,
+			want:      map[string]float64{"undoCount": 1, "undoFrequency": 0},
+		},
+		{
+			name:      "malformed entries keep the client values",
+			features:  `{"totalKeystrokes": 100, "cursorEvents": 7, "nonLinearNavigationRatio": 0.4, "undoCount": 3}`,
+			rawEvents: `{"cursorEvents": "not a list", "undoRedoEvents": [{"type": 5}], "selectionEvents": {"startLineNumber": 1}}`,
+			want:      map[string]float64{"cursorEvents": 7, "nonLinearNavigationRatio": 0.4, "undoCount": 3},
+			missing:   []string{"undoFrequency", "selectionCount"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			features := decodeJSON(t, tt.features)
+			deriveNavigationFeatures(features, decodeJSON(t, tt.rawEvents))
+
+			for name, want := range tt.want {
+				value, ok := features[name].(float64)
+				if !ok || !almostEqual(value, want) {
+					t.Errorf("%s = %v, want %v", name, features[name], want)
+				}
+			}
+			for _, name := range tt.missing {
+				if value, ok := features[name]; ok {
+					t.Errorf("%s = %v, want it unset", name, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+var ErrLateSubmissionRejected = errors.New("final submission arrived after the deadline and this activity does not accept late submissions")
+
+// Late submission policies, set per activity
+const (
+	LatePolicyAccept = "accept"
+	LatePolicyFlag   = "flag"
+	LatePolicyReject = "reject"
+)
+
+// Integrity signals raised for late final submissions
+const (
+	SignalLateSubmission         = "late_submission"
+	SignalLateSubmissionOutage   = "late_submission_after_outage"
+	SignalOfflineBufferedBatches = "offline_buffered_batches"
+)
+
+const (
+	// A batch received this long after it was produced is considered buffered
+	lateBatchThreshold = 30 * time.Second
+	// Buffered batches this close to a previous outage extend it
+	outageMergeGap = time.Minute
+	// Tolerance for clock drift when comparing client timestamps to deadlines
+	deadlineGrace = 2 * time.Minute
+)
+
+// isLateBatch compares the batch's timestamp with its upload time, both
+// taken from the client clock: the server clock would flag every batch of a
+// student whose clock is off. Without sentAt only the client's buffered flag
+// is trusted.
+func isLateBatch(batch TelemetryBatch) bool {
+	if batch.Buffered {
+		return true
+	}
+	return batch.SentAt > 0 && batch.SentAt-batch.Timestamp > lateBatchThreshold.Milliseconds()
+}
+
+// recordOutage opens or extends the outage window covering a late batch.
+// The window is kept in client time, like the batch timestamps; receivedAt
+// only stands in for a missing sentAt.
+func (s *telemetryService) recordOutage(batch TelemetryBatch, receivedAt int64) (*models.TelemetryOutage, error) {
+	endedAt := receivedAt
+	if batch.SentAt > 0 {
+		endedAt = batch.SentAt
+	}
+
+	latest, err := s.outageRepo.FindLatest(batch.ActivityID, batch.StudentID, batch.SessionID)
+	if err == nil && batch.Timestamp <= latest.EndedAt+outageMergeGap.Milliseconds() {
+		if batch.Timestamp < latest.StartedAt {
+			latest.StartedAt = batch.Timestamp
+		}
+		if endedAt > latest.EndedAt {
+			latest.EndedAt = endedAt
+		}
+		latest.BufferedBatches++
+		return latest, s.outageRepo.Update(latest)
+	}
+
+	outage := &models.TelemetryOutage{
+		ActivityID:      batch.ActivityID,
+		StudentID:       batch.StudentID,
+		SessionID:       batch.SessionID,
+		StartedAt:       batch.Timestamp,
+		EndedAt:         endedAt,
+		BufferedBatches: 1,
+	}
+	return outage, s.outageRepo.Create(outage)
+}
+
+// checkLateFinal applies the activity's late policy to a final submission.
+// The deadline is the session start plus the activity time limit. It returns
+// the integrity signal to record, if any, or ErrLateSubmissionRejected.
+// Finals of a closed activity are rejected with ErrActivityClosed whatever
+// the policy: the cohort pass already ran when it closed.
+func checkLateFinal(
+	batch TelemetryBatch,
+	session *models.TelemetrySession,
+	activity *models.Activity,
+	receivedAt int64,
+) (string, error) {
+	if activity != nil && activity.ClosedAt != nil {
+		return "", ErrActivityClosed
+	}
+	if session == nil || activity == nil || activity.TimeLimit <= 0 {
+		return "", nil
+	}
+
+	deadline := session.CreatedAt.
+		Add(time.Duration(activity.TimeLimit) * time.Minute).
+		Add(deadlineGrace).
+		UnixMilli()
+
+	if receivedAt <= deadline {
+		return "", nil
+	}
+
+	// Produced after the deadline: late regardless of connectivity
+	if batch.Timestamp > deadline {
+		return SignalLateSubmission, nil
+	}
+
+	// Produced in time but delivered late, typically after a network gap
+	switch activity.LatePolicy {
+	case LatePolicyAccept:
+		return "", nil
+	case LatePolicyReject:
+		return "", ErrLateSubmissionRejected
+	default:
+		return SignalLateSubmissionOutage, nil
+	}
+}
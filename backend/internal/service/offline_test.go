@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsLateBatchUsesClientClock(t *testing.T) {
+	serverNow := time.Now().UnixMilli()
+	skew := (10 * time.Minute).Milliseconds()
+
+	tests := []struct {
+		name  string
+		batch TelemetryBatch
+		late  bool
+	}{
+		{
+			name:  "client clock behind, sent right away",
+			batch: TelemetryBatch{Timestamp: serverNow - skew - 1000, SentAt: serverNow - skew},
+		},
+		{
+			name:  "client clock ahead, sent right away",
+			batch: TelemetryBatch{Timestamp: serverNow + skew - 1000, SentAt: serverNow + skew},
+		},
+		{
+			name:  "client clock behind, held for two minutes",
+			batch: TelemetryBatch{Timestamp: serverNow - skew - 120000, SentAt: serverNow - skew},
+			late:  true,
+		},
+		{
+			name:  "flagged buffered",
+			batch: TelemetryBatch{Timestamp: serverNow, SentAt: serverNow, Buffered: true},
+			late:  true,
+		},
+		{
+			name:  "no sentAt, old timestamp",
+			batch: TelemetryBatch{Timestamp: serverNow - skew},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if late := isLateBatch(tt.batch); late != tt.late {
+				t.Errorf("isLateBatch = %v, want %v", late, tt.late)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"dalivim/internal/models"
+)
+
+// Paste sources, from benign to suspicious
+const (
+	PasteSourceTrivial  = "trivial"  // Too short to attribute
+	PasteSourceSelf     = "self"     // Copied earlier within the same editor
+	PasteSourceStarter  = "starter"  // Taken from the starter code or description
+	PasteSourcePeer     = "peer"     // Matches another student's submission
+	PasteSourceExternal = "external" // Anything else
+)
+
+// Pastes with fewer significant characters than this are not attributed
+const minAttributableChars = 10
+
+// PasteProvenance is the classification of one paste event
+type PasteProvenance struct {
+	Timestamp           int64  `json:"timestamp"`
+	Length              int    `json:"length"`
+	Source              string `json:"source"`
+	MatchedSubmissionID uint   `json:"matchedSubmissionId,omitempty"`
+	MatchedStudentID    uint   `json:"matchedStudentId,omitempty"`
+}
+
+// classifyPastes attributes each paste to its most likely origin. Sources are
+// tried from benign to suspicious, so a snippet that is both in the starter
+// code and in a peer's submission counts as starter code.
+func classifyPastes(
+	pastes []models.PasteEvent,
+	copies []models.CopyEvent,
+	activity *models.Activity,
+	peers []models.Submission,
+) []PasteProvenance {
+	var starter string
+	if activity != nil {
+		starter = normalizeSnippet(activity.StarterCode + "\n" + activity.Description)
+	}
+
+	normalizedPeers := make([]string, len(peers))
+	for i, peer := range peers {
+		normalizedPeers[i] = normalizeSnippet(peer.Code)
+	}
+
+	result := make([]PasteProvenance, 0, len(pastes))
+	for _, paste := range pastes {
+		provenance := PasteProvenance{Timestamp: paste.Timestamp, Length: paste.Length}
+		content := normalizeSnippet(paste.Content)
+
+		switch {
+		case len(content) < minAttributableChars:
+			provenance.Source = PasteSourceTrivial
+		case copiedBefore(content, paste.Timestamp, copies):
+			provenance.Source = PasteSourceSelf
+		case starter != "" && strings.Contains(starter, content):
+			provenance.Source = PasteSourceStarter
+		default:
+			provenance.Source = PasteSourceExternal
+			for i, peer := range normalizedPeers {
+				if strings.Contains(peer, content) {
+					provenance.Source = PasteSourcePeer
+					provenance.MatchedSubmissionID = peers[i].ID
+					provenance.MatchedStudentID = peers[i].StudentID
+					break
+				}
+			}
+		}
+
+		result = append(result, provenance)
+	}
+
+	return result
+}
+
+// matchLaterPeer checks the external pastes of an earlier submission against
+// the code of a later one. A student who pastes from a classmate's work is
+// only matched when saving if the classmate submitted first, so each new
+// submission is also checked the other way. It returns the updated
+// provenance and whether any paste now matches.
+func matchLaterPeer(earlier, later *models.Submission) ([]PasteProvenance, bool) {
+	var pastes []models.PasteEvent
+	var provenance []PasteProvenance
+	if json.Unmarshal([]byte(earlier.PasteEventDetails), &pastes) != nil ||
+		json.Unmarshal([]byte(earlier.PasteProvenance), &provenance) != nil ||
+		len(pastes) != len(provenance) {
+		return nil, false
+	}
+
+	code := normalizeSnippet(later.Code)
+	matched := false
+	for i := range provenance {
+		if provenance[i].Source != PasteSourceExternal {
+			continue
+		}
+		if strings.Contains(code, normalizeSnippet(pastes[i].Content)) {
+			provenance[i].Source = PasteSourcePeer
+			provenance[i].MatchedSubmissionID = later.ID
+			provenance[i].MatchedStudentID = later.StudentID
+			matched = true
+		}
+	}
+	return provenance, matched
+}
+
+// pasteProvenanceFeatures adds per-source pasted character counts to features
+func pasteProvenanceFeatures(features map[string]interface{}, provenance []PasteProvenance) {
+	chars := map[string]float64{}
+	peerPastes := 0
+	for _, p := range provenance {
+		chars[p.Source] += float64(p.Length)
+		if p.Source == PasteSourcePeer {
+			peerPastes++
+		}
+	}
+
+	features["pasteSelfChars"] = chars[PasteSourceSelf]
+	features["pasteStarterChars"] = chars[PasteSourceStarter]
+	features["pastePeerChars"] = chars[PasteSourcePeer]
+	features["pasteExternalChars"] = chars[PasteSourceExternal]
+	features["pasteTrivialChars"] = chars[PasteSourceTrivial]
+	features["pastePeerCount"] = float64(peerPastes)
+}
+
+// copiedBefore reports whether the content was copied or cut inside the
+// editor before it was pasted
+func copiedBefore(content string, pastedAt int64, copies []models.CopyEvent) bool {
+	for _, c := range copies {
+		if c.Timestamp > pastedAt {
+			continue
+		}
+		copied := normalizeSnippet(c.Content)
+		if copied == "" {
+			continue
+		}
+		// Both sides are truncated to 200 characters, so either may contain
+		// the other
+		if strings.Contains(copied, content) || strings.Contains(content, copied) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeSnippet drops whitespace so indentation and line endings do not
+// prevent a match
+func normalizeSnippet(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// Live student statuses
+const (
+	StatusOnline    = "online"
+	StatusIdle      = "idle"
+	StatusFocusLost = "focus_lost"
+	StatusOffline   = "offline"
+	StatusSubmitted = "submitted"
+)
+
+// Thresholds used to derive statuses and raise alerts on the live feed
+const (
+	liveIdleAfter       = 60 * time.Second
+	liveOfflineAfter    = 3 * time.Minute
+	liveSweepInterval   = 10 * time.Second
+	liveLowScore        = 0.5
+	liveSubscriberQueue = 64
+)
+
+// StudentStatus is the live view of one student in an activity
+type StudentStatus struct {
+	StudentID        uint     `json:"studentId"`
+	SessionID        uint     `json:"sessionId"`
+	Status           string   `json:"status"`
+	CharactersTyped  int      `json:"charactersTyped"`
+	CodeLength       int      `json:"codeLength"`
+	PasteEvents      int      `json:"pasteEvents"`
+	FocusLossCount   int      `json:"focusLossCount"`
+	ExecutionCount   int      `json:"executionCount"`
+	LastRunAt        int64    `json:"lastRunAt,omitempty"`
+	AuthorshipScore  float64  `json:"authorshipScore"`
+	Confidence       string   `json:"confidence"`
+	Signals          []string `json:"signals"`
+	LastSeenAt       int64    `json:"lastSeenAt"`
+	IntegrityProblem bool     `json:"integrityProblem"`
+}
+
+// LiveAlert is raised when a student crosses a proctoring threshold
+type LiveAlert struct {
+	StudentID uint   `json:"studentId"`
+	Type      string `json:"type"` // "paste_detected", "focus_lost", "low_authorship_score", "integrity_issue"
+	Message   string `json:"message"`
+	At        int64  `json:"at"`
+}
+
+// LiveUpdate is one message of the proctoring feed
+type LiveUpdate struct {
+	Type     string          `json:"type"` // "snapshot", "status" or "alert"
+	Students []StudentStatus `json:"students,omitempty"`
+	Student  *StudentStatus  `json:"student,omitempty"`
+	Alert    *LiveAlert      `json:"alert,omitempty"`
+}
+
+type ProctoringService interface {
+	// Observe updates the live status of a student from a processed batch
+	Observe(batch TelemetryBatch, analysis AnalysisResult, integrity string)
+	// Subscribe returns the feed of an activity; the first update is a
+	// snapshot of every student seen so far
+	Subscribe(activityID uint) (<-chan LiveUpdate, func())
+	// Forget drops the feed of a closed activity and ends its subscriptions
+	Forget(activityID uint)
+	// Run periodically demotes silent students to idle/offline. It blocks.
+	Run()
+}
+
+type liveActivity struct {
+	students    map[uint]*StudentStatus
+	subscribers map[chan LiveUpdate]struct{}
+}
+
+type proctoringService struct {
+	mu         sync.Mutex
+	activities map[uint]*liveActivity
+}
+
+func NewProctoringService() ProctoringService {
+	return &proctoringService{
+		activities: make(map[uint]*liveActivity),
+	}
+}
+
+func (s *proctoringService) Observe(batch TelemetryBatch, analysis AnalysisResult, integrity string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity := s.activity(batch.ActivityID)
+	now := time.Now().UnixMilli()
+
+	status, ok := activity.students[batch.StudentID]
+	if !ok {
+		status = &StudentStatus{StudentID: batch.StudentID, AuthorshipScore: 1.0}
+		activity.students[batch.StudentID] = status
+	}
+	previous := *status
+
+	features := batch.Features
+	status.SessionID = batch.SessionID
+	status.CharactersTyped = getInt(features, "totalKeystrokes")
+	status.CodeLength = getInt(features, "codeLength")
+	status.PasteEvents = getInt(features, "pasteEvents")
+	status.FocusLossCount = getInt(features, "focusLossCount")
+	status.ExecutionCount = getInt(features, "executionCount")
+	if status.ExecutionCount > previous.ExecutionCount {
+		status.LastRunAt = batch.Timestamp
+	}
+	status.AuthorshipScore = analysis.AuthorshipScore
+	status.Confidence = analysis.Confidence
+	status.Signals = analysis.Signals
+	status.LastSeenAt = now
+	if integrity != integrityOK {
+		status.IntegrityProblem = true
+	}
+
+	switch {
+	case batch.IsFinal:
+		status.Status = StatusSubmitted
+	case lastFocusEventIsBlur(batch.RawEvents):
+		status.Status = StatusFocusLost
+	default:
+		status.Status = StatusOnline
+	}
+
+	snapshot := *status
+	activity.broadcast(LiveUpdate{Type: "status", Student: &snapshot})
+
+	// Alerts are raised only when a threshold is crossed, not on every batch
+	if status.PasteEvents > previous.PasteEvents {
+		activity.alert(status.StudentID, "paste_detected", "Student pasted content into the editor", now)
+	}
+	if status.Status == StatusFocusLost && previous.Status != StatusFocusLost {
+		activity.alert(status.StudentID, "focus_lost", "Student left the exam window", now)
+	}
+	if status.AuthorshipScore < liveLowScore && (!ok || previous.AuthorshipScore >= liveLowScore) {
+		activity.alert(status.StudentID, "low_authorship_score", "Provisional authorship score dropped below threshold", now)
+	}
+	if status.IntegrityProblem && !previous.IntegrityProblem {
+		activity.alert(status.StudentID, "integrity_issue", "Telemetry failed integrity verification: "+integrity, now)
+	}
+}
+
+func (s *proctoringService) Subscribe(activityID uint) (<-chan LiveUpdate, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity := s.activity(activityID)
+	ch := make(chan LiveUpdate, liveSubscriberQueue)
+
+	students := make([]StudentStatus, 0, len(activity.students))
+	for _, status := range activity.students {
+		students = append(students, *status)
+	}
+	ch <- LiveUpdate{Type: "snapshot", Students: students}
+
+	activity.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := activity.subscribers[ch]; ok {
+			delete(activity.subscribers, ch)
+			close(ch)
+		}
+		s.evict(activityID, activity)
+	}
+
+	return ch, unsubscribe
+}
+
+func (s *proctoringService) Forget(activityID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activity, ok := s.activities[activityID]
+	if !ok {
+		return
+	}
+	for ch := range activity.subscribers {
+		delete(activity.subscribers, ch)
+		close(ch)
+	}
+	delete(s.activities, activityID)
+}
+
+func (s *proctoringService) Run() {
+	ticker := time.NewTicker(liveSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.sweep()
+	}
+}
+
+// sweep demotes students that stopped sending telemetry
+func (s *proctoringService) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for activityID, activity := range s.activities {
+		for _, status := range activity.students {
+			if status.Status == StatusSubmitted || status.Status == StatusOffline {
+				continue
+			}
+
+			silence := now.Sub(time.UnixMilli(status.LastSeenAt))
+			next := status.Status
+			if silence >= liveOfflineAfter {
+				next = StatusOffline
+			} else if silence >= liveIdleAfter && status.Status == StatusOnline {
+				next = StatusIdle
+			}
+
+			if next != status.Status {
+				status.Status = next
+				snapshot := *status
+				activity.broadcast(LiveUpdate{Type: "status", Student: &snapshot})
+			}
+		}
+		s.evict(activityID, activity)
+	}
+}
+
+// evict drops an activity nobody watches once every student submitted or
+// went offline, so finished activities do not stay in memory. It must be
+// called with s.mu held.
+func (s *proctoringService) evict(activityID uint, activity *liveActivity) {
+	if s.activities[activityID] != activity || len(activity.subscribers) > 0 {
+		return
+	}
+	for _, status := range activity.students {
+		if status.Status != StatusSubmitted && status.Status != StatusOffline {
+			return
+		}
+	}
+	delete(s.activities, activityID)
+}
+
+// activity must be called with s.mu held
+func (s *proctoringService) activity(activityID uint) *liveActivity {
+	activity, ok := s.activities[activityID]
+	if !ok {
+		activity = &liveActivity{
+			students:    make(map[uint]*StudentStatus),
+			subscribers: make(map[chan LiveUpdate]struct{}),
+		}
+		s.activities[activityID] = activity
+	}
+	return activity
+}
+
+func (a *liveActivity) alert(studentID uint, alertType, message string, at int64) {
+	a.broadcast(LiveUpdate{
+		Type:  "alert",
+		Alert: &LiveAlert{StudentID: studentID, Type: alertType, Message: message, At: at},
+	})
+}
+
+// broadcast drops updates for subscribers that are not keeping up
+func (a *liveActivity) broadcast(update LiveUpdate) {
+	for ch := range a.subscribers {
+		select {
+		case ch <- update:
+		default:
+		}
+	}
+}
+
+func lastFocusEventIsBlur(rawEvents map[string]interface{}) bool {
+	events, ok := rawEvents["focusEvents"].([]interface{})
+	if !ok || len(events) == 0 {
+		return false
+	}
+
+	last, ok := events[len(events)-1].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	eventType, _ := last["type"].(string)
+	return eventType == "blur"
+}
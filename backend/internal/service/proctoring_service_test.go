@@ -0,0 +1,52 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProctoringEvictsFinishedActivities(t *testing.T) {
+	service := NewProctoringService().(*proctoringService)
+
+	service.Observe(TelemetryBatch{ActivityID: 1, StudentID: 2}, AnalysisResult{AuthorshipScore: 1}, integrityOK)
+	_, unsubscribe := service.Subscribe(1)
+	unsubscribe()
+	if _, ok := service.activities[1]; !ok {
+		t.Fatal("activity with an online student evicted")
+	}
+
+	// The student goes silent: the sweep marks them offline and evicts
+	service.activities[1].students[2].LastSeenAt = time.Now().Add(-liveOfflineAfter).UnixMilli()
+	service.sweep()
+	if _, ok := service.activities[1]; ok {
+		t.Error("activity kept after every student went offline")
+	}
+
+	service.Observe(TelemetryBatch{ActivityID: 3, StudentID: 2, IsFinal: true}, AnalysisResult{AuthorshipScore: 1}, integrityOK)
+	updates, unsubscribe := service.Subscribe(3)
+	service.sweep()
+	if _, ok := service.activities[3]; !ok {
+		t.Fatal("watched activity evicted")
+	}
+	unsubscribe()
+	if _, ok := service.activities[3]; ok {
+		t.Error("activity kept after its last subscriber left")
+	}
+	for range updates {
+	}
+}
+
+func TestProctoringForgetEndsSubscriptions(t *testing.T) {
+	service := NewProctoringService().(*proctoringService)
+	service.Observe(TelemetryBatch{ActivityID: 1, StudentID: 2}, AnalysisResult{AuthorshipScore: 1}, integrityOK)
+
+	updates, unsubscribe := service.Subscribe(1)
+	service.Forget(1)
+	unsubscribe() // Safe after Forget
+
+	for range updates {
+	}
+	if len(service.activities) != 0 {
+		t.Errorf("%d activities left after Forget", len(service.activities))
+	}
+}
@@ -0,0 +1,449 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+var (
+	ErrJobNotFound      = errors.New("reanalysis job not found")
+	ErrActivityNotFound = errors.New("activity not found")
+)
+
+// Job progress is saved every this many submissions
+const reanalysisProgressEvery = 10
+
+// RunSummary is the outcome of one analysis run
+type RunSummary struct {
+	RunID           uint     `json:"runId"`
+	AnalysisVersion string   `json:"analysisVersion"`
+	AuthorshipScore float64  `json:"authorshipScore"`
+	Confidence      string   `json:"confidence"`
+	ConfidenceScore float64  `json:"confidenceScore"`
+	Signals         []string `json:"signals"`
+}
+
+// AnalysisComparison sets a re-analysis against the result that was current
+// before it
+type AnalysisComparison struct {
+	SubmissionID   uint        `json:"submissionId"`
+	Before         *RunSummary `json:"before"`
+	After          RunSummary  `json:"after"`
+	ScoreDelta     float64     `json:"scoreDelta"`
+	AddedSignals   []string    `json:"addedSignals"`
+	RemovedSignals []string    `json:"removedSignals"`
+}
+
+type ReanalysisService interface {
+	StartActivity(professorID, activityID uint, apply bool) (*models.ReanalysisJob, error)
+	// StartSemester re-analyzes the professor's activities in a semester
+	StartSemester(professorID, semesterID uint, apply bool) (*models.ReanalysisJob, error)
+	GetJob(professorID, jobID uint) (*models.ReanalysisJob, error)
+	Compare(professorID, jobID uint) ([]AnalysisComparison, error)
+	Runs(professorID, submissionID uint) ([]models.AnalysisRun, error)
+}
+
+type reanalysisService struct {
+	jobRepo         repository.ReanalysisJobRepository
+	runRepo         repository.AnalysisRunRepository
+	submissionRepo  repository.SubmissionRepository
+	telemetryRepo   repository.TelemetryRepository
+	archiveRepo     repository.ArchiveRepository
+	activityRepo    repository.ActivityRepository
+	analysisService AnalysisService
+}
+
+func NewReanalysisService(
+	jobRepo repository.ReanalysisJobRepository,
+	runRepo repository.AnalysisRunRepository,
+	submissionRepo repository.SubmissionRepository,
+	telemetryRepo repository.TelemetryRepository,
+	archiveRepo repository.ArchiveRepository,
+	activityRepo repository.ActivityRepository,
+	analysisService AnalysisService,
+) ReanalysisService {
+	return &reanalysisService{
+		jobRepo:         jobRepo,
+		runRepo:         runRepo,
+		submissionRepo:  submissionRepo,
+		telemetryRepo:   telemetryRepo,
+		archiveRepo:     archiveRepo,
+		activityRepo:    activityRepo,
+		analysisService: analysisService,
+	}
+}
+
+func (s *reanalysisService) StartActivity(professorID, activityID uint, apply bool) (*models.ReanalysisJob, error) {
+	activity, err := s.activityRepo.FindByID(activityID)
+	if err != nil {
+		return nil, ErrActivityNotFound
+	}
+	if activity.ProfessorID != professorID {
+		return nil, ErrNotActivityOwner
+	}
+
+	job := &models.ReanalysisJob{
+		ProfessorID: professorID,
+		ActivityID:  &activity.ID,
+		Apply:       apply,
+		Status:      models.JobStatusPending,
+	}
+	return job, s.start(job, []uint{activity.ID})
+}
+
+func (s *reanalysisService) StartSemester(professorID, semesterID uint, apply bool) (*models.ReanalysisJob, error) {
+	activities, err := s.activityRepo.FindBySemesterID(semesterID)
+	if err != nil {
+		return nil, err
+	}
+
+	var activityIDs []uint
+	for _, activity := range activities {
+		if activity.ProfessorID == professorID {
+			activityIDs = append(activityIDs, activity.ID)
+		}
+	}
+
+	job := &models.ReanalysisJob{
+		ProfessorID: professorID,
+		SemesterID:  &semesterID,
+		Apply:       apply,
+		Status:      models.JobStatusPending,
+	}
+	return job, s.start(job, activityIDs)
+}
+
+func (s *reanalysisService) start(job *models.ReanalysisJob, activityIDs []uint) error {
+	if err := s.jobRepo.Create(job); err != nil {
+		return err
+	}
+
+	snapshot := *job
+	go s.run(&snapshot, activityIDs)
+
+	return nil
+}
+
+func (s *reanalysisService) run(job *models.ReanalysisJob, activityIDs []uint) {
+	now := time.Now()
+	job.Status = models.JobStatusRunning
+	job.StartedAt = &now
+
+	var submissions []models.Submission
+	for _, activityID := range activityIDs {
+		found, err := s.submissionRepo.FindByActivityID(activityID)
+		if err != nil {
+			s.fail(job, err)
+			return
+		}
+		submissions = append(submissions, found...)
+	}
+	job.Total = len(submissions)
+	s.save(job)
+
+	for i := range submissions {
+		changed, skipped, err := s.reanalyze(job, &submissions[i])
+		if err != nil {
+			s.fail(job, err)
+			return
+		}
+
+		job.Processed++
+		if changed {
+			job.Changed++
+		}
+		if skipped {
+			job.Skipped++
+		}
+		if job.Processed%reanalysisProgressEvery == 0 {
+			s.save(job)
+		}
+	}
+
+	finished := time.Now()
+	job.Status = models.JobStatusCompleted
+	job.FinishedAt = &finished
+	s.save(job)
+}
+
+// reanalyze runs the current analysis over the stored final telemetry of a
+// submission, archived batches included. skipped is true when that telemetry
+// is gone, or when the submission's first analysis is still pending: it will
+// use the current analysis anyway.
+func (s *reanalysisService) reanalyze(job *models.ReanalysisJob, submission *models.Submission) (changed, skipped bool, err error) {
+	if submission.AnalysisPending {
+		return false, true, nil
+	}
+
+	stored, err := loadTelemetry(s.telemetryRepo, s.archiveRepo, submission.ActivityID, submission.StudentID)
+	if err != nil {
+		return false, false, err
+	}
+
+	final := finalTelemetry(stored, submission.SessionID)
+	if final == nil || final.Features == "" {
+		return false, true, nil
+	}
+
+	features := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(final.Features), &features); err != nil {
+		return false, true, nil
+	}
+	rawEvents := map[string]interface{}{}
+	if final.RawEvents != "" {
+		json.Unmarshal([]byte(final.RawEvents), &rawEvents)
+	}
+	var provenance []PasteProvenance
+	if submission.PasteProvenance != "" {
+		json.Unmarshal([]byte(submission.PasteProvenance), &provenance)
+	}
+	// Finals are stored before their pastes are attributed
+	pasteProvenanceFeatures(features, provenance)
+	// The final batch is stored, so its events are among the stored ones.
+	// The session is only replayed when all of its batches still hold their
+	// raw events.
+	var session *SessionEvents
+	var reconciliation *CodeReconciliation
+	if replayable(stored, final) {
+		session = collectSessionEvents(stored, submission.SessionID, nil)
+		session.Start = sessionStart(final.Timestamp, features)
+		var starter string
+		if activity, err := s.activityRepo.FindByID(submission.ActivityID); err == nil {
+			starter = activity.StarterCode
+		}
+		reconciliation = reconcileCode(submission.Code, starter, session)
+	}
+
+	// Submissions analyzed before versioning get a run holding their
+	// original result, so the comparison has a before
+	if err := s.recordLegacyRun(submission); err != nil {
+		return false, false, err
+	}
+
+	analysis := s.analysisService.Analyze(AnalysisInput{
+		ActivityID: submission.ActivityID,
+		StudentID:  submission.StudentID,
+		IsFinal:    true,
+		Code:       submission.Code,
+		Features:   features,
+		RawEvents:  rawEvents,
+		Provenance: provenance,
+		Keystrokes: timingsOf(storedKeyEvents(stored)),
+
+		Session:        session,
+		Reconciliation: reconciliation,
+	})
+
+	changed = math.Abs(analysis.AuthorshipScore-submission.AuthorshipScore) > 1e-9 ||
+		!sameSignals(analysis.Signals, withoutSignal(submission.SignalsArray, rules.CohortOutlier))
+
+	run := newAnalysisRun(submission, analysis, models.AnalysisTriggerReanalysis)
+	run.JobID = &job.ID
+
+	if !job.Apply {
+		return changed, false, s.runRepo.Create(run)
+	}
+
+	applyAnalysis(submission, analysis)
+	run.Applied = true
+	return changed, false, s.runRepo.CreateApplied(run, submission)
+}
+
+// replayable reports whether the stored batches of a final's session are
+// complete: none missing and none purged of its raw events
+func replayable(stored []models.TelemetryData, final *models.TelemetryData) bool {
+	if hasSequenceGap(stored, TelemetryBatch{SessionID: final.SessionID, Sequence: final.Sequence}) {
+		return false
+	}
+	for _, telemetry := range stored {
+		if telemetry.SessionID == final.SessionID && telemetry.RawEvents == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *reanalysisService) recordLegacyRun(submission *models.Submission) error {
+	if submission.AnalysisVersion != "" {
+		return nil
+	}
+	runs, err := s.runRepo.FindBySubmissionID(submission.ID)
+	if err != nil || len(runs) > 0 {
+		return err
+	}
+
+	return s.runRepo.Create(&models.AnalysisRun{
+		SubmissionID:    submission.ID,
+		ActivityID:      submission.ActivityID,
+		Trigger:         models.AnalysisTriggerSubmission,
+		AnalysisVersion: "legacy",
+		AuthorshipScore: submission.AuthorshipScore,
+		Confidence:      submission.Confidence,
+		ConfidenceScore: submission.ConfidenceScore,
+		SignalsArray:    submission.SignalsArray,
+		DetectorArray:   submission.DetectorArray,
+		Applied:         true,
+		CreatedAt:       submission.CreatedAt,
+	})
+}
+
+// applyAnalysis makes an analysis the submission's current result. The
+// cohort result is kept, as it only changes with the cohort.
+func applyAnalysis(submission *models.Submission, analysis AnalysisResult) {
+	var cohort *models.DetectorResult
+	for i := range submission.DetectorArray {
+		if submission.DetectorArray[i].Detector == CohortDetectorName {
+			cohort = &submission.DetectorArray[i]
+		}
+	}
+
+	submission.AuthorshipScore = analysis.AuthorshipScore
+	submission.Confidence = analysis.Confidence
+	submission.ConfidenceScore = analysis.ConfidenceScore
+	submission.SignalsArray = analysis.Signals
+	submission.DetectorArray = analysis.Detectors
+	submission.BaselineDeviation = analysis.BaselineDeviation
+	submission.IdentityConsistency = analysis.IdentityConsistency
+	submission.AnalysisVersion = analysis.AnalysisVersion
+
+	if cohort != nil {
+		replaceCohortResult(submission, *cohort)
+	}
+}
+
+func (s *reanalysisService) fail(job *models.ReanalysisJob, err error) {
+	finished := time.Now()
+	job.Status = models.JobStatusFailed
+	job.Error = err.Error()
+	job.FinishedAt = &finished
+	s.save(job)
+}
+
+func (s *reanalysisService) save(job *models.ReanalysisJob) {
+	if err := s.jobRepo.Update(job); err != nil {
+		log.Printf("reanalysis job %d: %v", job.ID, err)
+	}
+}
+
+func (s *reanalysisService) GetJob(professorID, jobID uint) (*models.ReanalysisJob, error) {
+	job, err := s.jobRepo.FindByID(jobID)
+	if err != nil {
+		return nil, ErrJobNotFound
+	}
+	if job.ProfessorID != professorID {
+		return nil, ErrNotActivityOwner
+	}
+	return job, nil
+}
+
+func (s *reanalysisService) Compare(professorID, jobID uint) ([]AnalysisComparison, error) {
+	if _, err := s.GetJob(professorID, jobID); err != nil {
+		return nil, err
+	}
+
+	runs, err := s.runRepo.FindByJobID(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	comparisons := make([]AnalysisComparison, 0, len(runs))
+	for i := range runs {
+		run := &runs[i]
+		comparison := AnalysisComparison{
+			SubmissionID:   run.SubmissionID,
+			After:          summarizeRun(run),
+			AddedSignals:   run.SignalsArray,
+			RemovedSignals: []string{},
+		}
+
+		if previous, err := s.runRepo.FindPrevious(run); err == nil {
+			before := summarizeRun(previous)
+			comparison.Before = &before
+			comparison.ScoreDelta = run.AuthorshipScore - previous.AuthorshipScore
+			comparison.AddedSignals = signalDifference(run.SignalsArray, previous.SignalsArray)
+			comparison.RemovedSignals = signalDifference(previous.SignalsArray, run.SignalsArray)
+		}
+
+		comparisons = append(comparisons, comparison)
+	}
+
+	return comparisons, nil
+}
+
+func (s *reanalysisService) Runs(professorID, submissionID uint) ([]models.AnalysisRun, error) {
+	submission, err := s.submissionRepo.FindByID(submissionID)
+	if err != nil {
+		return nil, ErrSubmissionNotFound
+	}
+
+	activity, err := s.activityRepo.FindByID(submission.ActivityID)
+	if err != nil || activity.ProfessorID != professorID {
+		return nil, ErrNotActivityOwner
+	}
+
+	return s.runRepo.FindBySubmissionID(submissionID)
+}
+
+// finalTelemetry picks the final batch of the submission's session, or the
+// latest final batch for unsigned submissions
+func finalTelemetry(stored []models.TelemetryData, sessionID uint) *models.TelemetryData {
+	var final *models.TelemetryData
+	for i := range stored {
+		if !stored[i].IsFinal {
+			continue
+		}
+		if sessionID != 0 && stored[i].SessionID != sessionID {
+			continue
+		}
+		final = &stored[i]
+	}
+	return final
+}
+
+func summarizeRun(run *models.AnalysisRun) RunSummary {
+	return RunSummary{
+		RunID:           run.ID,
+		AnalysisVersion: run.AnalysisVersion,
+		AuthorshipScore: run.AuthorshipScore,
+		Confidence:      run.Confidence,
+		ConfidenceScore: run.ConfidenceScore,
+		Signals:         run.SignalsArray,
+	}
+}
+
+// signalDifference lists the signals of a missing from b
+func signalDifference(a, b []string) []string {
+	present := make(map[string]bool, len(b))
+	for _, signal := range b {
+		present[signal] = true
+	}
+
+	difference := []string{}
+	for _, signal := range a {
+		if !present[signal] {
+			difference = append(difference, signal)
+		}
+	}
+	return difference
+}
+
+func sameSignals(a, b []string) bool {
+	return len(a) == len(b) && len(signalDifference(a, b)) == 0
+}
+
+func withoutSignal(signals []string, removed string) []string {
+	kept := []string{}
+	for _, signal := range signals {
+		if signal != removed {
+			kept = append(kept, signal)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,29 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestReplayableNeedsEveryBatchWithRawEvents(t *testing.T) {
+	final := &models.TelemetryData{SessionID: 1, Sequence: 3, IsFinal: true, RawEvents: "{}"}
+	complete := []models.TelemetryData{
+		{SessionID: 1, Sequence: 1, RawEvents: "{}"},
+		{SessionID: 1, Sequence: 2, RawEvents: "{}"},
+		*final,
+	}
+	if !replayable(complete, final) {
+		t.Error("complete session not replayable")
+	}
+
+	if replayable(complete[1:], final) {
+		t.Error("session missing its first batch is replayable")
+	}
+
+	purged := append([]models.TelemetryData(nil), complete...)
+	purged[0].RawEvents = ""
+	if replayable(purged, final) {
+		t.Error("session with purged raw events is replayable")
+	}
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"dalivim/internal/archive"
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+// RetentionReport summarizes one retention pass
+type RetentionReport struct {
+	SessionsCompacted int      `json:"sessionsCompacted"`
+	RowsCompacted     int      `json:"rowsCompacted"`
+	RawPurged         int      `json:"rawPurged"`
+	ArchivesDeleted   int      `json:"archivesDeleted"`
+	Exported          []string `json:"exported"`
+}
+
+type RetentionService interface {
+	// RunOnce compacts finished per-tick telemetry and applies the retention
+	// policy of every semester
+	RunOnce() (RetentionReport, error)
+	// Run calls RunOnce on the configured interval. It blocks.
+	Run()
+}
+
+type retentionService struct {
+	archiveRepo   repository.ArchiveRepository
+	telemetryRepo repository.TelemetryRepository
+	activityRepo  repository.ActivityRepository
+	semesterRepo  repository.SemesterRepository
+	cfg           archive.Config
+}
+
+func NewRetentionService(
+	archiveRepo repository.ArchiveRepository,
+	telemetryRepo repository.TelemetryRepository,
+	activityRepo repository.ActivityRepository,
+	semesterRepo repository.SemesterRepository,
+	cfg archive.Config,
+) RetentionService {
+	return &retentionService{
+		archiveRepo:   archiveRepo,
+		telemetryRepo: telemetryRepo,
+		activityRepo:  activityRepo,
+		semesterRepo:  semesterRepo,
+		cfg:           cfg,
+	}
+}
+
+func (s *retentionService) Run() {
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		report, err := s.RunOnce()
+		if err != nil {
+			log.Printf("retention: %v", err)
+			continue
+		}
+		log.Printf("retention: compacted %d sessions (%d rows), purged raw events of %d, deleted %d archives",
+			report.SessionsCompacted, report.RowsCompacted, report.RawPurged, report.ArchivesDeleted)
+	}
+}
+
+func (s *retentionService) RunOnce() (RetentionReport, error) {
+	var report RetentionReport
+
+	if err := s.compact(&report); err != nil {
+		return report, fmt.Errorf("compaction failed: %w", err)
+	}
+
+	semesters, err := s.semesterRepo.FindAll()
+	if err != nil {
+		return report, err
+	}
+
+	// Activities without a semester follow the default policy
+	semesters = append(semesters, models.Semester{
+		RawRetentionDays:     s.cfg.DefaultRawRetentionDays,
+		FeatureRetentionDays: s.cfg.DefaultFeatureRetentionDays,
+	})
+
+	for _, semester := range semesters {
+		if err := s.applyRetention(semester, &report); err != nil {
+			return report, fmt.Errorf("retention failed for semester %d: %w", semester.ID, err)
+		}
+	}
+
+	return report, nil
+}
+
+// compact merges the non-final rows of each session into its archive
+func (s *retentionService) compact(report *RetentionReport) error {
+	before := time.Now().Add(-s.cfg.CompactAfter)
+
+	sessions, err := s.archiveRepo.FindCompactableSessions(before)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range sessions {
+		rows, err := s.archiveRepo.FindCompactableRows(key.ActivityID, key.StudentID, key.SessionID, before)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		existing, err := s.archiveRepo.FindBySession(key.ActivityID, key.StudentID, key.SessionID)
+		if err != nil {
+			existing = &models.TelemetryArchive{
+				ActivityID:     key.ActivityID,
+				StudentID:      key.StudentID,
+				SessionID:      key.SessionID,
+				FirstTimestamp: rows[0].Timestamp,
+			}
+		}
+
+		archived, err := archive.Decode(existing.Data)
+		if err != nil {
+			return err
+		}
+
+		merged := append(archived, rows...)
+		data, err := archive.Encode(merged)
+		if err != nil {
+			return err
+		}
+
+		existing.Data = data
+		existing.RowCount = len(merged)
+		if rows[0].Timestamp < existing.FirstTimestamp {
+			existing.FirstTimestamp = rows[0].Timestamp
+		}
+		if last := rows[len(rows)-1].Timestamp; last > existing.LastTimestamp {
+			existing.LastTimestamp = last
+		}
+
+		rowIDs := make([]uint, len(rows))
+		for i, row := range rows {
+			rowIDs[i] = row.ID
+		}
+
+		if err := s.archiveRepo.Compact(existing, rowIDs); err != nil {
+			return err
+		}
+
+		report.SessionsCompacted++
+		report.RowsCompacted += len(rows)
+	}
+
+	return nil
+}
+
+// applyRetention exports then drops raw events and features that outlived the
+// semester's policy. Nothing is deleted unless its export succeeded.
+func (s *retentionService) applyRetention(semester models.Semester, report *RetentionReport) error {
+	activities, err := s.activityRepo.FindBySemesterID(semester.ID)
+	if err != nil || len(activities) == 0 {
+		return err
+	}
+
+	activityIDs := make([]uint, len(activities))
+	for i, activity := range activities {
+		activityIDs[i] = activity.ID
+	}
+
+	now := time.Now()
+	stamp := now.Format("20060102T150405")
+
+	if semester.FeatureRetentionDays > 0 {
+		before := now.AddDate(0, 0, -semester.FeatureRetentionDays).UnixMilli()
+
+		archives, err := s.archiveRepo.FindExpired(activityIDs, before)
+		if err != nil {
+			return err
+		}
+
+		for i := range archives {
+			name := fmt.Sprintf("session-%d-student-%d-%s", archives[i].SessionID, archives[i].StudentID, stamp)
+			path, err := archive.Export(s.cfg.Dir, archives[i].ActivityID, name, archives[i].Data)
+			if err != nil {
+				return err
+			}
+			report.Exported = append(report.Exported, path)
+
+			if err := s.archiveRepo.Delete(&archives[i]); err != nil {
+				return err
+			}
+			report.ArchivesDeleted++
+		}
+	}
+
+	if semester.RawRetentionDays > 0 {
+		before := now.AddDate(0, 0, -semester.RawRetentionDays).UnixMilli()
+
+		archives, err := s.archiveRepo.FindRawExpired(activityIDs, before)
+		if err != nil {
+			return err
+		}
+
+		for i := range archives {
+			if err := s.purgeArchiveRaw(&archives[i], stamp, report); err != nil {
+				return err
+			}
+		}
+
+		finals, err := s.telemetryRepo.FindFinalWithRawEvents(activityIDs, before)
+		if err != nil {
+			return err
+		}
+
+		for _, final := range finals {
+			data, err := archive.Encode([]models.TelemetryData{final})
+			if err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("final-%d-student-%d-%s", final.ID, final.StudentID, stamp)
+			path, err := archive.Export(s.cfg.Dir, final.ActivityID, name, data)
+			if err != nil {
+				return err
+			}
+			report.Exported = append(report.Exported, path)
+
+			if err := s.telemetryRepo.ClearRawEvents(final.ID); err != nil {
+				return err
+			}
+			report.RawPurged++
+		}
+	}
+
+	return nil
+}
+
+// purgeArchiveRaw exports the full archive, then keeps only its features
+func (s *retentionService) purgeArchiveRaw(archived *models.TelemetryArchive, stamp string, report *RetentionReport) error {
+	name := fmt.Sprintf("session-%d-student-%d-raw-%s", archived.SessionID, archived.StudentID, stamp)
+	path, err := archive.Export(s.cfg.Dir, archived.ActivityID, name, archived.Data)
+	if err != nil {
+		return err
+	}
+	report.Exported = append(report.Exported, path)
+
+	rows, err := archive.Decode(archived.Data)
+	if err != nil {
+		return err
+	}
+	for i := range rows {
+		rows[i].RawEvents = ""
+	}
+
+	data, err := archive.Encode(rows)
+	if err != nil {
+		return err
+	}
+
+	purgedAt := time.Now()
+	archived.Data = data
+	archived.RawPurgedAt = &purgedAt
+	if err := s.archiveRepo.Update(archived); err != nil {
+		return err
+	}
+
+	report.RawPurged++
+	return nil
+}
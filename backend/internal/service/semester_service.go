@@ -1,39 +1,80 @@
 package service
 
 import (
+	"dalivim/internal/archive"
 	"dalivim/internal/models"
 	"dalivim/internal/repository"
+	"errors"
 	"time"
 )
 
+var (
+	ErrSemesterNotFound = errors.New("semester not found")
+	ErrSemesterExists   = errors.New("semester already exists for this year and period")
+	ErrSemesterInUse    = errors.New("semester has activities")
+	ErrInvalidSemester  = errors.New("semester period must be 1 or 2 and end after it starts")
+	ErrInvalidRetention = errors.New("retention days must be 0 (keep forever) or more, and raw events cannot outlive the features they belong to")
+	ErrNotProfessor     = errors.New("only professors can manage semesters")
+	ErrNotSemesterOwner = errors.New("only the professor who created the semester can change it")
+)
+
+// SemesterRetention sets how long a semester keeps telemetry. Nil fields
+// keep the current value, or the configured default for a new semester.
+type SemesterRetention struct {
+	RawDays     *int
+	FeatureDays *int
+}
+
 type SemesterService interface {
-	CreateSemester(year, period int, startDate, endDate time.Time) (*models.Semester, error)
-	GetActiveSemester() (*models.Semester, error)
-	GetAllSemesters() ([]models.Semester, error)
-	UpdateAllStudentSemesters() error
+	CreateSemester(professorID uint, year, period int, startDate, endDate time.Time, retention SemesterRetention) (*models.Semester, error)
+	UpdateSemester(professorID, id uint, year, period int, startDate, endDate time.Time, retention SemesterRetention) (*models.Semester, error)
+	DeleteSemester(professorID, id uint) error
+	GetSemester(professorID, id uint) (*models.Semester, error)
+	GetActiveSemester(professorID uint) (*models.Semester, error)
+	GetAllSemesters(professorID uint) ([]models.Semester, error)
+	UpdateAllStudentSemesters(professorID uint) error
 }
 
 type semesterService struct {
 	semesterRepo repository.SemesterRepository
 	userRepo     repository.UserRepository
+	activityRepo repository.ActivityRepository
+	retention    archive.Config
 }
 
 func NewSemesterService(
 	semesterRepo repository.SemesterRepository,
 	userRepo repository.UserRepository,
+	activityRepo repository.ActivityRepository,
+	retention archive.Config,
 ) SemesterService {
 	return &semesterService{
 		semesterRepo: semesterRepo,
 		userRepo:     userRepo,
+		activityRepo: activityRepo,
+		retention:    retention,
 	}
 }
 
-func (s *semesterService) CreateSemester(year, period int, startDate, endDate time.Time) (*models.Semester, error) {
+func (s *semesterService) CreateSemester(professorID uint, year, period int, startDate, endDate time.Time, retention SemesterRetention) (*models.Semester, error) {
+	if err := s.requireProfessor(professorID); err != nil {
+		return nil, err
+	}
+	if err := s.validate(0, year, period, startDate, endDate); err != nil {
+		return nil, err
+	}
+
 	semester := &models.Semester{
-		Year:      year,
-		Period:    period,
-		StartDate: startDate,
-		EndDate:   endDate,
+		Year:                 year,
+		Period:               period,
+		StartDate:            startDate,
+		EndDate:              endDate,
+		RawRetentionDays:     s.retention.DefaultRawRetentionDays,
+		FeatureRetentionDays: s.retention.DefaultFeatureRetentionDays,
+		CreatedBy:            professorID,
+	}
+	if err := applyRetention(semester, retention); err != nil {
+		return nil, err
 	}
 
 	if err := s.semesterRepo.Create(semester); err != nil {
@@ -43,18 +84,108 @@ func (s *semesterService) CreateSemester(year, period int, startDate, endDate ti
 	return semester, nil
 }
 
-func (s *semesterService) GetActiveSemester() (*models.Semester, error) {
-	return s.semesterRepo.FindActive()
+func (s *semesterService) UpdateSemester(professorID, id uint, year, period int, startDate, endDate time.Time, retention SemesterRetention) (*models.Semester, error) {
+	semester, err := s.ownedSemester(professorID, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(id, year, period, startDate, endDate); err != nil {
+		return nil, err
+	}
+
+	semester.Year = year
+	semester.Period = period
+	semester.StartDate = startDate
+	semester.EndDate = endDate
+	if err := applyRetention(semester, retention); err != nil {
+		return nil, err
+	}
+
+	if err := s.semesterRepo.Update(semester); err != nil {
+		return nil, err
+	}
+
+	return semester, nil
 }
 
-func (s *semesterService) GetAllSemesters() ([]models.Semester, error) {
+// DeleteSemester removes a semester without activities
+func (s *semesterService) DeleteSemester(professorID, id uint) error {
+	if _, err := s.ownedSemester(professorID, id); err != nil {
+		return err
+	}
+
+	activities, err := s.activityRepo.FindBySemesterID(id)
+	if err != nil {
+		return err
+	}
+	if len(activities) > 0 {
+		return ErrSemesterInUse
+	}
+
+	return s.semesterRepo.Delete(id)
+}
+
+func (s *semesterService) GetSemester(professorID, id uint) (*models.Semester, error) {
+	if err := s.requireProfessor(professorID); err != nil {
+		return nil, err
+	}
+	return s.find(id)
+}
+
+func (s *semesterService) GetActiveSemester(professorID uint) (*models.Semester, error) {
+	if err := s.requireProfessor(professorID); err != nil {
+		return nil, err
+	}
+	return s.active()
+}
+
+func (s *semesterService) GetAllSemesters(professorID uint) ([]models.Semester, error) {
+	if err := s.requireProfessor(professorID); err != nil {
+		return nil, err
+	}
 	return s.semesterRepo.FindAll()
 }
 
+func (s *semesterService) find(id uint) (*models.Semester, error) {
+	semester, err := s.semesterRepo.FindByID(id)
+	if err != nil {
+		return nil, ErrSemesterNotFound
+	}
+	return semester, nil
+}
+
+func (s *semesterService) active() (*models.Semester, error) {
+	semester, err := s.semesterRepo.FindActive()
+	if err != nil {
+		return nil, ErrSemesterNotFound
+	}
+	return semester, nil
+}
+
+// ownedSemester returns a semester the professor may change: one they
+// created, or one created before owners were recorded
+func (s *semesterService) ownedSemester(professorID, id uint) (*models.Semester, error) {
+	if err := s.requireProfessor(professorID); err != nil {
+		return nil, err
+	}
+	semester, err := s.find(id)
+	if err != nil {
+		return nil, err
+	}
+	if semester.CreatedBy != 0 && semester.CreatedBy != professorID {
+		return nil, ErrNotSemesterOwner
+	}
+	return semester, nil
+}
+
 // UpdateAllStudentSemesters recalculates the current semester for all students
-func (s *semesterService) UpdateAllStudentSemesters() error {
+func (s *semesterService) UpdateAllStudentSemesters(professorID uint) error {
+	if err := s.requireProfessor(professorID); err != nil {
+		return err
+	}
+
 	// Get active semester
-	activeSemester, err := s.GetActiveSemester()
+	activeSemester, err := s.active()
 	if err != nil {
 		return err
 	}
@@ -73,3 +204,46 @@ func (s *semesterService) UpdateAllStudentSemesters() error {
 
 	return nil
 }
+
+func (s *semesterService) requireProfessor(userID uint) error {
+	user, err := s.userRepo.FindByID(userID)
+	if err != nil || user.Role != "professor" {
+		return ErrNotProfessor
+	}
+	return nil
+}
+
+// validate checks the period and dates, and that no other semester (than
+// id) has the same year and period
+func (s *semesterService) validate(id uint, year, period int, startDate, endDate time.Time) error {
+	if period != 1 && period != 2 || !endDate.After(startDate) {
+		return ErrInvalidSemester
+	}
+
+	existing, err := s.semesterRepo.FindByYearAndPeriod(year, period)
+	if err == nil && existing.ID != id {
+		return ErrSemesterExists
+	}
+
+	return nil
+}
+
+// applyRetention sets the given retention on a semester. Raw events live in
+// the feature archives, so they cannot be kept longer than the features.
+func applyRetention(semester *models.Semester, retention SemesterRetention) error {
+	if retention.RawDays != nil {
+		semester.RawRetentionDays = *retention.RawDays
+	}
+	if retention.FeatureDays != nil {
+		semester.FeatureRetentionDays = *retention.FeatureDays
+	}
+
+	raw, feature := semester.RawRetentionDays, semester.FeatureRetentionDays
+	if raw < 0 || feature < 0 {
+		return ErrInvalidRetention
+	}
+	if feature > 0 && (raw == 0 || raw > feature) {
+		return ErrInvalidRetention
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"dalivim/internal/archive"
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+type fakeSemesterRepo struct {
+	repository.SemesterRepository
+	semesters map[uint]*models.Semester
+}
+
+func (r *fakeSemesterRepo) Create(semester *models.Semester) error {
+	semester.ID = uint(len(r.semesters) + 1)
+	copied := *semester
+	r.semesters[semester.ID] = &copied
+	return nil
+}
+
+func (r *fakeSemesterRepo) FindByID(id uint) (*models.Semester, error) {
+	semester, ok := r.semesters[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *semester
+	return &copied, nil
+}
+
+func (r *fakeSemesterRepo) FindByYearAndPeriod(year, period int) (*models.Semester, error) {
+	for _, semester := range r.semesters {
+		if semester.Year == year && semester.Period == period {
+			return semester, nil
+		}
+	}
+	return nil, errors.New("not found")
+}
+
+func (r *fakeSemesterRepo) Update(semester *models.Semester) error {
+	copied := *semester
+	r.semesters[semester.ID] = &copied
+	return nil
+}
+
+// semesterUsers are professors, except the students listed
+type semesterUsers struct {
+	repository.UserRepository
+	students map[uint]bool
+}
+
+func (r semesterUsers) FindByID(id uint) (*models.User, error) {
+	if r.students[id] {
+		return &models.User{ID: id, Role: "student"}, nil
+	}
+	return &models.User{ID: id, Role: "professor"}, nil
+}
+
+func newTestSemesterService() (SemesterService, *fakeSemesterRepo) {
+	repo := &fakeSemesterRepo{semesters: map[uint]*models.Semester{}}
+	service := NewSemesterService(repo, semesterUsers{students: map[uint]bool{3: true}}, nil, archive.Config{
+		DefaultRawRetentionDays:     365,
+		DefaultFeatureRetentionDays: 0,
+	})
+	return service, repo
+}
+
+func days(n int) *int { return &n }
+
+func TestSemesterRetention(t *testing.T) {
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 4, 0)
+
+	tests := []struct {
+		name        string
+		retention   SemesterRetention
+		raw         int
+		feature     int
+		expectedErr error
+	}{
+		{name: "defaults", raw: 365, feature: 0},
+		{name: "keep raw forever", retention: SemesterRetention{RawDays: days(0)}, raw: 0, feature: 0},
+		{name: "raw within features", retention: SemesterRetention{RawDays: days(90), FeatureDays: days(730)}, raw: 90, feature: 730},
+		{name: "negative", retention: SemesterRetention{RawDays: days(-1)}, expectedErr: ErrInvalidRetention},
+		{name: "raw outlives features", retention: SemesterRetention{FeatureDays: days(180)}, expectedErr: ErrInvalidRetention},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestSemesterService()
+
+			semester, err := service.CreateSemester(1, 2026, 2, start, end, tt.retention)
+			if !errors.Is(err, tt.expectedErr) {
+				t.Fatalf("err = %v, want %v", err, tt.expectedErr)
+			}
+			if err != nil {
+				return
+			}
+			if semester.RawRetentionDays != tt.raw || semester.FeatureRetentionDays != tt.feature {
+				t.Errorf("retention = %d/%d days, want %d/%d", semester.RawRetentionDays, semester.FeatureRetentionDays, tt.raw, tt.feature)
+			}
+		})
+	}
+}
+
+func TestUpdateSemesterKeepsOmittedRetention(t *testing.T) {
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 4, 0)
+	service, repo := newTestSemesterService()
+
+	created, err := service.CreateSemester(1, 2026, 2, start, end, SemesterRetention{RawDays: days(30)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.UpdateSemester(1, created.ID, 2026, 2, start, end.AddDate(0, 0, 7), SemesterRetention{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if raw := repo.semesters[created.ID].RawRetentionDays; raw != 30 {
+		t.Errorf("raw retention = %d days after an update without it, want 30", raw)
+	}
+}
+
+func TestOnlyTheOwnerChangesASemester(t *testing.T) {
+	start := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 4, 0)
+	service, repo := newTestSemesterService()
+
+	created, err := service.CreateSemester(1, 2026, 2, start, end, SemesterRetention{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.CreatedBy != 1 {
+		t.Fatalf("createdBy = %d, want the creating professor", created.CreatedBy)
+	}
+
+	// Professor 2 did not create it
+	if _, err := service.UpdateSemester(2, created.ID, 2026, 2, start, end, SemesterRetention{RawDays: days(0)}); !errors.Is(err, ErrNotSemesterOwner) {
+		t.Errorf("update by another professor: err = %v, want ErrNotSemesterOwner", err)
+	}
+	if err := service.DeleteSemester(2, created.ID); !errors.Is(err, ErrNotSemesterOwner) {
+		t.Errorf("delete by another professor: err = %v, want ErrNotSemesterOwner", err)
+	}
+	if raw := repo.semesters[created.ID].RawRetentionDays; raw != 365 {
+		t.Errorf("raw retention = %d days, changed by another professor", raw)
+	}
+
+	// Student 3 cannot read semesters
+	if _, err := service.GetSemester(3, created.ID); !errors.Is(err, ErrNotProfessor) {
+		t.Errorf("read by a student: err = %v, want ErrNotProfessor", err)
+	}
+	if _, err := service.GetAllSemesters(3); !errors.Is(err, ErrNotProfessor) {
+		t.Errorf("list by a student: err = %v, want ErrNotProfessor", err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"sort"
+
+	"dalivim/internal/models"
+)
+
+// SessionEvents are the editor events of a whole session, in time order
+type SessionEvents struct {
+	Start    float64 // When the editor opened (ms, client clock), 0 when unknown
+	Edits    []models.EditEvent
+	KeyDowns []models.KeyEvent
+	Pastes   []models.PasteEvent
+	History  []int64 // Undo, redo and replace timestamps
+}
+
+// sessionStart derives when the editor opened from the final batch: clients
+// report totalTime, the seconds elapsed since then, on their own clock
+func sessionStart(finalTimestamp int64, features map[string]interface{}) float64 {
+	totalTime := getFloat(features, "totalTime")
+	if totalTime <= 0 {
+		return 0
+	}
+	return float64(finalTimestamp) - totalTime*1000
+}
+
+// add collects the events of one batch. Pastes are deduplicated, as clients
+// may resend every paste of the session in each batch.
+func (e *SessionEvents) add(decode func(key string, out interface{}) bool) {
+	var edits []models.EditEvent
+	if decode("editEvents", &edits) {
+		e.Edits = append(e.Edits, edits...)
+	}
+
+	var keys []models.KeyEvent
+	if decode("keyEvents", &keys) {
+		for _, key := range keys {
+			if key.Type == "keydown" {
+				e.KeyDowns = append(e.KeyDowns, key)
+			}
+		}
+	}
+
+	var pastes []models.PasteEvent
+	if decode("pasteEvents", &pastes) {
+		for _, paste := range pastes {
+			if !containsPaste(e.Pastes, paste) {
+				e.Pastes = append(e.Pastes, paste)
+			}
+		}
+	}
+
+	var undos []models.UndoRedoEvent
+	if decode("undoRedoEvents", &undos) {
+		for _, undo := range undos {
+			e.History = append(e.History, undo.Timestamp)
+		}
+	}
+	var replaces []models.FindReplaceEvent
+	if decode("findReplaceEvents", &replaces) {
+		for _, replace := range replaces {
+			if replace.Type == "replace" {
+				e.History = append(e.History, replace.Timestamp)
+			}
+		}
+	}
+}
+
+func containsPaste(pastes []models.PasteEvent, paste models.PasteEvent) bool {
+	for _, existing := range pastes {
+		if existing.Timestamp == paste.Timestamp && existing.Length == paste.Length {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectedIntegrity are the integrity statuses of batches the chain did not
+// accept. They are stored as evidence but their events are not the student's.
+var rejectedIntegrity = map[string]bool{
+	SignalReplayedBatch:    true,
+	SignalInvalidSignature: true,
+	SignalSessionMismatch:  true,
+}
+
+type sequenceKey struct {
+	sessionID uint
+	sequence  int64
+}
+
+// acceptedBatches leaves out the stored batches flagged as replayed or
+// forged and keeps one row per session sequence, as a batch stored before
+// the unique index existed may appear twice. Unsigned batches have no
+// sequence and are all kept.
+func acceptedBatches(stored []models.TelemetryData) []models.TelemetryData {
+	accepted := make([]models.TelemetryData, 0, len(stored))
+	seen := map[sequenceKey]bool{}
+	for _, telemetry := range stored {
+		if rejectedIntegrity[telemetry.Integrity] {
+			continue
+		}
+		if telemetry.Sequence > 0 {
+			key := sequenceKey{sessionID: telemetry.SessionID, sequence: telemetry.Sequence}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		accepted = append(accepted, telemetry)
+	}
+	return accepted
+}
+
+// collectSessionEvents gathers the events of every accepted stored batch of
+// the session plus the final batch's raw events, when it is not stored yet
+func collectSessionEvents(stored []models.TelemetryData, sessionID uint, finalEvents map[string]interface{}) *SessionEvents {
+	session := &SessionEvents{}
+	for _, telemetry := range acceptedBatches(stored) {
+		if sessionID != 0 && telemetry.SessionID != sessionID {
+			continue
+		}
+		rawEvents := telemetry.RawEvents
+		session.add(func(key string, out interface{}) bool {
+			return decodeStoredEvents(rawEvents, key, out)
+		})
+	}
+	if finalEvents != nil {
+		session.add(func(key string, out interface{}) bool {
+			return decodeEvents(finalEvents, key, out)
+		})
+	}
+
+	sort.SliceStable(session.Edits, func(i, j int) bool { return session.Edits[i].Timestamp < session.Edits[j].Timestamp })
+	sort.SliceStable(session.KeyDowns, func(i, j int) bool { return session.KeyDowns[i].Timestamp < session.KeyDowns[j].Timestamp })
+	return session
+}
+
+// hasSequenceGap reports whether a batch of the final's session is missing
+// from the accepted stored ones. Sessions start at sequence 1; unsigned
+// batches carry no sequence and cannot be checked.
+func hasSequenceGap(stored []models.TelemetryData, final TelemetryBatch) bool {
+	if final.SessionID == 0 || final.Sequence <= 1 {
+		return false
+	}
+
+	sequences := map[int64]bool{}
+	for _, telemetry := range acceptedBatches(stored) {
+		if telemetry.SessionID == final.SessionID {
+			sequences[telemetry.Sequence] = true
+		}
+	}
+	for sequence := int64(1); sequence < final.Sequence; sequence++ {
+		if !sequences[sequence] {
+			return true
+		}
+	}
+	return false
+}
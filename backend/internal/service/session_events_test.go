@@ -0,0 +1,72 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+func TestHasSequenceGap(t *testing.T) {
+	stored := []models.TelemetryData{
+		{SessionID: 1, Sequence: 1},
+		{SessionID: 1, Sequence: 2},
+		{SessionID: 2, Sequence: 3},
+		{SessionID: 4, Sequence: 1, Integrity: SignalInvalidSignature},
+	}
+
+	tests := []struct {
+		name  string
+		final TelemetryBatch
+		want  bool
+	}{
+		{"complete", TelemetryBatch{SessionID: 1, Sequence: 3}, false},
+		{"missing batch", TelemetryBatch{SessionID: 1, Sequence: 4}, true},
+		{"other session", TelemetryBatch{SessionID: 2, Sequence: 4}, true},
+		{"first batch", TelemetryBatch{SessionID: 3, Sequence: 1}, false},
+		{"forged batch", TelemetryBatch{SessionID: 4, Sequence: 2}, true},
+		{"unsigned", TelemetryBatch{}, false},
+	}
+	for _, tt := range tests {
+		if got := hasSequenceGap(stored, tt.final); got != tt.want {
+			t.Errorf("%s: hasSequenceGap = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCollectSessionEventsSkipsDuplicatedAndRejectedBatches(t *testing.T) {
+	first := `{"editEvents": [{"timestamp": 1, "rangeOffset": 0, "text": "a"}], "keyEvents": [{"type": "keydown", "code": "KeyA", "timestamp": 1}]}`
+	second := `{"editEvents": [{"timestamp": 2, "rangeOffset": 1, "text": "b"}], "keyEvents": [{"type": "keydown", "code": "KeyB", "timestamp": 2}]}`
+	forged := `{"editEvents": [{"timestamp": 3, "rangeOffset": 2, "text": "c"}], "keyEvents": [{"type": "keydown", "code": "KeyC", "timestamp": 3}]}`
+
+	stored := []models.TelemetryData{
+		{ID: 1, SessionID: 1, Sequence: 1, RawEvents: first, Integrity: integrityOK},
+		{ID: 2, SessionID: 1, Sequence: 2, RawEvents: second, Integrity: integrityOK},
+		// The same batch stored again, and as flagged by the chain
+		{ID: 3, SessionID: 1, Sequence: 2, RawEvents: second, Integrity: integrityOK},
+		{ID: 4, SessionID: 1, Sequence: 2, RawEvents: second, Integrity: SignalReplayedBatch},
+		{ID: 5, SessionID: 1, Sequence: 3, RawEvents: forged, Integrity: SignalInvalidSignature},
+		{ID: 6, SessionID: 1, Sequence: 3, RawEvents: forged, Integrity: SignalSessionMismatch},
+	}
+
+	session := collectSessionEvents(stored, 1, nil)
+	if len(session.Edits) != 2 || session.Edits[0].Text != "a" || session.Edits[1].Text != "b" {
+		t.Errorf("edits = %+v, want a and b once each", session.Edits)
+	}
+	if len(session.KeyDowns) != 2 {
+		t.Errorf("key downs = %+v, want 2", session.KeyDowns)
+	}
+	if events := storedKeyEvents(stored); len(events) != 2 {
+		t.Errorf("stored key events = %+v, want 2", events)
+	}
+}
+
+func TestAcceptedBatchesKeepsUnsignedBatches(t *testing.T) {
+	stored := []models.TelemetryData{
+		{ID: 1, Integrity: SignalUnsignedTelemetry},
+		{ID: 2, Integrity: SignalUnsignedTelemetry},
+		{ID: 3},
+	}
+	if accepted := acceptedBatches(stored); len(accepted) != 3 {
+		t.Errorf("accepted %d batches, want every unsigned one", len(accepted))
+	}
+}
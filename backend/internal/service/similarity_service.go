@@ -1,14 +1,39 @@
 package service
 
 import (
+	"context"
 	"dalivim/internal/models"
 	"dalivim/internal/repository"
+	"errors"
+	"log"
+	"math"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
+var (
+	ErrSimilarityJobNotFound = errors.New("similarity job not found")
+	ErrSimilarityJobRunning  = errors.New("similarity detection already running for this activity")
+	ErrSimilarityJobFinished = errors.New("similarity job already finished")
+)
+
+const (
+	// Job progress is saved every this many compared pairs
+	similarityProgressEvery = 50
+	// Score changes smaller than this between runs are left out of comparisons
+	similarityChangeThreshold = 0.01
+)
+
 type SimilarityService interface {
-	DetectSimilarities(activityID uint) ([]models.SimilarityDetection, error)
+	StartDetection(activityID uint, trigger string) (*models.SimilarityJob, error)
+	GetJob(professorID, jobID uint) (*models.SimilarityJob, error)
+	CancelJob(professorID, jobID uint) (*models.SimilarityJob, error)
+	GetJobDetections(professorID, jobID uint) ([]models.SimilarityRunDetection, error)
+	// CompareJob sets a job's pairs against the completed job before it
+	CompareJob(professorID, jobID uint) (*SimilarityComparison, error)
 	GetSimilaritiesForActivity(activityID uint) ([]models.SimilarityDetection, error)
 	GetClustersForActivity(activityID uint) ([]SimilarityCluster, error)
 }
@@ -18,65 +43,352 @@ type SimilarityCluster struct {
 	Submissions []models.Submission `json:"submissions"`
 }
 
+// SimilarityChange is a pair whose result differs between two similarity
+// jobs. Before is nil for new pairs and After for pairs no longer compared;
+// ScoreDelta is only set when both are.
+type SimilarityChange struct {
+	SubmissionID1 uint                           `json:"submissionId1"`
+	SubmissionID2 uint                           `json:"submissionId2"`
+	Before        *models.SimilarityRunDetection `json:"before"`
+	After         *models.SimilarityRunDetection `json:"after"`
+	ScoreDelta    float64                        `json:"scoreDelta"`
+}
+
+type SimilarityComparison struct {
+	JobID         uint               `json:"jobId"`
+	PreviousJobID *uint              `json:"previousJobId"` // nil for the first completed job
+	Changes       []SimilarityChange `json:"changes"`
+}
+
 type similarityService struct {
 	similarityRepo repository.SimilarityRepository
+	jobRepo        repository.SimilarityJobRepository
 	submissionRepo repository.SubmissionRepository
+	activityRepo   repository.ActivityRepository
+
+	// Jobs running in this process
+	mu      sync.Mutex
+	running map[uint]*runningJob
+}
+
+// runningJob stops a job; done is closed once the job stored how it ended
+type runningJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
 }
 
+// How long a cancel waits for the job to record its end
+const similarityCancelWait = 5 * time.Second
+
 func NewSimilarityService(
 	similarityRepo repository.SimilarityRepository,
+	jobRepo repository.SimilarityJobRepository,
 	submissionRepo repository.SubmissionRepository,
+	activityRepo repository.ActivityRepository,
 ) SimilarityService {
 	return &similarityService{
 		similarityRepo: similarityRepo,
+		jobRepo:        jobRepo,
 		submissionRepo: submissionRepo,
+		activityRepo:   activityRepo,
+		running:        make(map[uint]*runningJob),
+	}
+}
+
+// StartDetection starts comparing the submissions of an activity in the
+// background. Only one job runs per activity at a time.
+func (s *similarityService) StartDetection(activityID uint, trigger string) (*models.SimilarityJob, error) {
+	activity, err := s.activityRepo.FindByID(activityID)
+	if err != nil {
+		return nil, ErrActivityNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if active, err := s.jobRepo.FindActiveByActivityID(activityID); err == nil {
+		if _, running := s.running[active.ID]; running {
+			return active, ErrSimilarityJobRunning
+		}
+		// Left unfinished by a previous process
+		s.finish(active, models.JobStatusFailed, "interrupted")
+	}
+
+	job := &models.SimilarityJob{
+		ActivityID:  activityID,
+		ProfessorID: activity.ProfessorID,
+		Trigger:     trigger,
+		Status:      models.JobStatusPending,
+	}
+	if err := s.jobRepo.Create(job); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.running[job.ID] = &runningJob{cancel: cancel, done: make(chan struct{})}
+
+	snapshot := *job
+	go s.run(ctx, &snapshot)
+
+	return job, nil
+}
+
+func (s *similarityService) GetJob(professorID, jobID uint) (*models.SimilarityJob, error) {
+	job, err := s.jobRepo.FindByID(jobID)
+	if err != nil {
+		return nil, ErrSimilarityJobNotFound
 	}
+	if job.ProfessorID != professorID {
+		return nil, ErrNotActivityOwner
+	}
+	return job, nil
 }
 
-// DetectSimilarities performs pairwise comparison of all submissions in an activity
-func (s *similarityService) DetectSimilarities(activityID uint) ([]models.SimilarityDetection, error) {
-	// Get all submissions for the activity
-	submissions, err := s.submissionRepo.FindByActivityID(activityID)
+// CancelJob stops a pending or running job. The activity keeps the results
+// of its last completed job. A job running in this process records its own
+// end, which is completed when it was already saving its results.
+func (s *similarityService) CancelJob(professorID, jobID uint) (*models.SimilarityJob, error) {
+	job, err := s.GetJob(professorID, jobID)
 	if err != nil {
 		return nil, err
 	}
+	if job.Status != models.JobStatusPending && job.Status != models.JobStatusRunning {
+		return job, ErrSimilarityJobFinished
+	}
+
+	s.mu.Lock()
+	running, ok := s.running[job.ID]
+	s.mu.Unlock()
+
+	if ok {
+		running.cancel()
+		select {
+		case <-running.done:
+		case <-time.After(similarityCancelWait):
+		}
+	} else {
+		// Left unfinished by a previous process. The update only applies
+		// while the job is still active.
+		if err := s.jobRepo.CancelIfActive(job.ID, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	job, err = s.jobRepo.FindByID(job.ID)
+	if err != nil {
+		return nil, ErrSimilarityJobNotFound
+	}
+	if job.Status == models.JobStatusCompleted || job.Status == models.JobStatusFailed {
+		return job, ErrSimilarityJobFinished
+	}
+	return job, nil
+}
+
+// run compares each pair of submissions, saving the job's pairs as it goes.
+// Once all are compared they replace the activity's current detections and
+// clusters in one transaction, so a cancelled or failed job leaves the
+// previous results in place.
+func (s *similarityService) run(ctx context.Context, job *models.SimilarityJob) {
+	defer s.release(job.ID)
 
-	var detections []models.SimilarityDetection
+	now := time.Now()
+	job.Status = models.JobStatusRunning
+	job.StartedAt = &now
 
-	// Compare each pair of submissions
+	submissions, err := s.submissionRepo.FindByActivityID(job.ActivityID)
+	if err != nil {
+		s.finish(job, models.JobStatusFailed, err.Error())
+		return
+	}
+	job.TotalPairs = len(submissions) * (len(submissions) - 1) / 2
+	s.save(job)
+
+	detections := make([]models.SimilarityDetection, 0, job.TotalPairs)
 	for i := 0; i < len(submissions); i++ {
 		for j := i + 1; j < len(submissions); j++ {
-			sub1 := submissions[i]
-			sub2 := submissions[j]
-
-			// Calculate similarity score
-			score := calculateCodeSimilarity(sub1.Code, sub2.Code)
-
-			// Create detection record
-			detection := models.SimilarityDetection{
-				ActivityID:      activityID,
-				SubmissionID1:   sub1.ID,
-				SubmissionID2:   sub2.ID,
-				StudentID1:      sub1.StudentID,
-				StudentID2:      sub2.StudentID,
-				SimilarityScore: score,
-				Algorithm:       "levenshtein_normalized",
-				IsSuspicious:    score > 0.75, // Threshold for suspicion
+			if ctx.Err() != nil {
+				s.finish(job, models.JobStatusCancelled, "")
+				return
 			}
 
-			// Save detection
-			if err := s.similarityRepo.CreateDetection(&detection); err != nil {
-				continue // Log error but continue with other comparisons
+			pair := compareSubmissions(job, &submissions[i], &submissions[j])
+			if err := s.similarityRepo.CreateRunDetection(&pair); err != nil {
+				s.finish(job, models.JobStatusFailed, err.Error())
+				return
 			}
+			detections = append(detections, currentDetection(&pair))
 
-			detections = append(detections, detection)
+			job.ComparedPairs++
+			if pair.IsSuspicious {
+				job.SuspiciousPairs++
+			}
+			if job.ComparedPairs%similarityProgressEvery == 0 {
+				s.save(job)
+			}
 		}
 	}
 
 	// Cluster similar submissions
-	s.clusterSimilarities(activityID, detections)
+	clusters := clusterSimilarities(job, detections)
+
+	if ctx.Err() != nil {
+		s.finish(job, models.JobStatusCancelled, "")
+		return
+	}
+	if err := s.similarityRepo.ReplaceForActivity(job.ActivityID, detections, clusters); err != nil {
+		s.finish(job, models.JobStatusFailed, err.Error())
+		return
+	}
+
+	s.finish(job, models.JobStatusCompleted, "")
+}
+
+// compareSubmissions scores the similarity of two submissions, with the
+// lower submission ID first
+func compareSubmissions(job *models.SimilarityJob, sub1, sub2 *models.Submission) models.SimilarityRunDetection {
+	if sub2.ID < sub1.ID {
+		sub1, sub2 = sub2, sub1
+	}
+	score := calculateCodeSimilarity(sub1.Code, sub2.Code)
+
+	return models.SimilarityRunDetection{
+		JobID:           job.ID,
+		ActivityID:      job.ActivityID,
+		SubmissionID1:   sub1.ID,
+		SubmissionID2:   sub2.ID,
+		StudentID1:      sub1.StudentID,
+		StudentID2:      sub2.StudentID,
+		SimilarityScore: score,
+		Algorithm:       "levenshtein_normalized",
+		IsSuspicious:    score > 0.75, // Threshold for suspicion
+	}
+}
+
+// currentDetection copies a job's pair into the activity's current results
+func currentDetection(pair *models.SimilarityRunDetection) models.SimilarityDetection {
+	return models.SimilarityDetection{
+		ActivityID:      pair.ActivityID,
+		SubmissionID1:   pair.SubmissionID1,
+		SubmissionID2:   pair.SubmissionID2,
+		StudentID1:      pair.StudentID1,
+		StudentID2:      pair.StudentID2,
+		SimilarityScore: pair.SimilarityScore,
+		Algorithm:       pair.Algorithm,
+		IsSuspicious:    pair.IsSuspicious,
+		JobID:           pair.JobID,
+	}
+}
+
+// save records the job's progress
+func (s *similarityService) save(job *models.SimilarityJob) {
+	if job.TotalPairs > 0 {
+		job.Progress = float64(job.ComparedPairs) / float64(job.TotalPairs) * 100
+	}
+	if err := s.jobRepo.Update(job); err != nil {
+		log.Printf("similarity job %d: %v", job.ID, err)
+	}
+}
+
+func (s *similarityService) finish(job *models.SimilarityJob, status, message string) {
+	finished := time.Now()
+	job.Status = status
+	job.Error = message
+	job.FinishedAt = &finished
+	if status == models.JobStatusCompleted {
+		job.Progress = 100
+	}
+	s.save(job)
+}
+
+func (s *similarityService) release(jobID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if running, ok := s.running[jobID]; ok {
+		running.cancel()
+		close(running.done)
+		delete(s.running, jobID)
+	}
+}
+
+func (s *similarityService) GetJobDetections(professorID, jobID uint) ([]models.SimilarityRunDetection, error) {
+	if _, err := s.GetJob(professorID, jobID); err != nil {
+		return nil, err
+	}
+	return s.similarityRepo.FindRunDetections(jobID)
+}
+
+// CompareJob lists the pairs that are new, no longer compared, changed
+// suspicion or moved by at least similarityChangeThreshold since the
+// previous completed job of the activity
+func (s *similarityService) CompareJob(professorID, jobID uint) (*SimilarityComparison, error) {
+	job, err := s.GetJob(professorID, jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	pairs, err := s.similarityRepo.FindRunDetections(job.ID)
+	if err != nil {
+		return nil, err
+	}
 
-	return detections, nil
+	comparison := &SimilarityComparison{JobID: job.ID, Changes: []SimilarityChange{}}
+
+	type pairKey struct {
+		submission1, submission2 uint
+		algorithm                string
+	}
+	previousPairs := make(map[pairKey]*models.SimilarityRunDetection)
+	if previous, err := s.jobRepo.FindPreviousCompleted(job.ActivityID, job.ID); err == nil {
+		comparison.PreviousJobID = &previous.ID
+
+		before, err := s.similarityRepo.FindRunDetections(previous.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range before {
+			previousPairs[pairKey{before[i].SubmissionID1, before[i].SubmissionID2, before[i].Algorithm}] = &before[i]
+		}
+	}
+
+	for i := range pairs {
+		after := &pairs[i]
+		key := pairKey{after.SubmissionID1, after.SubmissionID2, after.Algorithm}
+		before := previousPairs[key]
+		delete(previousPairs, key)
+
+		change := SimilarityChange{
+			SubmissionID1: after.SubmissionID1,
+			SubmissionID2: after.SubmissionID2,
+			Before:        before,
+			After:         after,
+		}
+		if before != nil {
+			change.ScoreDelta = after.SimilarityScore - before.SimilarityScore
+			if before.IsSuspicious == after.IsSuspicious && math.Abs(change.ScoreDelta) < similarityChangeThreshold {
+				continue
+			}
+		}
+		comparison.Changes = append(comparison.Changes, change)
+	}
+
+	for _, before := range previousPairs {
+		comparison.Changes = append(comparison.Changes, SimilarityChange{
+			SubmissionID1: before.SubmissionID1,
+			SubmissionID2: before.SubmissionID2,
+			Before:        before,
+		})
+	}
+
+	sort.Slice(comparison.Changes, func(i, j int) bool {
+		a, b := comparison.Changes[i], comparison.Changes[j]
+		if a.SubmissionID1 != b.SubmissionID1 {
+			return a.SubmissionID1 < b.SubmissionID1
+		}
+		return a.SubmissionID2 < b.SubmissionID2
+	})
+
+	return comparison, nil
 }
 
 func (s *similarityService) GetSimilaritiesForActivity(activityID uint) ([]models.SimilarityDetection, error) {
@@ -117,8 +429,9 @@ func (s *similarityService) GetClustersForActivity(activityID uint) ([]Similarit
 	return result, nil
 }
 
-// clusterSimilarities groups similar submissions using simple connected components
-func (s *similarityService) clusterSimilarities(activityID uint, detections []models.SimilarityDetection) {
+// clusterSimilarities groups similar submissions using simple connected
+// components
+func clusterSimilarities(job *models.SimilarityJob, detections []models.SimilarityDetection) []models.SimilarityCluster {
 	// Build adjacency list of suspicious similarities
 	graph := make(map[uint][]uint)
 
@@ -129,11 +442,18 @@ func (s *similarityService) clusterSimilarities(activityID uint, detections []mo
 		}
 	}
 
+	// Visit submissions in order so re-runs build the same clusters
+	nodes := make([]uint, 0, len(graph))
+	for node := range graph {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+
 	// Find connected components (clusters)
 	visited := make(map[uint]bool)
-	clusterNum := 0
+	clusters := []models.SimilarityCluster{}
 
-	for node := range graph {
+	for _, node := range nodes {
 		if !visited[node] {
 			// BFS to find all nodes in this cluster
 			cluster := []uint{}
@@ -155,14 +475,15 @@ func (s *similarityService) clusterSimilarities(activityID uint, detections []mo
 
 			// Only create cluster if it has 2+ submissions
 			if len(cluster) >= 2 {
-				clusterNum++
-				s.saveCluster(activityID, uint(clusterNum), cluster, detections)
+				clusters = append(clusters, buildCluster(job, cluster, detections))
 			}
 		}
 	}
+
+	return clusters
 }
 
-func (s *similarityService) saveCluster(activityID uint, clusterID uint, submissionIDs []uint, detections []models.SimilarityDetection) {
+func buildCluster(job *models.SimilarityJob, submissionIDs []uint, detections []models.SimilarityDetection) models.SimilarityCluster {
 	// Calculate average similarity within cluster
 	var totalSim float64
 	count := 0
@@ -174,7 +495,10 @@ func (s *similarityService) saveCluster(activityID uint, clusterID uint, submiss
 		}
 	}
 
-	avgSim := totalSim / float64(count)
+	var avgSim float64
+	if count > 0 {
+		avgSim = totalSim / float64(count)
+	}
 
 	// Determine suspicion level
 	suspicionLevel := "low"
@@ -184,24 +508,13 @@ func (s *similarityService) saveCluster(activityID uint, clusterID uint, submiss
 		suspicionLevel = "medium"
 	}
 
-	cluster := &models.SimilarityCluster{
-		ActivityID:     activityID,
+	return models.SimilarityCluster{
+		ActivityID:     job.ActivityID,
 		ClusterSize:    len(submissionIDs),
 		AvgSimilarity:  avgSim,
 		SuspicionLevel: suspicionLevel,
-	}
-
-	// Save cluster
-	if err := s.similarityRepo.CreateCluster(cluster); err != nil {
-		return
-	}
-
-	// Update detections with cluster ID
-	for i := range detections {
-		if contains(submissionIDs, detections[i].SubmissionID1) && contains(submissionIDs, detections[i].SubmissionID2) {
-			detections[i].ClusterID = &cluster.ID
-			s.similarityRepo.UpdateDetection(&detections[i])
-		}
+		JobID:          job.ID,
+		SubmissionIDs:  submissionIDs,
 	}
 }
 
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+type fakeSimilarityJobRepo struct {
+	repository.SimilarityJobRepository
+
+	mu   sync.Mutex
+	jobs map[uint]models.SimilarityJob
+}
+
+func (r *fakeSimilarityJobRepo) Create(job *models.SimilarityJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job.ID = uint(len(r.jobs) + 1)
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *fakeSimilarityJobRepo) Update(job *models.SimilarityJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = *job
+	return nil
+}
+
+func (r *fakeSimilarityJobRepo) FindByID(id uint) (*models.SimilarityJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &job, nil
+}
+
+func (r *fakeSimilarityJobRepo) FindActiveByActivityID(activityID uint) (*models.SimilarityJob, error) {
+	return nil, errors.New("not found")
+}
+
+// blockingSubmissionRepo holds the job on loading submissions until released
+type blockingSubmissionRepo struct {
+	repository.SubmissionRepository
+	release chan struct{}
+}
+
+func (r *blockingSubmissionRepo) FindByActivityID(activityID uint) ([]models.Submission, error) {
+	<-r.release
+	return []models.Submission{{ID: 1, Code: "a"}, {ID: 2, Code: "b"}}, nil
+}
+
+func TestCancelReturnsTheStatusTheJobRecorded(t *testing.T) {
+	jobRepo := &fakeSimilarityJobRepo{jobs: map[uint]models.SimilarityJob{}}
+	submissionRepo := &blockingSubmissionRepo{release: make(chan struct{})}
+	activityRepo := &fakeActivityRepo{activity: models.Activity{ID: 1, ProfessorID: 7}}
+	service := NewSimilarityService(nil, jobRepo, submissionRepo, activityRepo)
+
+	job, err := service.StartDetection(1, models.SimilarityTriggerManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { close(submissionRepo.release) })
+	cancelled, err := service.CancelJob(7, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.Status != models.JobStatusCancelled {
+		t.Errorf("cancel returned status %q, want cancelled", cancelled.Status)
+	}
+
+	stored, _ := jobRepo.FindByID(job.ID)
+	if stored.Status != models.JobStatusCancelled || stored.FinishedAt == nil {
+		t.Errorf("stored status %q, finished %v; want cancelled and finished", stored.Status, stored.FinishedAt)
+	}
+}
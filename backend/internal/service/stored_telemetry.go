@@ -0,0 +1,40 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+
+	"dalivim/internal/archive"
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+)
+
+// loadTelemetry returns the stored telemetry of a student in an activity,
+// ordered by timestamp. Rows that compaction moved into archives are decoded
+// and merged back in; archives whose raw events were purged only bring back
+// features.
+func loadTelemetry(
+	telemetryRepo repository.TelemetryRepository,
+	archiveRepo repository.ArchiveRepository,
+	activityID, studentID uint,
+) ([]models.TelemetryData, error) {
+	rows, err := telemetryRepo.FindByActivityAndStudent(activityID, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	archives, err := archiveRepo.FindByActivityAndStudent(activityID, studentID)
+	if err != nil {
+		return nil, err
+	}
+	for _, archived := range archives {
+		decoded, err := archive.Decode(archived.Data)
+		if err != nil {
+			return nil, fmt.Errorf("archive %d: %w", archived.ID, err)
+		}
+		rows = append(rows, decoded...)
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Timestamp < rows[j].Timestamp })
+	return rows, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/archive"
+	"dalivim/internal/models"
+)
+
+func TestLoadTelemetryMergesArchivedRows(t *testing.T) {
+	data, err := archive.Encode([]models.TelemetryData{
+		{SessionID: 1, Sequence: 1, Timestamp: 1000},
+		{SessionID: 1, Sequence: 2, Timestamp: 2000},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	telemetryRepo := &fakeTelemetryRepo{stored: []models.TelemetryData{
+		{SessionID: 1, Sequence: 3, Timestamp: 3000},
+	}}
+	archiveRepo := fakeArchiveRepo{archives: []models.TelemetryArchive{{ID: 1, Data: data}}}
+
+	rows, err := loadTelemetry(telemetryRepo, archiveRepo, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("loaded %d rows, want 3", len(rows))
+	}
+	for i, row := range rows {
+		if row.Sequence != int64(i+1) {
+			t.Errorf("row %d has sequence %d, want %d", i, row.Sequence, i+1)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"dalivim/internal/repository"
+)
+
+var (
+	ErrStreamUnauthorized = errors.New("invalid stream credentials")
+	ErrStreamBackpressure = errors.New("stream queue is full, retry later")
+	ErrStreamClosed       = errors.New("stream already received its final frame")
+)
+
+const (
+	streamQueueSize   = 32
+	streamIdleTimeout = 5 * time.Minute
+	streamSubBuffer   = 16
+	streamBusyRetries = 5
+	streamBusyBackoff = 500 * time.Millisecond
+)
+
+// StreamFrame is one incremental telemetry upload on a session stream. Frames
+// carry only the events produced since the previous frame; Features may be
+// omitted, in which case the last features received on the stream are reused.
+// Frames are signed exactly like TelemetryBatch, as received: an omitted
+// Features is signed as null.
+type StreamFrame struct {
+	Sequence  int64
+	PrevHash  string
+	Signature string
+	Timestamp int64
+	SentAt    int64
+	Buffered  bool
+	IsFinal   bool
+	Code      string
+	Features  map[string]interface{}
+	Events    map[string]interface{}
+}
+
+// StreamMessage is pushed to stream subscribers over SSE
+type StreamMessage struct {
+	Event    string      `json:"event"` // "resume", "ack", "analysis" or "error"
+	Sequence int64       `json:"sequence"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+type TelemetryStreamService interface {
+	// Subscribe opens the downstream channel of a session. The first message
+	// is always "resume" with the last sequence already processed, so a
+	// reconnecting client knows which frames to resend.
+	Subscribe(sessionID uint, auth string) (<-chan StreamMessage, func(), error)
+	// Push enqueues a frame for processing and returns the highest sequence
+	// received so far. It returns ErrStreamBackpressure when the session queue
+	// is full.
+	Push(sessionID uint, auth string, frame StreamFrame) (int64, error)
+}
+
+type streamSession struct {
+	id         uint
+	activityID uint
+	studentID  uint
+
+	queue chan StreamFrame
+
+	mu           sync.Mutex
+	received     int64
+	acked        int64
+	final        bool
+	released     bool
+	lastFeatures map[string]interface{}
+	subscribers  map[chan StreamMessage]struct{}
+}
+
+type telemetryStreamService struct {
+	sessionRepo      repository.SessionRepository
+	telemetryService TelemetryService
+
+	mu       sync.Mutex
+	sessions map[uint]*streamSession
+}
+
+func NewTelemetryStreamService(
+	sessionRepo repository.SessionRepository,
+	telemetryService TelemetryService,
+) TelemetryStreamService {
+	return &telemetryStreamService{
+		sessionRepo:      sessionRepo,
+		telemetryService: telemetryService,
+		sessions:         make(map[uint]*streamSession),
+	}
+}
+
+// StreamAuth is the credential a client presents to open or push to a stream:
+// hex(HMAC-SHA256(sessionKey, "stream|<sessionID>")). It lets EventSource
+// connections authenticate without sending the session key itself.
+func StreamAuth(sessionKey string, sessionID uint) string {
+	mac := hmac.New(sha256.New, []byte(sessionKey))
+	mac.Write([]byte(fmt.Sprintf("stream|%d", sessionID)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *telemetryStreamService) Subscribe(sessionID uint, auth string) (<-chan StreamMessage, func(), error) {
+	stream, err := s.getStream(sessionID, auth)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan StreamMessage, streamSubBuffer)
+
+	stream.mu.Lock()
+	ch <- StreamMessage{Event: "resume", Sequence: stream.acked}
+	if stream.released {
+		close(ch)
+	} else {
+		stream.subscribers[ch] = struct{}{}
+	}
+	stream.mu.Unlock()
+
+	unsubscribe := func() {
+		stream.mu.Lock()
+		if _, ok := stream.subscribers[ch]; ok {
+			delete(stream.subscribers, ch)
+			close(ch)
+		}
+		stream.mu.Unlock()
+	}
+
+	return ch, unsubscribe, nil
+}
+
+func (s *telemetryStreamService) Push(sessionID uint, auth string, frame StreamFrame) (int64, error) {
+	for {
+		stream, err := s.getStream(sessionID, auth)
+		if err != nil {
+			return 0, err
+		}
+
+		received, retry, err := stream.enqueue(frame)
+		if !retry {
+			return received, err
+		}
+	}
+}
+
+// enqueue must not block the caller. retry is true when the worker released
+// the stream concurrently, in which case the caller should load it again.
+func (stream *streamSession) enqueue(frame StreamFrame) (received int64, retry bool, err error) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if stream.released && !stream.final {
+		return 0, true, nil
+	}
+	if stream.final {
+		return stream.received, false, ErrStreamClosed
+	}
+
+	// Frames already processed are resent after a reconnect; drop them so
+	// they are not flagged as replays by the chain verification. Frames
+	// received but not acked yet are queued again, since processing them may
+	// have failed; process skips the copy if the first one succeeds.
+	if frame.Sequence <= stream.acked {
+		return stream.received, false, nil
+	}
+
+	select {
+	case stream.queue <- frame:
+		if frame.Sequence > stream.received {
+			stream.received = frame.Sequence
+		}
+		stream.final = frame.IsFinal
+		return stream.received, false, nil
+	default:
+		return stream.received, false, ErrStreamBackpressure
+	}
+}
+
+// getStream returns the in-memory state of a session, loading it and starting
+// its worker on first use
+func (s *telemetryStreamService) getStream(sessionID uint, auth string) (*streamSession, error) {
+	session, err := s.sessionRepo.FindByID(sessionID)
+	if err != nil {
+		return nil, ErrStreamUnauthorized
+	}
+
+	expected := StreamAuth(session.SessionKey, session.ID)
+	if !hmac.Equal([]byte(expected), []byte(auth)) {
+		return nil, ErrStreamUnauthorized
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if stream, ok := s.sessions[sessionID]; ok {
+		return stream, nil
+	}
+
+	stream := &streamSession{
+		id:          session.ID,
+		activityID:  session.ActivityID,
+		studentID:   session.StudentID,
+		queue:       make(chan StreamFrame, streamQueueSize),
+		received:    session.LastSequence,
+		acked:       session.LastSequence,
+		subscribers: make(map[chan StreamMessage]struct{}),
+	}
+	s.sessions[sessionID] = stream
+
+	go s.run(stream)
+
+	return stream, nil
+}
+
+// run processes the frames of one session in order. It exits after the final
+// frame or once the session has been idle for streamIdleTimeout.
+func (s *telemetryStreamService) run(stream *streamSession) {
+	idle := time.NewTimer(streamIdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case frame := <-stream.queue:
+			s.process(stream, frame)
+			if frame.IsFinal {
+				s.release(stream, true)
+				return
+			}
+
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(streamIdleTimeout)
+		case <-idle.C:
+			if s.release(stream, false) {
+				return
+			}
+			idle.Reset(streamIdleTimeout)
+		}
+	}
+}
+
+func (s *telemetryStreamService) process(stream *streamSession, frame StreamFrame) {
+	stream.mu.Lock()
+	if frame.Sequence <= stream.acked {
+		stream.mu.Unlock()
+		return
+	}
+	inherited := stream.lastFeatures
+	if frame.Features != nil {
+		stream.lastFeatures = frame.Features
+	}
+	stream.mu.Unlock()
+
+	// Features stay as the client signed them; omitted ones are only
+	// inherited for the analysis
+	batch := TelemetryBatch{
+		ActivityID: stream.activityID,
+		StudentID:  stream.studentID,
+		SessionID:  stream.id,
+		Sequence:   frame.Sequence,
+		PrevHash:   frame.PrevHash,
+		Signature:  frame.Signature,
+		Timestamp:  frame.Timestamp,
+		SentAt:     frame.SentAt,
+		Buffered:   frame.Buffered,
+		IsFinal:    frame.IsFinal,
+		Code:       frame.Code,
+		Features:   frame.Features,
+		RawEvents:  frame.Events,
+
+		InheritedFeatures: inherited,
+	}
+
+	// While ingestion is busy the worker waits, which fills the session
+	// queue and pushes the backpressure back to the client as 429s
+	analysis, err := s.telemetryService.ProcessTelemetry(batch)
+	for attempt := 1; errors.Is(err, ErrIngestionBusy) && attempt <= streamBusyRetries; attempt++ {
+		time.Sleep(streamBusyBackoff * time.Duration(attempt))
+		analysis, err = s.telemetryService.ProcessTelemetry(batch)
+	}
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if err != nil {
+		stream.broadcast(StreamMessage{Event: "error", Sequence: frame.Sequence, Data: err.Error()})
+		return
+	}
+
+	stream.acked = frame.Sequence
+	stream.broadcast(StreamMessage{Event: "ack", Sequence: frame.Sequence})
+	stream.broadcast(StreamMessage{Event: "analysis", Sequence: frame.Sequence, Data: analysis})
+}
+
+// broadcast must be called with stream.mu held. Slow subscribers miss
+// messages instead of blocking the worker.
+func (stream *streamSession) broadcast(msg StreamMessage) {
+	for ch := range stream.subscribers {
+		select {
+		case ch <- msg:
+		default:
+		}
+	}
+}
+
+// release drops the in-memory state of a session and closes its subscribers.
+// Unless force is set, it does nothing while frames are still queued.
+func (s *telemetryStreamService) release(stream *streamSession, force bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	if !force && len(stream.queue) > 0 {
+		return false
+	}
+
+	delete(s.sessions, stream.id)
+	stream.released = true
+	for ch := range stream.subscribers {
+		delete(stream.subscribers, ch)
+		close(ch)
+	}
+	return true
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"dalivim/internal/models"
+)
+
+func TestStreamFrameWithoutFeaturesVerifies(t *testing.T) {
+	sessionRepo := &fakeSessionRepo{sessions: map[uint]*models.TelemetrySession{
+		7: {ID: 7, ActivityID: 1, StudentID: 2, SessionKey: "secret"},
+	}}
+	pipeline := &fakePipeline{}
+	streams := NewTelemetryStreamService(sessionRepo, newTestTelemetryService(sessionRepo, pipeline))
+	auth := StreamAuth("secret", 7)
+
+	messages, unsubscribe, err := streams.Subscribe(7, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+	<-messages // resume
+
+	first := StreamFrame{
+		Sequence:  1,
+		Timestamp: time.Now().UnixMilli(),
+		Features:  decodeJSON(t, `{"totalKeystrokes": 10}`),
+		Events:    decodeJSON(t, `{"undoRedoEvents": [{"timestamp": 1, "type": "undo"}]}`),
+	}
+	second := StreamFrame{
+		Sequence:  2,
+		Timestamp: time.Now().UnixMilli(),
+		Events:    decodeJSON(t, `{"undoRedoEvents": [{"timestamp": 2, "type": "undo"}]}`),
+	}
+	for _, frame := range []*StreamFrame{&first, &second} {
+		frame.Signature = signBatch("secret", TelemetryBatch{
+			Sequence:  frame.Sequence,
+			PrevHash:  frame.PrevHash,
+			Timestamp: frame.Timestamp,
+			Features:  frame.Features,
+			RawEvents: frame.Events,
+		})
+		second.PrevHash = first.Signature
+	}
+
+	for _, frame := range []StreamFrame{first, second} {
+		if _, err := streams.Push(7, auth, frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitForAck(t, messages, 2)
+
+	for _, row := range pipeline.submitted {
+		if row.Integrity != integrityOK {
+			t.Errorf("frame %d: integrity = %q, want %q", row.Sequence, row.Integrity, integrityOK)
+		}
+	}
+}
+
+func waitForAck(t *testing.T, messages <-chan StreamMessage, sequence int64) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if msg.Event == "error" {
+				t.Fatalf("frame %d failed: %v", msg.Sequence, msg.Data)
+			}
+			if msg.Event == "ack" && msg.Sequence == sequence {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("frame %d was not acked", sequence)
+		}
+	}
+}
+
+func TestEnqueueRequeuesFramesNotAcked(t *testing.T) {
+	stream := &streamSession{queue: make(chan StreamFrame, 4), received: 2, acked: 1}
+
+	if _, _, err := stream.enqueue(StreamFrame{Sequence: 1}); err != nil || len(stream.queue) != 0 {
+		t.Errorf("acked frame was queued again (err %v)", err)
+	}
+	if _, _, err := stream.enqueue(StreamFrame{Sequence: 2}); err != nil || len(stream.queue) != 1 {
+		t.Errorf("received but unacked frame was dropped (err %v)", err)
+	}
+	if stream.received != 2 {
+		t.Errorf("received = %d, want 2", stream.received)
+	}
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+// StylometryDetectorName names the code style detector
+const StylometryDetectorName = "stylometry"
+
+const (
+	// Code shorter than this, in non-blank lines, has too little style to judge
+	minStyleLines = 5
+	// Style shifts are only measured against this many previous submissions
+	minStylePastSubmissions = 2
+	// Only the most recent previous submissions are compared against
+	maxStylePastSubmissions = 10
+	// Comment density from which comments count as fully explanatory
+	fullCommentDensity = 0.3
+	// Advanced idioms from which code counts as fully idiomatic
+	fullIdiomCount = 4.0
+)
+
+var (
+	functionPattern = regexp.MustCompile(`^\s*(?:(?:export\s+)?(?:async\s+)?(?:def|function|func)\s+\w+|(?:public|private|protected|static)[\w\s<>\[\],]*\s\w+)\s*\(`)
+	assignPattern   = regexp.MustCompile(`\b([A-Za-z_][A-Za-z0-9_]*)\s*(?::\s*[\w\[\], ]+)?=[^=]`)
+	declarePattern  = regexp.MustCompile(`\b(?:def|function|func|let|const|var|class)\s+([A-Za-z_][A-Za-z0-9_]*)`)
+	trailingComment = regexp.MustCompile(`\S\s+(?:#|//)\s*(\S.*)$`)
+)
+
+// advancedIdiom is an idiom usually absent from student code and common in
+// generated code. Its rule tells whether it is above the course level.
+type advancedIdiom struct {
+	name    string
+	rule    string
+	pattern *regexp.Regexp
+}
+
+var advancedIdioms = []advancedIdiom{
+	{"comprehension", rules.IdiomComprehension, regexp.MustCompile(`[\[{(][^\[\]{}()\n]+\bfor\b[^\[\]{}()\n]+\bin\b[^\[\]{}\n]+[\]})]`)},
+	{"lambda", rules.IdiomLambda, regexp.MustCompile(`\blambda\b|=>`)},
+	{"fString", rules.IdiomFString, regexp.MustCompile(`\bf["']`)},
+	{"enumerateZip", rules.IdiomEnumerateZip, regexp.MustCompile(`\b(?:enumerate|zip)\(`)},
+	{"contextManager", rules.IdiomContextManager, regexp.MustCompile(`(?m)^\s*with\s.+:\s*$`)},
+	{"generator", rules.IdiomGenerator, regexp.MustCompile(`\byield\b`)},
+	{"decorator", rules.IdiomDecorator, regexp.MustCompile(`(?m)^\s*@\w+`)},
+	{"typeHints", rules.IdiomTypeHints, regexp.MustCompile(`\)\s*->\s*\w+|\bdef\s+\w+\([^)]*\w+\s*:\s*\w+`)},
+	{"mainGuard", rules.IdiomMainGuard, regexp.MustCompile(`__name__\s*==\s*["']__main__["']`)},
+	{"exceptionHandling", rules.IdiomExceptionHandling, regexp.MustCompile(`\b(?:except|catch)\b`)},
+	{"functional", rules.IdiomFunctional, regexp.MustCompile(`\.(?:map|filter|reduce)\(|\b(?:map|filter)\(`)},
+	{"streams", rules.IdiomStreams, regexp.MustCompile(`\.stream\(\)`)},
+	{"destructuring", rules.IdiomDestructuring, regexp.MustCompile(`\b(?:const|let|var)\s*[\[{]`)},
+}
+
+// codeStyle measures the style of a piece of code. Ratios are 0-1.
+type codeStyle struct {
+	Lines            int                // Non-blank lines
+	Functions        int                // Function declarations
+	CommentDensity   float64            // Comment lines per non-blank line
+	SentenceComments float64            // Comments written as full sentences
+	DocstringRatio   float64            // Functions with a docstring
+	DescriptiveNames float64            // Declared names made of several words
+	Idioms           map[string]float64 // Weight of each advanced idiom used
+}
+
+// aiStyleScore combines the style measures into a 0-1 resemblance to
+// generated code: thorough sentence-like comments, documented functions,
+// long compound names and idioms above the course level
+func (s codeStyle) aiStyleScore() float64 {
+	return 0.2*min(s.CommentDensity/fullCommentDensity, 1) +
+		0.2*s.SentenceComments +
+		0.2*s.DocstringRatio +
+		0.2*s.DescriptiveNames +
+		0.2*min(s.idiomWeight()/fullIdiomCount, 1)
+}
+
+func (s codeStyle) idiomWeight() float64 {
+	total := 0.0
+	for _, weight := range s.Idioms {
+		total += weight
+	}
+	return total
+}
+
+// measureStyle reads comments, docstrings, declared names and idioms of
+// code in any of the course languages. The idiom rules of set tell which
+// idioms are above the course level.
+func measureStyle(code string, set rules.Set) codeStyle {
+	style := codeStyle{Idioms: map[string]float64{}}
+	lines := strings.Split(code, "\n")
+
+	commentLines, sentences, comments := 0, 0, 0
+	documented := 0
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		style.Lines++
+
+		if text, ok := lineComment(trimmed); ok {
+			commentLines++
+			if text != "" {
+				comments++
+				if isSentence(text) {
+					sentences++
+				}
+			}
+			continue
+		}
+		if match := trailingComment.FindStringSubmatch(trimmed); match != nil && !strings.Contains(trimmed, "://") {
+			comments++
+			if isSentence(match[1]) {
+				sentences++
+			}
+		}
+
+		if functionPattern.MatchString(line) {
+			style.Functions++
+			if hasDocstring(lines, i) {
+				documented++
+			}
+		}
+	}
+
+	if style.Lines > 0 {
+		style.CommentDensity = float64(commentLines) / float64(style.Lines)
+	}
+	if comments > 0 {
+		style.SentenceComments = float64(sentences) / float64(comments)
+	}
+	if style.Functions > 0 {
+		style.DocstringRatio = float64(documented) / float64(style.Functions)
+	}
+	style.DescriptiveNames = descriptiveNameRatio(code)
+
+	for _, idiom := range advancedIdioms {
+		rule := set.Get(idiom.rule)
+		if !rule.Enabled {
+			continue
+		}
+		uses := len(idiom.pattern.FindAllStringIndex(code, -1))
+		if uses > 0 && float64(uses) >= rule.Threshold {
+			style.Idioms[idiom.name] = rule.Weight
+		}
+	}
+
+	return style
+}
+
+// lineComment returns the text of a comment line. Preprocessor lines and
+// shebangs are code.
+func lineComment(trimmed string) (string, bool) {
+	switch {
+	case strings.HasPrefix(trimmed, "#!"), strings.HasPrefix(trimmed, "#include"), strings.HasPrefix(trimmed, "#define"):
+		return "", false
+	case strings.HasPrefix(trimmed, "#"):
+		return strings.TrimSpace(strings.TrimLeft(trimmed, "#")), true
+	case strings.HasPrefix(trimmed, "//"):
+		return strings.TrimSpace(strings.TrimLeft(trimmed, "/")), true
+	case strings.HasPrefix(trimmed, "/*"), strings.HasPrefix(trimmed, "*"):
+		text := strings.TrimSuffix(strings.TrimLeft(trimmed, "/*"), "*/")
+		return strings.TrimSpace(text), true
+	case strings.HasPrefix(trimmed, `"""`), strings.HasPrefix(trimmed, "'''"):
+		return strings.TrimSpace(strings.Trim(trimmed, `"'`)), true
+	}
+	return "", false
+}
+
+// isSentence tells whether a comment reads as prose: capitalized and at
+// least four words long
+func isSentence(text string) bool {
+	words := strings.Fields(text)
+	if len(words) < 4 {
+		return false
+	}
+	first := []rune(words[0])[0]
+	return unicode.IsUpper(first)
+}
+
+// hasDocstring tells whether the function declared at line i is documented,
+// by a docstring right below it or a doc block right above it
+func hasDocstring(lines []string, i int) bool {
+	for j := i + 1; j < len(lines); j++ {
+		next := strings.TrimSpace(lines[j])
+		if next == "" {
+			continue
+		}
+		if strings.HasPrefix(next, `"""`) || strings.HasPrefix(next, "'''") {
+			return true
+		}
+		break
+	}
+	for j := i - 1; j >= 0; j-- {
+		previous := strings.TrimSpace(lines[j])
+		if previous == "" {
+			continue
+		}
+		return strings.HasSuffix(previous, "*/")
+	}
+	return false
+}
+
+// descriptiveNameRatio is the share of declared names made of several words,
+// in snake_case or camelCase
+func descriptiveNameRatio(code string) float64 {
+	names := map[string]bool{}
+	for _, pattern := range []*regexp.Regexp{assignPattern, declarePattern} {
+		for _, match := range pattern.FindAllStringSubmatch(code, -1) {
+			names[match[1]] = true
+		}
+	}
+	if len(names) == 0 {
+		return 0
+	}
+
+	descriptive := 0
+	for name := range names {
+		if isCompoundName(name) {
+			descriptive++
+		}
+	}
+	return float64(descriptive) / float64(len(names))
+}
+
+func isCompoundName(name string) bool {
+	trimmed := strings.Trim(name, "_")
+	if strings.Contains(trimmed, "_") {
+		return true
+	}
+	runes := []rune(trimmed)
+	for i := 1; i < len(runes); i++ {
+		if unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// stylometryDetector reads the submitted code itself for the style of
+// generated code, and for final submissions compares it with the student's
+// previous submissions. It runs offline, without any external model.
+type stylometryDetector struct {
+	submissionRepo repository.SubmissionRepository
+}
+
+func NewStylometryDetector(submissionRepo repository.SubmissionRepository) Detector {
+	return &stylometryDetector{submissionRepo: submissionRepo}
+}
+
+func (d *stylometryDetector) Name() string     { return StylometryDetectorName }
+func (d *stylometryDetector) Version() string  { return "1" }
+func (d *stylometryDetector) Inputs() []string { return []string{"code"} }
+
+func (d *stylometryDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	set := input.Rules
+	style := measureStyle(input.Code, set)
+	if style.Lines < minStyleLines {
+		result.Skipped = true
+		return result
+	}
+
+	aiStyle := style.aiStyleScore()
+	result.Evidence["aiStyle"] = aiStyle
+	result.Evidence["commentDensity"] = style.CommentDensity
+	result.Evidence["sentenceComments"] = style.SentenceComments
+	result.Evidence["docstringRatio"] = style.DocstringRatio
+	result.Evidence["descriptiveNames"] = style.DescriptiveNames
+	result.Evidence["advancedIdioms"] = float64(len(style.Idioms))
+
+	if aiStyle >= set.Get(rules.AICodeStyle).Threshold {
+		fireRule(&result, set, rules.AICodeStyle, aiStyle, nil)
+	}
+
+	// Past submissions are only read for final submissions
+	if !input.IsFinal {
+		return result
+	}
+	past := d.pastStyles(input.StudentID, input.ActivityID, set)
+	if len(past) < minStylePastSubmissions {
+		return result
+	}
+
+	pastScore := 0.0
+	pastIdioms := map[string]bool{}
+	for _, previous := range past {
+		pastScore += previous.aiStyleScore()
+		for idiom := range previous.Idioms {
+			pastIdioms[idiom] = true
+		}
+	}
+	pastScore /= float64(len(past))
+
+	newIdioms := []string{}
+	for idiom := range style.Idioms {
+		if !pastIdioms[idiom] {
+			newIdioms = append(newIdioms, idiom)
+		}
+	}
+	sort.Strings(newIdioms)
+
+	shift := aiStyle - pastScore
+	result.Evidence["pastSubmissions"] = float64(len(past))
+	result.Evidence["pastAiStyle"] = pastScore
+	result.Evidence["styleShift"] = shift
+	result.Evidence["newIdioms"] = float64(len(newIdioms))
+	for _, idiom := range newIdioms {
+		result.Evidence["newIdiom."+idiom] = 1
+	}
+
+	if shift > set.Get(rules.StyleShift).Threshold {
+		fireRule(&result, set, rules.StyleShift, shift, nil)
+	}
+	if float64(len(newIdioms)) >= set.Get(rules.NewLanguageFeatures).Threshold {
+		fireRule(&result, set, rules.NewLanguageFeatures, float64(len(newIdioms)), nil)
+	}
+
+	return result
+}
+
+// pastStyles measures the student's most recent submissions to other
+// activities, with the idioms of the current activity's course level
+func (d *stylometryDetector) pastStyles(studentID, activityID uint, set rules.Set) []codeStyle {
+	submissions, err := d.submissionRepo.FindByStudentID(studentID)
+	if err != nil {
+		return nil
+	}
+
+	styles := []codeStyle{}
+	for _, submission := range submissions {
+		if submission.ActivityID == activityID {
+			continue
+		}
+		style := measureStyle(submission.Code, set)
+		if style.Lines < minStyleLines {
+			continue
+		}
+		styles = append(styles, style)
+		if len(styles) == maxStylePastSubmissions {
+			break
+		}
+	}
+	return styles
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"sort"
+	"testing"
+
+	"dalivim/internal/rules"
+)
+
+const studentPython = `n = int(input())
+soma = 0
+for i in range(n):
+    x = int(input())
+    # so os positivos
+    if x > 0:
+        soma = soma + x
+print(soma)
+`
+
+const studentJava = `import java.util.Scanner;
+
+public class Main {
+    public static void main(String[] args) {
+        Scanner sc = new Scanner(System.in);
+        int n = sc.nextInt();
+        int soma = 0;
+        for (int i = 0; i < n; i++) {
+            int x = sc.nextInt();
+            if (x > 0) soma += x; // soma
+        }
+        System.out.println(soma);
+    }
+}
+`
+
+const generatedPython = `from typing import List
+
+
+def calculate_positive_sum(input_values: List[int]) -> int:
+    """Return the sum of the positive values in the list."""
+    # Filter out the negative values before summing them up.
+    positive_values = [value for value in input_values if value > 0]
+    return sum(positive_values)
+
+
+def read_input_values(file_path: str) -> List[int]:
+    """Read the values stored in the file, one per line."""
+    with open(file_path) as input_file:
+        return [int(line) for line in input_file]
+
+
+if __name__ == "__main__":
+    # Read the values and print the resulting sum.
+    try:
+        print(calculate_positive_sum(read_input_values("input.txt")))
+    except ValueError:
+        print("The input file holds an invalid value.")
+`
+
+const generatedJavaScript = `/**
+ * Returns the sum of the positive numbers in the given list.
+ */
+function sumPositiveNumbers(numberList) {
+  // Keep only the positive numbers before adding them together.
+  const positiveNumbers = numberList.filter((value) => value > 0);
+  return positiveNumbers.reduce((total, value) => total + value, 0);
+}
+
+/**
+ * Parses the raw input into a list of numbers.
+ */
+function parseInputNumbers(rawInput) {
+  const [firstLine, ...otherLines] = rawInput.trim().split("\n");
+  try {
+    return otherLines.map((line) => Number(line));
+  } catch (parseError) {
+    return [];
+  }
+}
+`
+
+func TestMeasureStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		idioms   []string
+		minScore float64
+		maxScore float64
+	}{
+		{
+			name:     "student python",
+			code:     studentPython,
+			idioms:   []string{},
+			maxScore: 0.3,
+		},
+		{
+			name:     "student java",
+			code:     studentJava,
+			idioms:   []string{},
+			maxScore: 0.3,
+		},
+		{
+			name:     "generated python",
+			code:     generatedPython,
+			idioms:   []string{"comprehension", "contextManager", "exceptionHandling", "mainGuard", "typeHints"},
+			minScore: 0.6,
+			maxScore: 1,
+		},
+		{
+			name:     "generated javascript",
+			code:     generatedJavaScript,
+			idioms:   []string{"destructuring", "exceptionHandling", "functional", "lambda"},
+			minScore: 0.6,
+			maxScore: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := measureStyle(tt.code, rules.Defaults())
+
+			idioms := []string{}
+			for idiom := range style.Idioms {
+				idioms = append(idioms, idiom)
+			}
+			sort.Strings(idioms)
+			if len(idioms) != len(tt.idioms) {
+				t.Fatalf("idioms = %v, want %v", idioms, tt.idioms)
+			}
+			for i := range idioms {
+				if idioms[i] != tt.idioms[i] {
+					t.Fatalf("idioms = %v, want %v", idioms, tt.idioms)
+				}
+			}
+
+			if score := style.aiStyleScore(); score < tt.minScore || score > tt.maxScore {
+				t.Errorf("aiStyleScore = %.2f, want between %.2f and %.2f", score, tt.minScore, tt.maxScore)
+			}
+		})
+	}
+}
+
+func TestIdiomRulesFollowTheCourse(t *testing.T) {
+	code := `const double = (value) => value * 2;
+const triple = (value) => value * 3;
+try {
+  console.log(double(2));
+} catch (error) {
+  console.log(error);
+}
+`
+	disabled := false
+	twice := 2.0
+	half := 0.5
+
+	tests := []struct {
+		name     string
+		override map[string]rules.Override
+		want     map[string]float64
+	}{
+		{
+			name: "defaults",
+			want: map[string]float64{"lambda": 1, "exceptionHandling": 1},
+		},
+		{
+			name:     "lambdas taught in the course",
+			override: map[string]rules.Override{rules.IdiomLambda: {Enabled: &disabled}},
+			want:     map[string]float64{"exceptionHandling": 1},
+		},
+		{
+			name:     "exceptions counted from two uses",
+			override: map[string]rules.Override{rules.IdiomExceptionHandling: {Threshold: &twice}},
+			want:     map[string]float64{"lambda": 1},
+		},
+		{
+			name:     "lambdas counted as half an idiom",
+			override: map[string]rules.Override{rules.IdiomLambda: {Weight: &half}},
+			want:     map[string]float64{"lambda": 0.5, "exceptionHandling": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set := rules.Defaults()
+			for name, override := range tt.override {
+				set[name] = override.Apply(set[name])
+			}
+
+			style := measureStyle(code, set)
+			if len(style.Idioms) != len(tt.want) {
+				t.Fatalf("idioms = %v, want %v", style.Idioms, tt.want)
+			}
+			for idiom, weight := range tt.want {
+				if style.Idioms[idiom] != weight {
+					t.Errorf("idioms = %v, want %v", style.Idioms, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/queue"
+	"dalivim/internal/repository"
+)
+
+var ErrIngestionBusy = errors.New("telemetry ingestion is busy, retry later")
+
+// PipelineMetrics is a point-in-time view of the ingestion pipeline
+type PipelineMetrics struct {
+	Backend      string `json:"backend"`
+	QueueDepth   int    `json:"queueDepth"`
+	Capacity     int    `json:"capacity"`
+	Workers      int    `json:"workers"`
+	Enqueued     uint64 `json:"enqueued"`
+	Rejected     uint64 `json:"rejected"`
+	Persisted    uint64 `json:"persisted"`
+	Retried      uint64 `json:"retried"`
+	DeadLettered uint64 `json:"deadLettered"`
+}
+
+// TelemetryPipeline persists non-final telemetry off the request path
+type TelemetryPipeline interface {
+	// Submit enqueues a row, returning ErrIngestionBusy when the queue is full
+	Submit(telemetry *models.TelemetryData) error
+	// Start launches the worker pool
+	Start()
+	Metrics() PipelineMetrics
+	// WaitPersisted waits up to timeout until no row of the student in the
+	// activity submitted to this pipeline is still queued. It reports
+	// whether they all left the queue.
+	WaitPersisted(activityID, studentID uint, timeout time.Duration) bool
+}
+
+// pendingKey identifies the rows of a student in an activity
+type pendingKey struct {
+	activityID uint
+	studentID  uint
+}
+
+type telemetryPipeline struct {
+	queue         queue.Queue
+	telemetryRepo repository.TelemetryRepository
+	queueRepo     repository.QueueRepository
+	cfg           queue.Config
+
+	// pending counts the queued rows of each student. Rows left over by a
+	// previous run of the database backend are not counted.
+	pendingMu sync.Mutex
+	pending   map[pendingKey]int
+
+	enqueued     atomic.Uint64
+	rejected     atomic.Uint64
+	persisted    atomic.Uint64
+	retried      atomic.Uint64
+	deadLettered atomic.Uint64
+}
+
+func NewTelemetryPipeline(
+	q queue.Queue,
+	telemetryRepo repository.TelemetryRepository,
+	queueRepo repository.QueueRepository,
+	cfg queue.Config,
+) TelemetryPipeline {
+	return &telemetryPipeline{
+		queue:         q,
+		telemetryRepo: telemetryRepo,
+		queueRepo:     queueRepo,
+		cfg:           cfg,
+		pending:       make(map[pendingKey]int),
+	}
+}
+
+func (p *telemetryPipeline) Submit(telemetry *models.TelemetryData) error {
+	item := queue.Item{Telemetry: *telemetry}
+	p.track(item)
+	if err := p.queue.Enqueue(item); err != nil {
+		p.done(item)
+		p.rejected.Add(1)
+		if errors.Is(err, queue.ErrFull) {
+			return ErrIngestionBusy
+		}
+		return err
+	}
+
+	p.enqueued.Add(1)
+	return nil
+}
+
+// pendingPollInterval is how often WaitPersisted looks at the queue
+const pendingPollInterval = 20 * time.Millisecond
+
+func (p *telemetryPipeline) WaitPersisted(activityID, studentID uint, timeout time.Duration) bool {
+	key := pendingKey{activityID: activityID, studentID: studentID}
+	deadline := time.Now().Add(timeout)
+	for {
+		p.pendingMu.Lock()
+		count := p.pending[key]
+		p.pendingMu.Unlock()
+
+		if count == 0 {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(pendingPollInterval)
+	}
+}
+
+func pendingKeyOf(item queue.Item) pendingKey {
+	return pendingKey{activityID: item.Telemetry.ActivityID, studentID: item.Telemetry.StudentID}
+}
+
+// track counts an item as queued
+func (p *telemetryPipeline) track(item queue.Item) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	p.pending[pendingKeyOf(item)]++
+}
+
+// done marks items as having left the queue: persisted, dead-lettered or
+// never enqueued
+func (p *telemetryPipeline) done(items ...queue.Item) {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	for _, item := range items {
+		key := pendingKeyOf(item)
+		if p.pending[key] <= 1 {
+			delete(p.pending, key)
+			continue
+		}
+		p.pending[key]--
+	}
+}
+
+func (p *telemetryPipeline) Start() {
+	for i := 0; i < p.cfg.Workers; i++ {
+		go p.work()
+	}
+}
+
+func (p *telemetryPipeline) Metrics() PipelineMetrics {
+	return PipelineMetrics{
+		Backend:      p.cfg.Backend,
+		QueueDepth:   p.queue.Depth(),
+		Capacity:     p.cfg.Capacity,
+		Workers:      p.cfg.Workers,
+		Enqueued:     p.enqueued.Load(),
+		Rejected:     p.rejected.Load(),
+		Persisted:    p.persisted.Load(),
+		Retried:      p.retried.Load(),
+		DeadLettered: p.deadLettered.Load(),
+	}
+}
+
+func (p *telemetryPipeline) work() {
+	for {
+		items, err := p.queue.Dequeue(p.cfg.BatchSize, p.cfg.FlushInterval)
+		if err != nil {
+			log.Printf("telemetry pipeline: dequeue failed: %v", err)
+			time.Sleep(p.cfg.RetryBackoff)
+			continue
+		}
+		if len(items) > 0 {
+			p.persist(items)
+		}
+	}
+}
+
+// persist inserts a batch in one statement. If that fails, rows are retried
+// one by one so a single bad row does not hold back the others.
+func (p *telemetryPipeline) persist(items []queue.Item) {
+	rows := make([]models.TelemetryData, len(items))
+	for i, item := range items {
+		rows[i] = item.Telemetry
+	}
+
+	if err := p.telemetryRepo.CreateBatch(rows); err == nil {
+		p.persisted.Add(uint64(len(rows)))
+		p.done(items...)
+		p.ack(items...)
+		return
+	}
+
+	for _, item := range items {
+		row := item.Telemetry
+		if err := p.telemetryRepo.Create(&row); err != nil {
+			p.retry(item, err)
+			continue
+		}
+		p.persisted.Add(1)
+		p.done(item)
+		p.ack(item)
+	}
+}
+
+// ack releases items from the queue once handled. A failed ack only means the
+// item is delivered again.
+func (p *telemetryPipeline) ack(items ...queue.Item) {
+	if err := p.queue.Ack(items); err != nil {
+		log.Printf("telemetry pipeline: ack failed: %v", err)
+	}
+}
+
+func (p *telemetryPipeline) retry(item queue.Item, cause error) {
+	item.Attempts++
+	if item.Attempts >= p.cfg.MaxAttempts {
+		p.deadLetter(item, cause)
+		return
+	}
+
+	// The item itself is put back, so it neither takes a second place in
+	// the queue nor is lost if the server stops during the backoff
+	p.retried.Add(1)
+	backoff := p.cfg.RetryBackoff * time.Duration(item.Attempts)
+	if err := p.queue.Retry(item, backoff); err != nil {
+		// The item stays leased and is delivered again once the lease expires
+		log.Printf("telemetry pipeline: retry failed: %v", err)
+	}
+}
+
+func (p *telemetryPipeline) deadLetter(item queue.Item, cause error) {
+	payload, _ := json.Marshal(item.Telemetry)
+
+	deadLetter := &models.TelemetryDeadLetter{
+		ActivityID: item.Telemetry.ActivityID,
+		StudentID:  item.Telemetry.StudentID,
+		Payload:    string(payload),
+		Attempts:   item.Attempts,
+		LastError:  cause.Error(),
+	}
+
+	// The row will not be persisted, so it no longer counts as pending
+	p.done(item)
+
+	if err := p.queueRepo.CreateDeadLetter(deadLetter); err != nil {
+		log.Printf("telemetry pipeline: dead-lettering failed: %v", err)
+		return
+	}
+	p.deadLettered.Add(1)
+	p.ack(item)
+}
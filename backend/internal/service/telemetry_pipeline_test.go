@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/queue"
+	"dalivim/internal/repository"
+)
+
+type recordingQueue struct {
+	queue.Queue
+
+	mu       sync.Mutex
+	enqueued []queue.Item
+	acked    []uint
+	retried  []queue.Item
+}
+
+func (q *recordingQueue) Enqueue(item queue.Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.enqueued = append(q.enqueued, item)
+	return nil
+}
+
+func (q *recordingQueue) Ack(items []queue.Item) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, item := range items {
+		q.acked = append(q.acked, item.JobID)
+	}
+	return nil
+}
+
+func (q *recordingQueue) Retry(item queue.Item, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.retried = append(q.retried, item)
+	return nil
+}
+
+func (q *recordingQueue) snapshot() ([]queue.Item, []uint) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]queue.Item(nil), q.enqueued...), append([]uint(nil), q.acked...)
+}
+
+type failingTelemetryRepo struct {
+	repository.TelemetryRepository
+	fail bool
+}
+
+func (r *failingTelemetryRepo) CreateBatch(telemetry []models.TelemetryData) error {
+	if r.fail {
+		return errors.New("insert failed")
+	}
+	return nil
+}
+
+func (r *failingTelemetryRepo) Create(telemetry *models.TelemetryData) error {
+	return r.CreateBatch(nil)
+}
+
+func TestPipelineAcksPersistedItems(t *testing.T) {
+	q := &recordingQueue{}
+	pipeline := NewTelemetryPipeline(q, &failingTelemetryRepo{}, nil, queue.Config{MaxAttempts: 3}).(*telemetryPipeline)
+
+	pipeline.persist([]queue.Item{{JobID: 1}, {JobID: 2}})
+
+	if _, acked := q.snapshot(); len(acked) != 2 {
+		t.Errorf("acked %v, want both jobs", acked)
+	}
+}
+
+func TestPipelineRetriesFailedItemInPlace(t *testing.T) {
+	q := &recordingQueue{}
+	pipeline := NewTelemetryPipeline(q, &failingTelemetryRepo{fail: true}, nil, queue.Config{
+		MaxAttempts:  3,
+		RetryBackoff: 10 * time.Millisecond,
+	}).(*telemetryPipeline)
+
+	row := models.TelemetryData{ActivityID: 1, StudentID: 2}
+	if err := pipeline.Submit(&row); err != nil {
+		t.Fatal(err)
+	}
+	enqueued, _ := q.snapshot()
+	enqueued[0].JobID = 1
+	pipeline.persist(enqueued)
+
+	enqueued, acked := q.snapshot()
+	if len(enqueued) != 1 || len(acked) != 0 {
+		t.Errorf("failed item enqueued again as %v and acked as %v, want it put back", enqueued, acked)
+	}
+	if len(q.retried) != 1 || q.retried[0].JobID != 1 || q.retried[0].Attempts != 1 {
+		t.Errorf("retried %+v, want job 1 on attempt 1", q.retried)
+	}
+	if pipeline.WaitPersisted(1, 2, 0) {
+		t.Error("retried row no longer pending")
+	}
+}
+
+func TestWaitPersistedWaitsForQueuedRows(t *testing.T) {
+	q := &recordingQueue{}
+	pipeline := NewTelemetryPipeline(q, &failingTelemetryRepo{}, nil, queue.Config{MaxAttempts: 3}).(*telemetryPipeline)
+
+	row := models.TelemetryData{ActivityID: 1, StudentID: 2}
+	if err := pipeline.Submit(&row); err != nil {
+		t.Fatal(err)
+	}
+	if pipeline.WaitPersisted(1, 2, 50*time.Millisecond) {
+		t.Fatal("row reported persisted while still queued")
+	}
+	if !pipeline.WaitPersisted(1, 3, 0) {
+		t.Error("another student waits for the row")
+	}
+
+	enqueued, _ := q.snapshot()
+	go pipeline.persist(enqueued)
+	if !pipeline.WaitPersisted(1, 2, time.Second) {
+		t.Error("row still pending after it was persisted")
+	}
+}
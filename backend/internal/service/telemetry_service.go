@@ -1,99 +1,559 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
 
 	"dalivim/internal/models"
 	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+var (
+	ErrStudentNotFound    = errors.New("student not found")
+	ErrSubmissionNotSaved = errors.New("submission could not be saved")
 )
 
 type TelemetryService interface {
-	ProcessTelemetry(activityID, studentID uint, timestamp int64, isFinal bool, code string, features, rawEvents map[string]interface{}) (AnalysisResult, error)
+	ProcessTelemetry(batch TelemetryBatch) (ProcessResult, error)
 	GetSubmissions(activityID uint) ([]models.Submission, error)
+	GetOutages(activityID uint) ([]models.TelemetryOutage, error)
+	PipelineMetrics() PipelineMetrics
+	// Start launches the workers analyzing final submissions
+	Start()
+	// WaitAnalyzed waits for the pending analyses of an activity's finals
+	WaitAnalyzed(activityID uint, timeout time.Duration) bool
+}
+
+// TelemetryBatch is one telemetry upload from the editor. SessionID,
+// Sequence, PrevHash and Signature link the batch into the session's
+// hash chain (see signBatch).
+type TelemetryBatch struct {
+	ActivityID uint
+	StudentID  uint
+	SessionID  uint
+	Sequence   int64
+	PrevHash   string
+	Signature  string
+	Timestamp  int64
+	SentAt     int64 // Client time of upload, later than Timestamp for buffered batches
+	Buffered   bool  // Set by clients replaying batches buffered while offline
+	IsFinal    bool
+	Code       string
+	Features   map[string]interface{}
+	RawEvents  map[string]interface{}
+
+	// InheritedFeatures stand in for Features when the client omitted them,
+	// as stream frames may. They are not part of the signed payload.
+	InheritedFeatures map[string]interface{}
+
+	// IdempotencyKey lets clients retry a final submission safely
+	IdempotencyKey string
+}
+
+// ProcessResult is the answer to a telemetry batch. Receipt is only set for
+// a final submission that was saved. The analysis of a final is left empty
+// while AnalysisPending; it is then read from the submission.
+type ProcessResult struct {
+	AnalysisResult
+	Receipt         *SubmissionReceipt `json:"receipt,omitempty"`
+	AnalysisPending bool               `json:"analysisPending,omitempty"`
+}
+
+// SubmissionReceipt proves a final submission was stored. Duplicate is set
+// when the submission had already been received before.
+type SubmissionReceipt struct {
+	ReceiptID    string    `json:"receiptId"`
+	SubmissionID uint      `json:"submissionId"`
+	SubmittedAt  time.Time `json:"submittedAt"`
+	Duplicate    bool      `json:"duplicate"`
+
+	submission *models.Submission
 }
 
 type telemetryService struct {
-	telemetryRepo   repository.TelemetryRepository
-	submissionRepo  repository.SubmissionRepository
-	userRepo        repository.UserRepository
-	analysisService AnalysisService
+	telemetryRepo     repository.TelemetryRepository
+	submissionRepo    repository.SubmissionRepository
+	userRepo          repository.UserRepository
+	sessionRepo       repository.SessionRepository
+	activityRepo      repository.ActivityRepository
+	outageRepo        repository.OutageRepository
+	archiveRepo       repository.ArchiveRepository
+	profileRepo       repository.KeystrokeProfileRepository
+	analysisService   AnalysisService
+	proctoringService ProctoringService
+	pipeline          TelemetryPipeline
+
+	// sessionLocks holds one lock per session with batches in flight, so
+	// concurrent batches of the same session cannot both advance its chain
+	locksMu      sync.Mutex
+	sessionLocks map[uint]*sessionLock
+
+	// Finals waiting for or under analysis, see analyzeFinal
+	analysisWorkers int
+	analysisJobs    chan uint
+	inFlightMu      sync.Mutex
+	inFlight        map[uint]bool
+}
+
+// sessionLock is dropped once no batch of the session holds or waits for it
+type sessionLock struct {
+	mu      sync.Mutex
+	holders int
 }
 
 func NewTelemetryService(
 	telemetryRepo repository.TelemetryRepository,
 	submissionRepo repository.SubmissionRepository,
 	userRepo repository.UserRepository,
+	sessionRepo repository.SessionRepository,
+	activityRepo repository.ActivityRepository,
+	outageRepo repository.OutageRepository,
+	archiveRepo repository.ArchiveRepository,
+	profileRepo repository.KeystrokeProfileRepository,
 	analysisService AnalysisService,
+	proctoringService ProctoringService,
+	pipeline TelemetryPipeline,
+	analysisWorkers int,
 ) TelemetryService {
 	return &telemetryService{
-		telemetryRepo:   telemetryRepo,
-		submissionRepo:  submissionRepo,
-		userRepo:        userRepo,
-		analysisService: analysisService,
+		telemetryRepo:     telemetryRepo,
+		submissionRepo:    submissionRepo,
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		activityRepo:      activityRepo,
+		outageRepo:        outageRepo,
+		archiveRepo:       archiveRepo,
+		profileRepo:       profileRepo,
+		analysisService:   analysisService,
+		proctoringService: proctoringService,
+		pipeline:          pipeline,
+		sessionLocks:      make(map[uint]*sessionLock),
+		analysisWorkers:   analysisWorkers,
+		analysisJobs:      make(chan uint, analysisQueueSize),
+		inFlight:          make(map[uint]bool),
 	}
 }
 
-func (s *telemetryService) ProcessTelemetry(
-	activityID, studentID uint,
-	timestamp int64,
-	isFinal bool,
-	code string,
-	features, rawEvents map[string]interface{},
-) (AnalysisResult, error) {
-	// Analyze behavior
-	analysis := s.analysisService.Analyze(features)
+func (s *telemetryService) ProcessTelemetry(batch TelemetryBatch) (ProcessResult, error) {
+	// Features are derived into a copy: the batch must stay as the client
+	// signed it until verifyIntegrity checks it
+	source := batch.Features
+	if source == nil {
+		source = batch.InheritedFeatures
+	}
+	features := copyFeatures(source)
+	rawEvents := batch.RawEvents
+
+	// Derive navigation features from cursor, selection and undo events
+	deriveNavigationFeatures(features, rawEvents)
+
+	// Finals are only saved here. Paste attribution, the session replay and
+	// the analysis run on the final analysis workers (see analyzeFinal), so
+	// the submissions at the end of an exam do not queue up behind them.
+	// Other batches get a provisional analysis for the live dashboard.
+	var analysis AnalysisResult
+	if batch.IsFinal {
+		if _, ok := features["codeLength"]; !ok {
+			features["codeLength"] = float64(len(batch.Code))
+		}
+	} else {
+		analysis = s.analysisService.Analyze(AnalysisInput{
+			ActivityID: batch.ActivityID,
+			StudentID:  batch.StudentID,
+			Code:       batch.Code,
+			Features:   features,
+			RawEvents:  rawEvents,
+		})
+	}
+	result := ProcessResult{AnalysisResult: analysis}
+
+	// Verify the batch against the session hash chain. The chain only
+	// advances once the batch has been accepted for persistence, so a batch
+	// rejected as busy can be resent unchanged.
+	unlock := s.lockSession(batch.SessionID)
+	defer unlock()
+
+	// A retried final returns the receipt of the first attempt, before the
+	// chain would flag it as a replay
+	var idempotencyKey string
+	if batch.IsFinal {
+		idempotencyKey = finalIdempotencyKey(batch)
+		if receipt, ok := s.findReceipt(idempotencyKey); ok {
+			return s.duplicateResult(receipt), nil
+		}
+	}
+
+	session, integrity, integritySignals := s.verifyIntegrity(batch)
+
+	// Reconcile batches buffered while the student was offline. They keep
+	// their client timestamp, so they fall into place in the timeline.
+	receivedAt := time.Now().UnixMilli()
+	late := isLateBatch(batch)
+	if late {
+		if _, err := s.recordOutage(batch, receivedAt); err != nil {
+			return result, err
+		}
+		integritySignals = appendSignal(integritySignals, SignalOfflineBufferedBatches)
+		if session != nil {
+			session.AddIntegritySignal(SignalOfflineBufferedBatches)
+		}
+	}
+
+	// A rejected late final is still stored as telemetry, but creates no submission
+	var lateErr error
+	if batch.IsFinal {
+		var lateSignal string
+		lateSignal, lateErr = s.checkLateFinal(batch, session, receivedAt)
+		if lateSignal != "" {
+			integritySignals = appendSignal(integritySignals, lateSignal)
+			if session != nil {
+				session.AddIntegritySignal(lateSignal)
+			}
+		}
+	}
 
 	// Save telemetry data
 	featuresJSON, _ := json.Marshal(features)
 	eventsJSON, _ := json.Marshal(rawEvents)
 
 	telemetry := &models.TelemetryData{
-		ActivityID: activityID,
-		StudentID:  studentID,
-		Timestamp:  timestamp,
-		IsFinal:    isFinal,
+		ActivityID: batch.ActivityID,
+		StudentID:  batch.StudentID,
+		SessionID:  batch.SessionID,
+		Sequence:   batch.Sequence,
+		Timestamp:  batch.Timestamp,
+		ReceivedAt: receivedAt,
+		Late:       late,
+		IsFinal:    batch.IsFinal,
 		Features:   string(featuresJSON),
 		RawEvents:  string(eventsJSON),
+		Signature:  batch.Signature,
+		Integrity:  integrity,
+	}
+
+	switch {
+	case !batch.IsFinal:
+		// Non-final telemetry is persisted asynchronously by the pipeline
+		if err := s.pipeline.Submit(telemetry); err != nil {
+			return result, err
+		}
+	case lateErr != nil:
+		if err := s.telemetryRepo.Create(telemetry); err != nil {
+			return result, err
+		}
+	default:
+		receipt, duplicate, err := s.saveFinal(batch, features, telemetry, integritySignals, idempotencyKey)
+		if err != nil {
+			return result, err
+		}
+		if duplicate {
+			return s.duplicateResult(receipt), nil
+		}
+		result.Receipt = receipt
+		result.AnalysisPending = true
+		s.enqueueAnalysis(receipt.SubmissionID)
+	}
+
+	if session != nil {
+		if err := s.sessionRepo.Update(session); err != nil {
+			return result, err
+		}
+	}
+
+	// Feed the live proctoring dashboard. Saved finals are reported by the
+	// worker that analyzes them.
+	if !batch.IsFinal {
+		observed := batch
+		observed.Features = features
+		s.proctoringService.Observe(observed, analysis, integrity)
+	}
+
+	return result, lateErr
+}
+
+// saveFinal stores the final telemetry and its submission in one
+// transaction, with the analysis pending. duplicate is true when a
+// concurrent attempt with the same idempotency key won the race; the
+// receipt is then the one of that attempt.
+func (s *telemetryService) saveFinal(
+	batch TelemetryBatch,
+	features map[string]interface{},
+	telemetry *models.TelemetryData,
+	integritySignals []string,
+	idempotencyKey string,
+) (*SubmissionReceipt, bool, error) {
+	student, err := s.userRepo.FindByID(batch.StudentID)
+	if err != nil {
+		return nil, false, ErrStudentNotFound
 	}
 
-	if err := s.telemetryRepo.Create(telemetry); err != nil {
-		return analysis, err
+	pasteEventsJSON, _ := json.Marshal(batch.RawEvents["pasteEvents"])
+
+	submission := &models.Submission{
+		ActivityID:           batch.ActivityID,
+		StudentID:            batch.StudentID,
+		StudentName:          student.Name,
+		StudentEmail:         student.Email,
+		Code:                 batch.Code,
+		AnalysisPending:      true,
+		AvgKeystrokeInterval: getFloat(features, "avgKeystrokeInterval"),
+		StdKeystrokeInterval: getFloat(features, "stdKeystrokeInterval"),
+		PasteEvents:          getInt(features, "pasteEvents"),
+		PasteCharRatio:       getFloat(features, "pasteCharRatio"),
+		DeleteRatio:          getFloat(features, "deleteRatio"),
+		FocusLossCount:       getInt(features, "focusLossCount"),
+		LinearEditingScore:   getFloat(features, "linearEditingScore"),
+		Burstiness:           getFloat(features, "burstiness"),
+		TimeToFirstRun:       getFloat(features, "timeToFirstRun"),
+		ExecutionCount:       getInt(features, "executionCount"),
+		TotalTime:            getFloat(features, "totalTime"),
+		KeystrokeCount:       getInt(features, "totalKeystrokes"),
+		PasteEventDetails:    string(pasteEventsJSON),
+		NonLinearNavigation:  getOptionalFloat(features, "nonLinearNavigationRatio"),
+		UndoFrequency:        getOptionalFloat(features, "undoFrequency"),
+		SelectionCount:       getInt(features, "selectionCount"),
+		FindReplaceCount:     getInt(features, "findReplaceCount"),
+		SessionID:            batch.SessionID,
+		IntegrityArray:       integritySignals,
+		ReceiptID:            generateReceiptID(),
+	}
+	if idempotencyKey != "" {
+		submission.IdempotencyKey = &idempotencyKey
 	}
 
-	// If final submission, create submission record
-	if isFinal {
-		student, _ := s.userRepo.FindByID(studentID)
+	if err := s.submissionRepo.CreateWithTelemetry(submission, telemetry); err != nil {
+		if receipt, ok := s.findReceipt(idempotencyKey); ok {
+			return receipt, true, nil
+		}
+		return nil, false, fmt.Errorf("%w: %v", ErrSubmissionNotSaved, err)
+	}
 
-		pasteEventsJSON, _ := json.Marshal(rawEvents["pasteEvents"])
+	return newReceipt(submission, false), false, nil
+}
 
-		submission := &models.Submission{
-			ActivityID:           activityID,
-			StudentID:            studentID,
-			StudentName:          student.Name,
-			StudentEmail:         student.Email,
-			Code:                 code,
-			AuthorshipScore:      analysis.AuthorshipScore,
-			Confidence:           analysis.Confidence,
-			SignalsArray:         analysis.Signals,
-			AvgKeystrokeInterval: getFloat(features, "avgKeystrokeInterval"),
-			StdKeystrokeInterval: getFloat(features, "stdKeystrokeInterval"),
-			PasteEvents:          getInt(features, "pasteEvents"),
-			PasteCharRatio:       getFloat(features, "pasteCharRatio"),
-			DeleteRatio:          getFloat(features, "deleteRatio"),
-			FocusLossCount:       getInt(features, "focusLossCount"),
-			LinearEditingScore:   getFloat(features, "linearEditingScore"),
-			Burstiness:           getFloat(features, "burstiness"),
-			TimeToFirstRun:       getFloat(features, "timeToFirstRun"),
-			ExecutionCount:       getInt(features, "executionCount"),
-			TotalTime:            getFloat(features, "totalTime"),
-			KeystrokeCount:       getInt(features, "totalKeystrokes"),
-			PasteEventDetails:    string(pasteEventsJSON),
+// recheckPeerPastes matches the external pastes of the activity's earlier
+// submissions against a new one. Matched submissions get the
+// paste_from_peer_submission signal right away; their score follows on the
+// next re-analysis, which reads the stored provenance.
+func (s *telemetryService) recheckPeerPastes(submission *models.Submission) {
+	set, err := s.analysisService.GetRules(submission.ActivityID)
+	if err != nil || !set.Get(rules.PasteFromPeer).Enabled {
+		return
+	}
+
+	peers, err := s.submissionRepo.FindByActivityID(submission.ActivityID)
+	if err != nil {
+		return
+	}
+	for i := range peers {
+		peer := &peers[i]
+		if peer.StudentID == submission.StudentID {
+			continue
+		}
+
+		provenance, matched := matchLaterPeer(peer, submission)
+		if !matched {
+			continue
 		}
+		provenanceJSON, _ := json.Marshal(provenance)
+		peer.PasteProvenance = string(provenanceJSON)
+		peer.SignalsArray = appendSignal(peer.SignalsArray, rules.PasteFromPeer)
+		if err := s.submissionRepo.UpdatePasteProvenance(peer); err != nil {
+			log.Printf("failed to update paste provenance of submission %d: %v", peer.ID, err)
+		}
+	}
+}
 
-		s.submissionRepo.Create(submission)
+// classifyPastes compares the pastes of a final batch with the editor's own
+// copies, the activity starter code and the other submissions of the activity
+func (s *telemetryService) classifyPastes(batch TelemetryBatch) []PasteProvenance {
+	var pastes []models.PasteEvent
+	if !decodeEvents(batch.RawEvents, "pasteEvents", &pastes) || len(pastes) == 0 {
+		return nil
 	}
 
-	return analysis, nil
+	var copies []models.CopyEvent
+	decodeEvents(batch.RawEvents, "copyEvents", &copies)
+
+	activity, _ := s.activityRepo.FindByID(batch.ActivityID)
+
+	submissions, _ := s.submissionRepo.FindByActivityID(batch.ActivityID)
+	peers := make([]models.Submission, 0, len(submissions))
+	for _, submission := range submissions {
+		if submission.StudentID != batch.StudentID {
+			peers = append(peers, submission)
+		}
+	}
+
+	return classifyPastes(pastes, copies, activity, peers)
+}
+
+func (s *telemetryService) findReceipt(idempotencyKey string) (*SubmissionReceipt, bool) {
+	if idempotencyKey == "" {
+		return nil, false
+	}
+
+	submission, err := s.submissionRepo.FindByIdempotencyKey(idempotencyKey)
+	if err != nil {
+		return nil, false
+	}
+	return newReceipt(submission, true), true
+}
+
+// duplicateResult answers a retried final with the stored analysis
+func (s *telemetryService) duplicateResult(receipt *SubmissionReceipt) ProcessResult {
+	return ProcessResult{
+		AnalysisResult: AnalysisResult{
+			AuthorshipScore: receipt.submission.AuthorshipScore,
+			Confidence:      receipt.submission.Confidence,
+			ConfidenceScore: receipt.submission.ConfidenceScore,
+			Signals:         receipt.submission.SignalsArray,
+			SignalDetails:   receipt.submission.SignalDetails,
+			Detectors:       receipt.submission.DetectorArray,
+			AnalysisVersion: receipt.submission.AnalysisVersion,
+		},
+		Receipt:         receipt,
+		AnalysisPending: receipt.submission.AnalysisPending,
+	}
+}
+
+// finalIdempotencyKey uses the client key when given. Otherwise a signed
+// session can only be submitted once.
+func finalIdempotencyKey(batch TelemetryBatch) string {
+	if batch.IdempotencyKey != "" {
+		return fmt.Sprintf("activity:%d:student:%d:%s", batch.ActivityID, batch.StudentID, batch.IdempotencyKey)
+	}
+	if batch.SessionID != 0 {
+		return fmt.Sprintf("session:%d:final", batch.SessionID)
+	}
+	return ""
+}
+
+func newReceipt(submission *models.Submission, duplicate bool) *SubmissionReceipt {
+	return &SubmissionReceipt{
+		ReceiptID:    submission.ReceiptID,
+		SubmissionID: submission.ID,
+		SubmittedAt:  submission.CreatedAt,
+		Duplicate:    duplicate,
+		submission:   submission,
+	}
+}
+
+func generateReceiptID() string {
+	bytes := make([]byte, 12)
+	rand.Read(bytes)
+	return "rcpt_" + hex.EncodeToString(bytes)
+}
+
+// verifyIntegrity checks the batch signature and hash chain. It returns the
+// session with its chain advanced (nil for unsigned batches), the status of
+// this batch and every integrity signal accumulated by the session.
+// Batches that fail verification are still stored, flagged with their status.
+func (s *telemetryService) verifyIntegrity(batch TelemetryBatch) (*models.TelemetrySession, string, []string) {
+	if batch.SessionID == 0 || batch.Signature == "" {
+		return nil, SignalUnsignedTelemetry, []string{SignalUnsignedTelemetry}
+	}
+
+	session, err := s.sessionRepo.FindByID(batch.SessionID)
+	if err != nil {
+		return nil, SignalSessionMismatch, []string{SignalSessionMismatch}
+	}
+
+	status := verifyChain(session, batch)
+	return session, status, session.IntegritySignalsArray
+}
+
+func (s *telemetryService) checkLateFinal(batch TelemetryBatch, session *models.TelemetrySession, receivedAt int64) (string, error) {
+	if session == nil && batch.SessionID != 0 {
+		session, _ = s.sessionRepo.FindByID(batch.SessionID)
+	}
+
+	activity, err := s.activityRepo.FindByID(batch.ActivityID)
+	if err != nil {
+		return "", nil
+	}
+
+	return checkLateFinal(batch, session, activity, receivedAt)
+}
+
+// pendingTelemetryWait bounds how long a final batch waits for the earlier
+// batches of its student to leave the ingestion queue
+const pendingTelemetryWait = 5 * time.Second
+
+// studentTelemetry returns the stored telemetry of the batch's student in
+// the activity, once their queued batches are persisted. complete is false
+// when some were still queued after pendingTelemetryWait or the telemetry
+// could not be read.
+func (s *telemetryService) studentTelemetry(batch TelemetryBatch) (stored []models.TelemetryData, complete bool) {
+	complete = s.pipeline.WaitPersisted(batch.ActivityID, batch.StudentID, pendingTelemetryWait)
+
+	stored, err := loadTelemetry(s.telemetryRepo, s.archiveRepo, batch.ActivityID, batch.StudentID)
+	if err != nil {
+		log.Printf("failed to load telemetry of student %d: %v", batch.StudentID, err)
+		return nil, false
+	}
+	return stored, complete
+}
+
+func copyFeatures(features map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(features))
+	for name, value := range features {
+		copied[name] = value
+	}
+	return copied
+}
+
+// appendSignal appends a signal unless it is already present
+func appendSignal(signals []string, signal string) []string {
+	for _, existing := range signals {
+		if existing == signal {
+			return signals
+		}
+	}
+	return append(signals, signal)
+}
+
+func (s *telemetryService) GetOutages(activityID uint) ([]models.TelemetryOutage, error) {
+	return s.outageRepo.FindByActivityID(activityID)
+}
+
+// lockSession is a no-op for unsigned batches, which have no chain to protect
+func (s *telemetryService) lockSession(sessionID uint) func() {
+	if sessionID == 0 {
+		return func() {}
+	}
+
+	s.locksMu.Lock()
+	lock, ok := s.sessionLocks[sessionID]
+	if !ok {
+		lock = &sessionLock{}
+		s.sessionLocks[sessionID] = lock
+	}
+	lock.holders++
+	s.locksMu.Unlock()
+
+	lock.mu.Lock()
+	return func() {
+		lock.mu.Unlock()
+
+		s.locksMu.Lock()
+		lock.holders--
+		if lock.holders == 0 {
+			delete(s.sessionLocks, sessionID)
+		}
+		s.locksMu.Unlock()
+	}
+}
+
+func (s *telemetryService) PipelineMetrics() PipelineMetrics {
+	return s.pipeline.Metrics()
 }
 
 func (s *telemetryService) GetSubmissions(activityID uint) ([]models.Submission, error) {
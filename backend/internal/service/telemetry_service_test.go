@@ -0,0 +1,368 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"dalivim/internal/models"
+	"dalivim/internal/repository"
+	"dalivim/internal/rules"
+)
+
+// Fakes embed the repository interfaces, so a test panics on any call it
+// did not expect
+
+type fakeSessionRepo struct {
+	repository.SessionRepository
+	sessions map[uint]*models.TelemetrySession
+}
+
+func (r *fakeSessionRepo) FindByID(id uint) (*models.TelemetrySession, error) {
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (r *fakeSessionRepo) Update(session *models.TelemetrySession) error {
+	copied := *session
+	r.sessions[session.ID] = &copied
+	return nil
+}
+
+type fakePipeline struct {
+	TelemetryPipeline
+	submitted []models.TelemetryData
+}
+
+func (p *fakePipeline) Submit(telemetry *models.TelemetryData) error {
+	p.submitted = append(p.submitted, *telemetry)
+	return nil
+}
+
+// WaitPersisted finds nothing queued: submitted rows are never persisted
+func (p *fakePipeline) WaitPersisted(activityID, studentID uint, timeout time.Duration) bool {
+	return true
+}
+
+type fakeArchiveRepo struct {
+	repository.ArchiveRepository
+	archives []models.TelemetryArchive
+}
+
+func (r fakeArchiveRepo) FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryArchive, error) {
+	return r.archives, nil
+}
+
+type fakeAnalysisService struct {
+	AnalysisService
+}
+
+func (fakeAnalysisService) Analyze(input AnalysisInput) AnalysisResult {
+	return AnalysisResult{AuthorshipScore: 1, Signals: []string{}}
+}
+
+func (fakeAnalysisService) GetRules(activityID uint) (rules.Set, error) {
+	return rules.Defaults(), nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+}
+
+func (fakeUserRepo) FindByID(id uint) (*models.User, error) {
+	return &models.User{ID: id, Name: "Student", Role: "student"}, nil
+}
+
+type fakeActivityRepo struct {
+	repository.ActivityRepository
+	activity models.Activity
+}
+
+func (r *fakeActivityRepo) FindByID(id uint) (*models.Activity, error) {
+	activity := r.activity
+	return &activity, nil
+}
+
+type fakeTelemetryRepo struct {
+	repository.TelemetryRepository
+	stored []models.TelemetryData
+}
+
+func (r *fakeTelemetryRepo) FindByActivityAndStudent(activityID, studentID uint) ([]models.TelemetryData, error) {
+	return r.stored, nil
+}
+
+type fakeSubmissionRepo struct {
+	repository.SubmissionRepository
+	submissions []models.Submission
+	updated     []models.Submission
+}
+
+func (r *fakeSubmissionRepo) CreateWithTelemetry(submission *models.Submission, telemetry *models.TelemetryData) error {
+	submission.ID = uint(len(r.submissions) + 1)
+	r.submissions = append(r.submissions, *submission)
+	return nil
+}
+
+func (r *fakeSubmissionRepo) FindByID(id uint) (*models.Submission, error) {
+	if id == 0 || int(id) > len(r.submissions) {
+		return nil, errors.New("not found")
+	}
+	submission := r.submissions[id-1]
+	return &submission, nil
+}
+
+func (r *fakeSubmissionRepo) CompleteAnalysis(id uint, apply func(submission *models.Submission) *models.AnalysisRun, updateBaseline func(baseline *models.StudentBaseline)) (bool, error) {
+	submission := &r.submissions[id-1]
+	if !submission.AnalysisPending {
+		return false, nil
+	}
+	apply(submission)
+	submission.AnalysisPending = false
+	updateBaseline(&models.StudentBaseline{StudentID: submission.StudentID, Features: map[string]models.FeatureStats{}})
+	return true, nil
+}
+
+func (r *fakeSubmissionRepo) FindByIdempotencyKey(key string) (*models.Submission, error) {
+	return nil, errors.New("not found")
+}
+
+func (r *fakeSubmissionRepo) FindByActivityID(activityID uint) ([]models.Submission, error) {
+	return append([]models.Submission(nil), r.submissions...), nil
+}
+
+func (r *fakeSubmissionRepo) UpdatePasteProvenance(submission *models.Submission) error {
+	r.updated = append(r.updated, *submission)
+	return nil
+}
+
+func newTestTelemetryService(sessionRepo *fakeSessionRepo, pipeline *fakePipeline) *telemetryService {
+	return NewTelemetryService(
+		nil, nil, nil,
+		sessionRepo,
+		nil, nil, fakeArchiveRepo{}, nil,
+		fakeAnalysisService{},
+		NewProctoringService(),
+		pipeline,
+		1,
+	).(*telemetryService)
+}
+
+// decodeJSON builds features and events the way the handler receives them
+func decodeJSON(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestSignedBatchWithNavigationEventsVerifies(t *testing.T) {
+	sessionRepo := &fakeSessionRepo{sessions: map[uint]*models.TelemetrySession{
+		7: {ID: 7, ActivityID: 1, StudentID: 2, SessionKey: "secret"},
+	}}
+	pipeline := &fakePipeline{}
+	service := newTestTelemetryService(sessionRepo, pipeline)
+
+	batch := TelemetryBatch{
+		ActivityID: 1,
+		StudentID:  2,
+		SessionID:  7,
+		Sequence:   1,
+		Timestamp:  time.Now().UnixMilli(),
+		Code:       "print('hi')",
+		Features:   decodeJSON(t, `{"totalKeystrokes": 40}`),
+		RawEvents: decodeJSON(t, `{
+			"cursorEvents": [{"timestamp": 1, "lineNumber": 1, "column": 1, "source": "keyboard"},
+			                 {"timestamp": 2, "lineNumber": 9, "column": 1, "source": "mouse"}],
+			"undoRedoEvents": [{"timestamp": 3, "type": "undo"}]
+		}`),
+	}
+	batch.Signature = signBatch("secret", batch)
+
+	if _, err := service.ProcessTelemetry(batch); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pipeline.submitted) != 1 {
+		t.Fatalf("submitted %d rows, want 1", len(pipeline.submitted))
+	}
+	stored := pipeline.submitted[0]
+	if stored.Integrity != integrityOK {
+		t.Errorf("integrity = %q, want %q", stored.Integrity, integrityOK)
+	}
+	if _, derived := batch.Features["undoFrequency"]; derived {
+		t.Error("derived features were written into the signed batch")
+	}
+
+	var features map[string]interface{}
+	json.Unmarshal([]byte(stored.Features), &features)
+	if _, ok := features["undoFrequency"]; !ok {
+		t.Error("stored features miss the derived undoFrequency")
+	}
+
+	if session := sessionRepo.sessions[7]; session.LastSequence != 1 || session.LastHash != batch.Signature {
+		t.Errorf("chain at %d/%q, want it advanced to the batch", session.LastSequence, session.LastHash)
+	}
+}
+
+func TestSignedBatchWithoutFeaturesVerifies(t *testing.T) {
+	sessionRepo := &fakeSessionRepo{sessions: map[uint]*models.TelemetrySession{
+		7: {ID: 7, ActivityID: 1, StudentID: 2, SessionKey: "secret"},
+	}}
+	pipeline := &fakePipeline{}
+	service := newTestTelemetryService(sessionRepo, pipeline)
+
+	batch := TelemetryBatch{ActivityID: 1, StudentID: 2, SessionID: 7, Sequence: 1, Timestamp: time.Now().UnixMilli()}
+	batch.Signature = signBatch("secret", batch)
+
+	if _, err := service.ProcessTelemetry(batch); err != nil {
+		t.Fatal(err)
+	}
+	if integrity := pipeline.submitted[0].Integrity; integrity != integrityOK {
+		t.Errorf("integrity = %q, want %q", integrity, integrityOK)
+	}
+}
+
+func TestSignedFinalBatchVerifies(t *testing.T) {
+	sessionRepo := &fakeSessionRepo{sessions: map[uint]*models.TelemetrySession{
+		7: {ID: 7, ActivityID: 1, StudentID: 2, SessionKey: "secret"},
+	}}
+	submissionRepo := &fakeSubmissionRepo{}
+	service := newTestTelemetryService(sessionRepo, &fakePipeline{})
+	service.userRepo = fakeUserRepo{}
+	service.activityRepo = &fakeActivityRepo{}
+	service.telemetryRepo = &fakeTelemetryRepo{}
+	service.submissionRepo = submissionRepo
+
+	batch := TelemetryBatch{
+		ActivityID: 1,
+		StudentID:  2,
+		SessionID:  7,
+		Sequence:   1,
+		Timestamp:  time.Now().UnixMilli(),
+		IsFinal:    true,
+		Code:       "def total(values):\n    return sum(values)",
+		Features:   decodeJSON(t, `{"totalKeystrokes": 40, "pasteEvents": 1}`),
+		RawEvents: decodeJSON(t, `{
+			"pasteEvents": [{"timestamp": 5, "length": 23, "content": "return sum(values) + 0", "linesCount": 1}]
+		}`),
+	}
+	batch.Signature = signBatch("secret", batch)
+
+	result, err := service.ProcessTelemetry(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Receipt == nil {
+		t.Fatal("final batch produced no receipt")
+	}
+
+	submission := submissionRepo.submissions[0]
+	for _, signal := range submission.IntegrityArray {
+		if signal == SignalInvalidSignature {
+			t.Fatalf("honest final flagged %s", signal)
+		}
+	}
+	if _, derived := batch.Features["codeLength"]; derived {
+		t.Error("derived features were written into the signed batch")
+	}
+	if !result.AnalysisPending || !submission.AnalysisPending {
+		t.Error("final was analyzed on the request")
+	}
+}
+
+func TestFinalIsAnalyzedByWorker(t *testing.T) {
+	submissionRepo := &fakeSubmissionRepo{submissions: []models.Submission{{
+		ID:              1,
+		ActivityID:      1,
+		StudentID:       2,
+		SessionID:       7,
+		Code:            "def total(values):\n    return sum(values)",
+		AnalysisPending: true,
+	}}}
+	service := newTestTelemetryService(&fakeSessionRepo{}, &fakePipeline{})
+	service.activityRepo = &fakeActivityRepo{}
+	service.submissionRepo = submissionRepo
+	service.telemetryRepo = &fakeTelemetryRepo{stored: []models.TelemetryData{{
+		ActivityID: 1,
+		StudentID:  2,
+		SessionID:  7,
+		Sequence:   1,
+		IsFinal:    true,
+		Features:   `{"totalKeystrokes": 40, "pasteEvents": 1}`,
+		RawEvents:  `{"pasteEvents": [{"timestamp": 5, "length": 23, "content": "return sum(values) + 0", "linesCount": 1}]}`,
+		Integrity:  integrityOK,
+	}}}
+
+	if err := service.analyzeFinal(1); err != nil {
+		t.Fatal(err)
+	}
+
+	submission := submissionRepo.submissions[0]
+	if submission.AnalysisPending {
+		t.Fatal("submission still pending after its analysis")
+	}
+	if submission.AuthorshipScore != 1 {
+		t.Errorf("authorship score = %v, want the analysis result", submission.AuthorshipScore)
+	}
+	if submission.PasteProvenance == "" || submission.PasteProvenance == "null" {
+		t.Error("pastes of the final were not attributed")
+	}
+
+	// A second delivery of the same submission changes nothing
+	if err := service.analyzeFinal(1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatchLaterPeer(t *testing.T) {
+	earlier := &models.Submission{
+		ID:                1,
+		PasteEventDetails: `[{"timestamp": 1, "length": 30, "content": "for item in values: total += item"}, {"timestamp": 2, "length": 3, "content": "abc"}]`,
+		PasteProvenance:   `[{"timestamp": 1, "length": 30, "source": "external"}, {"timestamp": 2, "length": 3, "source": "trivial"}]`,
+	}
+	later := &models.Submission{
+		ID:        2,
+		StudentID: 9,
+		Code:      "total = 0\nfor item in values:\n    total += item\n",
+	}
+
+	provenance, matched := matchLaterPeer(earlier, later)
+	if !matched {
+		t.Fatal("paste of the later submission's code was not matched")
+	}
+	if provenance[0].Source != PasteSourcePeer || provenance[0].MatchedSubmissionID != 2 || provenance[0].MatchedStudentID != 9 {
+		t.Errorf("provenance = %+v, want a peer match on submission 2", provenance[0])
+	}
+	if provenance[1].Source != PasteSourceTrivial {
+		t.Errorf("trivial paste became %q", provenance[1].Source)
+	}
+
+	if _, matched := matchLaterPeer(earlier, &models.Submission{ID: 3, Code: "print('unrelated')"}); matched {
+		t.Error("unrelated code matched")
+	}
+}
+
+func TestSessionLocksAreReleased(t *testing.T) {
+	service := newTestTelemetryService(&fakeSessionRepo{}, &fakePipeline{})
+
+	unlock := service.lockSession(7)
+	done := make(chan struct{})
+	go func() {
+		service.lockSession(7)()
+		close(done)
+	}()
+	unlock()
+	<-done
+
+	if len(service.sessionLocks) != 0 {
+		t.Errorf("%d session locks left after all batches finished", len(service.sessionLocks))
+	}
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+)
+
+// TimelineDetectorName names the session timeline detector
+const TimelineDetectorName = "timeline"
+
+const (
+	// A pause this long ends an activity phase (ms)
+	phaseGap = 10000.0
+	// Sessions with fewer typing keys than this are not segmented
+	minTimelineKeys = 20
+	// Phases with fewer typing keys than this are too short to be bursts
+	minBurstKeys = 40
+	// A burst types this much faster than the student's other phases
+	burstRateFactor = 1.5
+	// Without other phases to compare with, bursts exceed this rate (keys/min)
+	fastTypingRate = 250.0
+	// Bursts correct at most this share of their keys
+	maxBurstCorrections = 0.03
+	// Bursts insert at least this share of their text after the previous insertion
+	minBurstLinearity = 0.9
+	// Bursts produce at least this share of the final code
+	minBurstCodeShare = 0.5
+)
+
+// TimelinePhase is a stretch of continuous typing in a session
+type TimelinePhase struct {
+	Start       float64 // ms
+	End         float64 // ms
+	Keys        int     // Typing keys, corrections included
+	Corrections int     // Backspace and Delete
+	IdleBefore  float64 // Pause before the phase, in seconds
+	Linearity   float64 // Share of insertions after the previous one, -1 without edits
+	Inserted    int     // Non-whitespace characters inserted, from edits or else typing keys
+}
+
+// KeysPerMinute is the typing rate of the phase
+func (p TimelinePhase) KeysPerMinute() float64 {
+	minutes := (p.End - p.Start) / 60000
+	if minutes <= 0 {
+		return 0
+	}
+	return float64(p.Keys) / minutes
+}
+
+func (p TimelinePhase) CorrectionRatio() float64 {
+	if p.Keys == 0 {
+		return 0
+	}
+	return float64(p.Corrections) / float64(p.Keys)
+}
+
+// isTypingKey leaves out modifiers and navigation keys, which type nothing
+func isTypingKey(code string) bool {
+	for _, prefix := range []string{"Shift", "Control", "Alt", "Meta", "CapsLock", "Arrow", "Home", "End", "Page", "Escape", "Tab"} {
+		if strings.HasPrefix(code, prefix) {
+			return code == "Tab"
+		}
+	}
+	return true
+}
+
+func isCorrectionKey(code string) bool {
+	return code == "Backspace" || code == "Delete"
+}
+
+func isWhitespaceKey(code string) bool {
+	return code == "Space" || code == "Enter" || code == "NumpadEnter" || code == "Tab"
+}
+
+// segmentTimeline splits the key presses of a session into phases of
+// continuous typing separated by pauses. The first phase is idle from the
+// session start, when known.
+func segmentTimeline(session *SessionEvents) []TimelinePhase {
+	phases := []TimelinePhase{}
+	var current *TimelinePhase
+	lastKey := session.Start
+
+	for _, key := range session.KeyDowns {
+		if !isTypingKey(key.Key) {
+			continue
+		}
+		if current == nil || key.Timestamp-lastKey >= phaseGap {
+			idle := 0.0
+			if lastKey > 0 && key.Timestamp > lastKey {
+				idle = (key.Timestamp - lastKey) / 1000
+			}
+			phases = append(phases, TimelinePhase{Start: key.Timestamp, IdleBefore: idle})
+			current = &phases[len(phases)-1]
+		}
+		current.End = key.Timestamp
+		current.Keys++
+		switch {
+		case isCorrectionKey(key.Key):
+			current.Corrections++
+		case !isWhitespaceKey(key.Key):
+			current.Inserted++
+		}
+		lastKey = key.Timestamp
+	}
+
+	for i := range phases {
+		phases[i].Linearity = editLinearity(session.Edits, phases[i].Start, phases[i].End)
+		if inserted, ok := insertedChars(session.Edits, phases[i].Start, phases[i].End); ok {
+			phases[i].Inserted = inserted
+		}
+	}
+	return phases
+}
+
+// insertedChars counts the non-whitespace characters inserted by the edits
+// within [start, end]. ok is false when the phase has no insertions.
+func insertedChars(edits []models.EditEvent, start, end float64) (inserted int, ok bool) {
+	for _, edit := range edits {
+		timestamp := float64(edit.Timestamp)
+		if timestamp < start-keystrokeEditWindow || timestamp > end+keystrokeEditWindow || edit.Text == "" {
+			continue
+		}
+		inserted += visibleChars(edit.Text)
+		ok = true
+	}
+	return inserted, ok
+}
+
+func visibleChars(text string) int {
+	count := 0
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// editLinearity is the share of insertions within [start, end] placed at or
+// after the end of the previous insertion, as when copying code top to
+// bottom. It is -1 when the phase has no insertions.
+func editLinearity(edits []models.EditEvent, start, end float64) float64 {
+	inserts, linear := 0, 0
+	previousEnd := -1
+	for _, edit := range edits {
+		timestamp := float64(edit.Timestamp)
+		if timestamp < start-keystrokeEditWindow || timestamp > end+keystrokeEditWindow || edit.Text == "" {
+			continue
+		}
+		if previousEnd >= 0 {
+			inserts++
+			if edit.RangeOffset >= previousEnd {
+				linear++
+			}
+		}
+		previousEnd = edit.RangeOffset + len([]rune(edit.Text))
+	}
+	if inserts == 0 {
+		return -1
+	}
+	return float64(linear) / float64(inserts)
+}
+
+// referenceRate is the median typing rate of the phases other than skip
+// that are long enough to measure, or 0 when there are none
+func referenceRate(phases []TimelinePhase, skip int) float64 {
+	rates := []float64{}
+	for i, phase := range phases {
+		if i != skip && phase.Keys >= minBurstKeys {
+			rates = append(rates, phase.KeysPerMinute())
+		}
+	}
+	if len(rates) == 0 {
+		return 0
+	}
+	sort.Float64s(rates)
+	return rates[len(rates)/2]
+}
+
+// isBurst tells whether a phase is fast, barely corrected, linear typing
+// after a pause of at least idleSeconds, producing most of the final code
+// (codeChars non-whitespace characters; not checked when 0)
+func isBurst(phases []TimelinePhase, i int, idleSeconds float64, codeChars int) bool {
+	phase := phases[i]
+	if phase.IdleBefore < idleSeconds || phase.Keys < minBurstKeys {
+		return false
+	}
+	if codeChars > 0 && float64(phase.Inserted) < minBurstCodeShare*float64(codeChars) {
+		return false
+	}
+	if phase.CorrectionRatio() > maxBurstCorrections {
+		return false
+	}
+	if phase.Linearity >= 0 && phase.Linearity < minBurstLinearity {
+		return false
+	}
+
+	rate := phase.KeysPerMinute()
+	if reference := referenceRate(phases, i); reference > 0 {
+		return rate >= burstRateFactor*reference
+	}
+	return rate >= fastTypingRate
+}
+
+// timelineDetector segments the session into typing phases and flags bursts
+// of fast, uncorrected, linear typing right after long idle periods, the
+// pattern of copying code from a second device
+type timelineDetector struct{}
+
+func NewTimelineDetector() Detector {
+	return timelineDetector{}
+}
+
+func (timelineDetector) Name() string     { return TimelineDetectorName }
+func (timelineDetector) Version() string  { return "1" }
+func (timelineDetector) Inputs() []string { return []string{"keyEvents", "editEvents"} }
+
+func (d timelineDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	if input.Session == nil {
+		result.Skipped = true
+		return result
+	}
+	phases := segmentTimeline(input.Session)
+	totalKeys := 0
+	for _, phase := range phases {
+		totalKeys += phase.Keys
+	}
+	if totalKeys < minTimelineKeys {
+		result.Skipped = true
+		return result
+	}
+
+	set := input.Rules
+	idleSeconds := set.Get(rules.IdleThenBurst).Threshold
+	codeChars := visibleChars(input.Code)
+
+	segments := []models.EventPointer{}
+	burstKeys := 0
+	longestIdle := 0.0
+	for i, phase := range phases {
+		longestIdle = math.Max(longestIdle, phase.IdleBefore)
+		if !isBurst(phases, i, idleSeconds, codeChars) {
+			continue
+		}
+
+		segments = append(segments, models.EventPointer{
+			Kind:  "keyEvents",
+			Start: int64(phase.Start),
+			End:   int64(phase.End),
+		})
+		burstKeys += phase.Keys
+
+		prefix := fmt.Sprintf("segment%d.", len(segments))
+		result.Evidence[prefix+"idleSeconds"] = phase.IdleBefore
+		result.Evidence[prefix+"keysPerMinute"] = phase.KeysPerMinute()
+		result.Evidence[prefix+"correctionRatio"] = phase.CorrectionRatio()
+		if codeChars > 0 {
+			result.Evidence[prefix+"codeShare"] = float64(phase.Inserted) / float64(codeChars)
+		}
+		if phase.Linearity >= 0 {
+			result.Evidence[prefix+"linearity"] = phase.Linearity
+		}
+	}
+
+	result.Evidence["phases"] = float64(len(phases))
+	result.Evidence["longestIdleSeconds"] = longestIdle
+	result.Evidence["bursts"] = float64(len(segments))
+	result.Evidence["burstShare"] = float64(burstKeys) / float64(totalKeys)
+
+	if len(segments) > 0 {
+		fireRule(&result, set, rules.IdleThenBurst, float64(len(segments)), segments)
+	}
+
+	return result
+}
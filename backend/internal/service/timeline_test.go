@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+)
+
+// burstSession opens the editor at 1000 and, after 90 idle seconds, types
+// keys letters at 10 keys per second
+func burstSession(keys int) *SessionEvents {
+	session := &SessionEvents{Start: 1000}
+	for i := 0; i < keys; i++ {
+		session.KeyDowns = append(session.KeyDowns, models.KeyEvent{
+			Timestamp: 91000 + float64(i)*100,
+			Type:      "keydown",
+			Key:       "KeyA",
+		})
+	}
+	return session
+}
+
+func TestFirstPhaseIsIdleFromSessionStart(t *testing.T) {
+	phases := segmentTimeline(burstSession(60))
+	if len(phases) != 1 {
+		t.Fatalf("%d phases, want 1", len(phases))
+	}
+	if phases[0].IdleBefore != 90 {
+		t.Errorf("idle before first phase = %v, want 90", phases[0].IdleBefore)
+	}
+
+	unknown := burstSession(60)
+	unknown.Start = 0
+	if idle := segmentTimeline(unknown)[0].IdleBefore; idle != 0 {
+		t.Errorf("idle without session start = %v, want 0", idle)
+	}
+}
+
+func TestBurstMustProduceMostOfTheCode(t *testing.T) {
+	detect := func(code string) models.DetectorResult {
+		return NewTimelineDetector().Detect(AnalysisInput{
+			IsFinal: true,
+			Code:    code,
+			Session: burstSession(60),
+			Rules:   rules.Defaults(),
+		})
+	}
+
+	if result := detect(strings.Repeat("a", 60)); len(result.Signals) != 1 {
+		t.Errorf("burst typing the whole code: signals = %v", result.Signals)
+	}
+	if result := detect(strings.Repeat("a", 500)); len(result.Signals) != 0 {
+		t.Errorf("burst typing an eighth of the code: signals = %v", result.Signals)
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"strings"
+	"unicode"
+
+	"dalivim/internal/models"
+	"dalivim/internal/rules"
+)
+
+// TypingConsistencyDetectorName names the detector reconciling the final
+// code with the edits that produced it
+const TypingConsistencyDetectorName = "typing_consistency"
+
+const (
+	// An edit is attributed to a key press this close before it (ms)
+	keystrokeEditWindow = 150.0
+	// An edit is attributed to a paste, undo/redo or replace this close (ms)
+	eventEditWindow = 250
+	// Non-space characters a single key press may insert, for auto-closed
+	// brackets and quotes
+	maxTypedInsertion = 2
+	// Fewer untyped characters than this are left unflagged
+	minUntypedChars = 20
+)
+
+// Where the characters of the document came from
+const (
+	originStarter byte = iota
+	originTyped
+	originPasted
+	originRestored // Undo/redo and find/replace bring back earlier text
+	originUntyped
+)
+
+// CodeReconciliation accounts for the characters of the final code by
+// replaying the edits of the session
+type CodeReconciliation struct {
+	FinalChars    int
+	TypedChars    int
+	PastedChars   int
+	RestoredChars int // Starter code, undo/redo and find/replace
+	UntypedChars  int // Produced by no key press, paste or editor command
+	Diverged      bool
+	UntypedEdits  []models.EventPointer
+}
+
+// UntypedRatio is the share of the final code nobody typed or pasted
+func (r *CodeReconciliation) UntypedRatio() float64 {
+	if r.FinalChars == 0 {
+		return 0
+	}
+	return float64(r.UntypedChars) / float64(r.FinalChars)
+}
+
+// sessionReconciliation reconciles the code of a final batch with the edits
+// of the whole session
+func (s *telemetryService) sessionReconciliation(batch TelemetryBatch, session *SessionEvents) *CodeReconciliation {
+	var starter string
+	if activity, err := s.activityRepo.FindByID(batch.ActivityID); err == nil {
+		starter = activity.StarterCode
+	}
+
+	return reconcileCode(batch.Code, starter, session)
+}
+
+// reconcileCode replays the edits over the starter code, attributing every
+// inserted character to a key press, a paste, an editor command or nothing,
+// then compares the replayed document with the final code. Final code the
+// replay does not produce counts as untyped. It returns nil when the client
+// sent no edit or key events.
+func reconcileCode(code, starter string, session *SessionEvents) *CodeReconciliation {
+	if session == nil || len(session.Edits) == 0 || len(session.KeyDowns) == 0 {
+		return nil
+	}
+	edits := session.Edits
+	keyDowns := make([]float64, len(session.KeyDowns))
+	for i, key := range session.KeyDowns {
+		keyDowns[i] = key.Timestamp
+	}
+
+	result := &CodeReconciliation{UntypedEdits: []models.EventPointer{}}
+
+	text := []rune(starter)
+	origins := make([]byte, len(text))
+	usedPastes := make([]bool, len(session.Pastes))
+	nextKey := 0
+
+	for _, edit := range edits {
+		inserted := []rune(edit.Text)
+		offset := clampInt(edit.RangeOffset, 0, len(text))
+		end := clampInt(edit.RangeOffset+edit.RangeLength, offset, len(text))
+
+		// Key presses are used once, in order
+		for nextKey < len(keyDowns) && keyDowns[nextKey] < float64(edit.Timestamp)-keystrokeEditWindow {
+			nextKey++
+		}
+		keyed := nextKey < len(keyDowns) && keyDowns[nextKey] <= float64(edit.Timestamp)+keystrokeEditWindow
+
+		insertedOrigins := make([]byte, len(inserted))
+		origin := originUntyped
+		switch {
+		case len(inserted) == 0:
+		case matchPaste(edit, session.Pastes, usedPastes):
+			origin = originPasted
+		case nearEvent(edit.Timestamp, session.History):
+			origin = originRestored
+		case isStarterText(edit.Text, starter):
+			origin = originRestored
+		case keyed && (isTypedInsertion(inserted) || isKnownWord(edit.Text, text)):
+			origin = originTyped
+		}
+		if keyed {
+			nextKey++
+		}
+		for i := range insertedOrigins {
+			insertedOrigins[i] = origin
+		}
+		if origin == originUntyped && strings.TrimSpace(edit.Text) != "" {
+			result.UntypedEdits = append(result.UntypedEdits, models.EventPointer{Kind: "editEvents", Start: edit.Timestamp})
+		}
+
+		text = append(text[:offset:offset], append(inserted, text[end:]...)...)
+		origins = append(origins[:offset:offset], append(insertedOrigins, origins[end:]...)...)
+	}
+
+	// Align the replayed document with the final code on their common
+	// prefix and suffix; whatever of the final code lies between was never
+	// produced by an edit
+	final := []rune(code)
+	prefix := 0
+	for prefix < len(final) && prefix < len(text) && final[prefix] == text[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(final)-prefix && suffix < len(text)-prefix &&
+		final[len(final)-1-suffix] == text[len(text)-1-suffix] {
+		suffix++
+	}
+	result.Diverged = prefix+suffix < len(final) || len(text) != len(final)
+
+	finalOrigins := make([]byte, 0, len(final))
+	finalOrigins = append(finalOrigins, origins[:prefix]...)
+	for i := prefix; i < len(final)-suffix; i++ {
+		finalOrigins = append(finalOrigins, originUntyped)
+	}
+	finalOrigins = append(finalOrigins, origins[len(text)-suffix:]...)
+
+	for i, origin := range finalOrigins {
+		if unicode.IsSpace(final[i]) {
+			continue // Indentation is inserted by the editor
+		}
+		result.FinalChars++
+		switch origin {
+		case originTyped:
+			result.TypedChars++
+		case originPasted:
+			result.PastedChars++
+		case originStarter, originRestored:
+			result.RestoredChars++
+		default:
+			result.UntypedChars++
+		}
+	}
+
+	return result
+}
+
+// matchPaste finds an unused paste at the time of the edit with the same
+// text. Pastes only keep their first characters.
+func matchPaste(edit models.EditEvent, pastes []models.PasteEvent, used []bool) bool {
+	for i, paste := range pastes {
+		if used[i] || absInt64(paste.Timestamp-edit.Timestamp) > eventEditWindow {
+			continue
+		}
+		if paste.Length == len([]rune(edit.Text)) || (paste.Content != "" && strings.HasPrefix(edit.Text, paste.Content)) {
+			used[i] = true
+			return true
+		}
+	}
+	return false
+}
+
+func nearEvent(timestamp int64, events []int64) bool {
+	for _, event := range events {
+		if absInt64(event-timestamp) <= eventEditWindow {
+			return true
+		}
+	}
+	return false
+}
+
+// isStarterText tells whether a multi-character insertion comes from the
+// starter code, as when the editor loads it
+func isStarterText(text, starter string) bool {
+	trimmed := strings.TrimSpace(text)
+	return len(trimmed) > maxTypedInsertion && strings.Contains(starter, trimmed)
+}
+
+// isTypedInsertion tells whether one key press can insert the text: a
+// character plus auto-closed pairs and auto-indentation
+func isTypedInsertion(inserted []rune) bool {
+	visible := 0
+	for _, r := range inserted {
+		if !unicode.IsSpace(r) {
+			visible++
+		}
+	}
+	return visible <= maxTypedInsertion
+}
+
+// isKnownWord tells whether the text is a word already in the document, as
+// inserted by the editor's word suggestions
+func isKnownWord(text string, document []rune) bool {
+	word := strings.TrimSpace(text)
+	if word == "" || strings.IndexFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) >= 0 {
+		return false
+	}
+	return strings.Contains(string(document), word)
+}
+
+func clampInt(value, low, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+func absInt64(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// typingConsistencyDetector flags final code that no recorded key press or
+// paste produced, such as text injected through developer tools or an
+// autocomplete extension
+type typingConsistencyDetector struct{}
+
+func NewTypingConsistencyDetector() Detector {
+	return typingConsistencyDetector{}
+}
+
+func (typingConsistencyDetector) Name() string    { return TypingConsistencyDetectorName }
+func (typingConsistencyDetector) Version() string { return "1" }
+func (typingConsistencyDetector) Inputs() []string {
+	return []string{"editEvents", "keyEvents", "pasteEvents", "undoRedoEvents", "findReplaceEvents"}
+}
+
+func (d typingConsistencyDetector) Detect(input AnalysisInput) models.DetectorResult {
+	result := newDetectorResult(d)
+
+	reconciliation := input.Reconciliation
+	if reconciliation == nil || reconciliation.FinalChars == 0 {
+		result.Skipped = true
+		return result
+	}
+
+	ratio := reconciliation.UntypedRatio()
+	result.Evidence["finalChars"] = float64(reconciliation.FinalChars)
+	result.Evidence["typedChars"] = float64(reconciliation.TypedChars)
+	result.Evidence["pastedChars"] = float64(reconciliation.PastedChars)
+	result.Evidence["restoredChars"] = float64(reconciliation.RestoredChars)
+	result.Evidence["untypedChars"] = float64(reconciliation.UntypedChars)
+	result.Evidence["untypedRatio"] = ratio
+	if reconciliation.Diverged {
+		result.Evidence["diverged"] = 1
+	}
+
+	set := input.Rules
+	if reconciliation.UntypedChars >= minUntypedChars && ratio > set.Get(rules.UntypedCode).Threshold {
+		fireRule(&result, set, rules.UntypedCode, ratio, reconciliation.UntypedEdits)
+	}
+
+	return result
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"testing"
+
+	"dalivim/internal/models"
+)
+
+// typedSession types the text one character per key press, 100 ms apart
+func typedSession(text string) *SessionEvents {
+	session := &SessionEvents{}
+	for i, r := range text {
+		timestamp := int64(1000 + i*100)
+		session.KeyDowns = append(session.KeyDowns, models.KeyEvent{Timestamp: float64(timestamp), Type: "keydown", Key: "Key"})
+		session.Edits = append(session.Edits, models.EditEvent{Timestamp: timestamp, RangeOffset: i, Text: string(r)})
+	}
+	return session
+}
+
+func TestReconcileTypedCode(t *testing.T) {
+	result := reconcileCode("x = 1", "", typedSession("x = 1"))
+	if result == nil {
+		t.Fatal("typed session not reconciled")
+	}
+	if result.FinalChars != 3 || result.TypedChars != 3 || result.UntypedChars != 0 || result.Diverged {
+		t.Errorf("reconciliation = %+v, want 3 typed characters", result)
+	}
+}
+
+func TestReconcilePastedAndInjectedCode(t *testing.T) {
+	session := typedSession("a")
+	session.Edits = append(session.Edits,
+		models.EditEvent{Timestamp: 5000, RangeOffset: 1, Text: "bcd"},
+		models.EditEvent{Timestamp: 9000, RangeOffset: 4, Text: "efgh"},
+	)
+	session.Pastes = []models.PasteEvent{{Timestamp: 5010, Length: 3, Content: "bcd"}}
+
+	result := reconcileCode("abcdefgh", "", session)
+	if result.TypedChars != 1 || result.PastedChars != 3 || result.UntypedChars != 4 {
+		t.Errorf("reconciliation = %+v, want 1 typed, 3 pasted and 4 untyped", result)
+	}
+	if len(result.UntypedEdits) != 1 || result.UntypedEdits[0].Start != 9000 {
+		t.Errorf("untyped edits = %+v, want the edit at 9000", result.UntypedEdits)
+	}
+}
+
+func TestReconcileCodeMissingFromTheEdits(t *testing.T) {
+	result := reconcileCode("def f():\n    return 1", "def f():\n", typedSession(""))
+	if result != nil {
+		t.Fatal("session without edits reconciled")
+	}
+
+	session := typedSession("ab")
+	result = reconcileCode("abXYZ", "", session)
+	if !result.Diverged || result.UntypedChars != 3 {
+		t.Errorf("reconciliation = %+v, want 3 untyped characters on diverged code", result)
+	}
+}
+
+func TestReconcileKeepsStarterCode(t *testing.T) {
+	starter := "def total(values):\n"
+	session := typedSession("")
+	session.KeyDowns = []models.KeyEvent{{Timestamp: 1000, Type: "keydown", Key: "KeyR"}}
+	session.Edits = []models.EditEvent{{Timestamp: 1000, RangeOffset: len(starter), Text: "r"}}
+
+	result := reconcileCode(starter+"r", starter, session)
+	if result.RestoredChars != 17 || result.TypedChars != 1 || result.UntypedChars != 0 {
+		t.Errorf("reconciliation = %+v, want the starter restored and 1 typed", result)
+	}
+}
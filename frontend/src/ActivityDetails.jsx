@@ -35,7 +35,8 @@ const ActivityDetails = () => {
     }
   };
 
-  const getSuspicionLevel = (score) => {
+  const getSuspicionLevel = (score, pending) => {
+    if (pending) return { level: 'Em análise', color: '#9ca3af', emoji: '⏳' };
     if (score > 0.8) return { level: 'Muito Baixa', color: '#10b981', emoji: '✅' };
     if (score > 0.6) return { level: 'Baixa', color: '#3b82f6', emoji: '✓' };
     if (score > 0.4) return { level: 'Média', color: '#f59e0b', emoji: '⚠️' };
@@ -146,7 +147,7 @@ const ActivityDetails = () => {
             gap: '16px'
           }}>
             {submissions.map(submission => {
-              const suspicion = getSuspicionLevel(submission.authorshipScore);
+              const suspicion = getSuspicionLevel(submission.authorshipScore, submission.analysisPending);
               return (
                 <div
                   key={submission.id}
@@ -212,7 +213,7 @@ const ActivityDetails = () => {
                       fontWeight: '700',
                       color: suspicion.color
                     }}>
-                      {(submission.authorshipScore * 100).toFixed(0)}%
+                      {submission.analysisPending ? '…' : `${(submission.authorshipScore * 100).toFixed(0)}%`}
                     </span>
                   </div>
 
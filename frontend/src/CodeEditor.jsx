@@ -1,8 +1,11 @@
 import React, { useEffect, useRef, useState } from 'react';
 import Editor from '@monaco-editor/react';
+import { signBatch } from './telemetrySigning';
 
-const CodeEditor = ({ activityId, studentId, onTelemetryUpdate }) => {
+const CodeEditor = ({ activityId, studentId, sessionId, sessionKey, onTelemetryUpdate }) => {
   const editorRef = useRef(null);
+  // Last link of the session's hash chain, once the pending batch is signed
+  const chainRef = useRef(Promise.resolve({ sequence: 0, prevHash: '' }));
   const telemetryRef = useRef({
     keystrokes: [],
     pasteEvents: [],
@@ -202,6 +205,17 @@ const CodeEditor = ({ activityId, studentId, onTelemetryUpdate }) => {
     };
   };
 
+  // Batches are signed one after the other, as each links to the signature
+  // of the previous one
+  const signPayload = (payload) => {
+    chainRef.current = chainRef.current.then(async ({ sequence, prevHash }) => {
+      Object.assign(payload, { sessionId, sequence: sequence + 1, prevHash });
+      payload.signature = await signBatch(sessionKey, payload);
+      return { sequence: payload.sequence, prevHash: payload.signature };
+    });
+    return chainRef.current;
+  };
+
   const sendTelemetry = async (isFinal = false) => {
     const features = calculateTelemetryFeatures();
     
@@ -220,10 +234,18 @@ const CodeEditor = ({ activityId, studentId, onTelemetryUpdate }) => {
     };
 
     try {
+      // WebCrypto is only available on secure origins; unsigned batches are
+      // still accepted and flagged
+      if (sessionKey && window.crypto?.subtle) {
+        await signPayload(payload);
+      }
+
+      // sentAt is the upload time on the same clock as timestamp, so the
+      // server can tell a delayed batch from a skewed clock
       const response = await fetch('/api/telemetry', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(payload)
+        body: JSON.stringify({ ...payload, sentAt: Date.now() })
       });
       
       const result = await response.json();
@@ -7,6 +7,7 @@ const StudentActivity = () => {
   const navigate = useNavigate();
   const [activity, setActivity] = useState(null);
   const [student, setStudent] = useState(null);
+  const [session, setSession] = useState(null);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
   const [telemetryStatus, setTelemetryStatus] = useState(null);
@@ -29,6 +30,7 @@ const StudentActivity = () => {
       const data = await response.json();
       setActivity(data.activity);
       setStudent(data.student);
+      setSession({ id: data.sessionId, key: data.sessionKey });
       setLoading(false);
     } catch (err) {
       setError(err.message);
@@ -143,6 +145,8 @@ const StudentActivity = () => {
       <CodeEditor
         activityId={activity.id}
         studentId={student.id}
+        sessionId={session?.id}
+        sessionKey={session?.key}
         onTelemetryUpdate={handleTelemetryUpdate}
       />
     </div>
@@ -0,0 +1,51 @@
+// Signs telemetry batches with the session key returned when joining an
+// activity. The server recomputes the signature from the batch it decodes,
+// so the payload is serialized canonically: JSON.stringify with object keys
+// sorted. See "Signed telemetry" in docs/API_TESTING.md.
+
+const encoder = new TextEncoder();
+
+const toHex = (buffer) =>
+  Array.from(new Uint8Array(buffer), (byte) => byte.toString(16).padStart(2, '0')).join('');
+
+// Objects are written key by key: an object rebuilt with sorted keys would
+// still list integer-like keys first
+export const canonicalJSON = (value) => {
+  if (Array.isArray(value)) {
+    return `[${value.map((item) => canonicalJSON(item === undefined ? null : item)).join(',')}]`;
+  }
+  if (value !== null && typeof value === 'object') {
+    const entries = Object.keys(value)
+      .filter((key) => value[key] !== undefined)
+      .sort()
+      .map((key) => `${JSON.stringify(key)}:${canonicalJSON(value[key])}`);
+    return `{${entries.join(',')}}`;
+  }
+  return JSON.stringify(value === undefined ? null : value);
+};
+
+export const sha256Hex = async (text) =>
+  toHex(await crypto.subtle.digest('SHA-256', encoder.encode(text)));
+
+// signBatch returns the hex HMAC-SHA256 of
+// "sequence|prevHash|timestamp|isFinal|sha256(code)|sha256(payload)"
+export const signBatch = async (sessionKey, batch) => {
+  const payload = canonicalJSON({ features: batch.features, rawEvents: batch.rawEvents });
+  const message = [
+    batch.sequence,
+    batch.prevHash || '',
+    batch.timestamp,
+    Boolean(batch.isFinal),
+    await sha256Hex(batch.code || ''),
+    await sha256Hex(payload),
+  ].join('|');
+
+  const key = await crypto.subtle.importKey(
+    'raw',
+    encoder.encode(sessionKey),
+    { name: 'HMAC', hash: 'SHA-256' },
+    false,
+    ['sign']
+  );
+  return toHex(await crypto.subtle.sign('HMAC', key, encoder.encode(message)));
+};
@@ -1,86 +1,388 @@
 -- Database Schema for Dalivim Platform
 -- PostgreSQL
+--
+-- The server creates and migrates these tables itself (GORM AutoMigrate, see
+-- backend/internal/database). This file mirrors the models for reference and
+-- manual setups; JSON documents are stored as TEXT, as the models do.
+
+-- Semesters (telemetry retention is set per semester)
+CREATE TABLE semesters (
+    id BIGSERIAL PRIMARY KEY,
+    year BIGINT NOT NULL,
+    period BIGINT NOT NULL CHECK (period IN (1, 2)),
+    start_date TIMESTAMPTZ NOT NULL,
+    end_date TIMESTAMPTZ NOT NULL,
+
+    -- Retention in days, 0 keeps data forever
+    raw_retention_days BIGINT NOT NULL DEFAULT 365,
+    feature_retention_days BIGINT NOT NULL DEFAULT 0,
+
+    created_by BIGINT, -- Professor who may change the semester
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
 
 -- Users table (Professors and Students)
 CREATE TABLE users (
-    id SERIAL PRIMARY KEY,
-    email VARCHAR(255) UNIQUE NOT NULL,
-    password VARCHAR(255) NOT NULL,
-    name VARCHAR(255),
-    role VARCHAR(50) NOT NULL CHECK (role IN ('professor', 'student')),
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL,
+    name TEXT,
+    role TEXT NOT NULL CHECK (role IN ('professor', 'student')),
+    student_token_hash TEXT UNIQUE, -- Lets an anonymous student join again
+    current_semester BIGINT,
+    enrollment_year BIGINT,
+    enrollment_period BIGINT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
 );
 
 -- Activities table (Created by professors)
 CREATE TABLE activities (
-    id SERIAL PRIMARY KEY,
-    professor_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    title VARCHAR(255) NOT NULL,
+    id BIGSERIAL PRIMARY KEY,
+    professor_id BIGINT NOT NULL,
+    semester_id BIGINT NOT NULL REFERENCES semesters(id),
+    target_semester BIGINT NOT NULL,
+    title TEXT NOT NULL,
     description TEXT,
-    language VARCHAR(50) NOT NULL,
-    time_limit INTEGER NOT NULL, -- in minutes
-    invite_token VARCHAR(255) UNIQUE NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    starter_code TEXT,
+    language TEXT NOT NULL,
+    time_limit BIGINT NOT NULL, -- in minutes
+    late_policy TEXT NOT NULL DEFAULT 'flag', -- accept, flag or reject
+    invite_token TEXT UNIQUE NOT NULL,
+    closed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
 );
 
 -- Submissions table (Final student submissions with analysis)
 CREATE TABLE submissions (
-    id SERIAL PRIMARY KEY,
-    activity_id INTEGER REFERENCES activities(id) ON DELETE CASCADE,
-    student_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    student_name VARCHAR(255),
-    student_email VARCHAR(255),
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    student_id BIGINT NOT NULL,
+    student_name TEXT,
+    student_email TEXT,
     code TEXT,
-    
+
     -- Authorship analysis
-    authorship_score DECIMAL(5,4) DEFAULT 0,
-    confidence VARCHAR(50),
-    signals TEXT[], -- Array of signal strings
-    
+    authorship_score DECIMAL,
+    confidence TEXT, -- high, medium, low or insufficient_data
+    confidence_score DECIMAL,
+    signals TEXT, -- JSON array of signal names
+    detector_results TEXT, -- JSON array of detector results
+    baseline_deviation DECIMAL,
+    cohort_percentile DECIMAL,
+    cohort_analyzed_at TIMESTAMPTZ,
+    identity_consistency DECIMAL,
+    label TEXT, -- Latest professor label
+    analysis_version TEXT,
+    analysis_pending BOOLEAN NOT NULL DEFAULT FALSE, -- Saved, analysis queued
+
     -- Behavioral metrics
-    avg_keystroke_interval DECIMAL(10,2),
-    std_keystroke_interval DECIMAL(10,2),
-    paste_events INTEGER DEFAULT 0,
-    paste_char_ratio DECIMAL(5,4),
-    delete_ratio DECIMAL(5,4),
-    focus_loss_count INTEGER DEFAULT 0,
-    linear_editing_score DECIMAL(5,4),
-    burstiness DECIMAL(10,2),
-    time_to_first_run DECIMAL(10,2),
-    execution_count INTEGER DEFAULT 0,
-    total_time DECIMAL(10,2),
-    keystroke_count INTEGER DEFAULT 0,
-    
+    avg_keystroke_interval DECIMAL,
+    std_keystroke_interval DECIMAL,
+    paste_events BIGINT,
+    paste_char_ratio DECIMAL,
+    delete_ratio DECIMAL,
+    focus_loss_count BIGINT,
+    linear_editing_score DECIMAL,
+    burstiness DECIMAL,
+    time_to_first_run DECIMAL,
+    execution_count BIGINT,
+    total_time DECIMAL,
+    keystroke_count BIGINT,
+    non_linear_navigation DECIMAL,
+    undo_frequency DECIMAL,
+    selection_count BIGINT,
+    find_replace_count BIGINT,
+
     -- Raw event data
-    paste_event_details JSONB,
-    
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+    paste_event_details TEXT, -- JSON
+    paste_provenance TEXT, -- JSON list of classified pastes
+
+    -- Session and integrity
+    session_id BIGINT,
+    final_telemetry_id BIGINT, -- telemetry_data row of the final batch
+    integrity_signals TEXT, -- JSON array
+    receipt_id TEXT,
+    idempotency_key TEXT UNIQUE,
+
+    created_at TIMESTAMPTZ
 );
 
 -- Telemetry data table (Real-time behavioral data)
 CREATE TABLE telemetry_data (
-    id SERIAL PRIMARY KEY,
-    activity_id INTEGER REFERENCES activities(id) ON DELETE CASCADE,
-    student_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
-    timestamp BIGINT NOT NULL,
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    student_id BIGINT NOT NULL,
+    session_id BIGINT,
+    sequence BIGINT,
+    timestamp BIGINT NOT NULL, -- Client time the batch was produced (ms)
+    received_at BIGINT, -- Server time the batch arrived (ms)
+    late BOOLEAN DEFAULT FALSE, -- Buffered offline and uploaded late
     is_final BOOLEAN DEFAULT FALSE,
-    
-    -- Features and raw events stored as JSONB
-    features JSONB,
-    raw_events JSONB,
-    
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+
+    -- Features and raw events stored as JSON
+    features TEXT,
+    raw_events TEXT, -- Cleared once the raw retention expires
+
+    signature TEXT,
+    integrity TEXT DEFAULT 'ok', -- ok or the integrity signal of the batch
+    created_at TIMESTAMPTZ
+);
+
+-- Signed telemetry sessions (one per join)
+CREATE TABLE telemetry_sessions (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    student_id BIGINT NOT NULL,
+    session_key TEXT NOT NULL,
+    last_sequence BIGINT NOT NULL DEFAULT 0,
+    last_hash TEXT,
+    integrity_signals TEXT, -- JSON array
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Ingestion queue of the database backend, and batches that kept failing
+CREATE TABLE telemetry_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    payload TEXT NOT NULL, -- JSON encoded telemetry row
+    attempts BIGINT NOT NULL DEFAULT 0,
+    leased_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE telemetry_dead_letters (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT,
+    student_id BIGINT,
+    payload TEXT NOT NULL,
+    attempts BIGINT,
+    last_error TEXT,
+    created_at TIMESTAMPTZ
+);
+
+-- Compacted telemetry: the non-final rows of a session, gzipped
+CREATE TABLE telemetry_archives (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    student_id BIGINT NOT NULL,
+    session_id BIGINT,
+    row_count BIGINT NOT NULL,
+    first_timestamp BIGINT,
+    last_timestamp BIGINT,
+    data BYTEA,
+    raw_purged_at TIMESTAMPTZ, -- Raw events removed, features kept
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Periods a student was offline, from buffered batches
+CREATE TABLE telemetry_outages (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    student_id BIGINT NOT NULL,
+    session_id BIGINT,
+    started_at BIGINT NOT NULL, -- Client time (ms)
+    ended_at BIGINT NOT NULL, -- Client time (ms)
+    buffered_batches BIGINT NOT NULL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Rule overrides, global (activity_id NULL) or per activity
+CREATE TABLE analysis_rules (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT,
+    name TEXT NOT NULL,
+    enabled BOOLEAN,
+    threshold DECIMAL,
+    weight DECIMAL,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Running statistics of each student's earlier submissions
+CREATE TABLE student_baselines (
+    id BIGSERIAL PRIMARY KEY,
+    student_id BIGINT NOT NULL UNIQUE,
+    submission_count BIGINT NOT NULL DEFAULT 0,
+    stats TEXT, -- JSON map of feature statistics
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Keystroke dynamics of each student
+CREATE TABLE keystroke_profiles (
+    id BIGSERIAL PRIMARY KEY,
+    student_id BIGINT NOT NULL UNIQUE,
+    session_count BIGINT NOT NULL DEFAULT 0,
+    dwell_count BIGINT,
+    dwell_mean DECIMAL,
+    dwell_m2 DECIMAL,
+    flight_count BIGINT,
+    flight_mean DECIMAL,
+    flight_m2 DECIMAL,
+    digraph_stats TEXT, -- JSON map keyed "KeyA>KeyB"
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- Professor labels, the training data of the scoring model
+CREATE TABLE submission_labels (
+    id BIGSERIAL PRIMARY KEY,
+    submission_id BIGINT NOT NULL,
+    activity_id BIGINT NOT NULL,
+    professor_id BIGINT NOT NULL,
+    label TEXT NOT NULL,
+    notes TEXT,
+    created_at TIMESTAMPTZ
+);
+
+-- Every analysis of a submission, and the re-analysis jobs producing them
+CREATE TABLE analysis_runs (
+    id BIGSERIAL PRIMARY KEY,
+    submission_id BIGINT NOT NULL,
+    activity_id BIGINT NOT NULL,
+    job_id BIGINT,
+    trigger TEXT NOT NULL,
+    analysis_version TEXT NOT NULL,
+    detector_versions TEXT NOT NULL,
+    scorer TEXT NOT NULL,
+    rules_hash TEXT NOT NULL,
+    authorship_score DECIMAL,
+    confidence TEXT,
+    confidence_score DECIMAL,
+    signals TEXT,
+    detector_results TEXT,
+    applied BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE reanalysis_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    professor_id BIGINT NOT NULL,
+    activity_id BIGINT,
+    semester_id BIGINT,
+    apply BOOLEAN NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    total BIGINT,
+    processed BIGINT,
+    changed BIGINT,
+    skipped BIGINT,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+
+-- Code similarity between submissions of an activity
+CREATE TABLE similarity_detections (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    submission_id1 BIGINT NOT NULL,
+    submission_id2 BIGINT NOT NULL,
+    student_id1 BIGINT NOT NULL,
+    student_id2 BIGINT NOT NULL,
+    similarity_score DECIMAL NOT NULL,
+    algorithm TEXT NOT NULL,
+    is_suspicious BOOLEAN NOT NULL,
+    cluster_id BIGINT,
+    job_id BIGINT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE similarity_clusters (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    cluster_size BIGINT NOT NULL,
+    avg_similarity DECIMAL,
+    suspicion_level TEXT, -- low, medium or high
+    job_id BIGINT,
+    created_at TIMESTAMPTZ
+);
+
+CREATE TABLE similarity_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    activity_id BIGINT NOT NULL,
+    professor_id BIGINT NOT NULL,
+    trigger TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    total_pairs BIGINT,
+    compared_pairs BIGINT,
+    suspicious_pairs BIGINT,
+    progress DECIMAL,
+    error TEXT,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ
+);
+
+-- Detections of each job, kept to compare jobs
+CREATE TABLE similarity_run_detections (
+    id BIGSERIAL PRIMARY KEY,
+    job_id BIGINT NOT NULL,
+    activity_id BIGINT NOT NULL,
+    submission_id1 BIGINT NOT NULL,
+    submission_id2 BIGINT NOT NULL,
+    student_id1 BIGINT NOT NULL,
+    student_id2 BIGINT NOT NULL,
+    similarity_score DECIMAL NOT NULL,
+    algorithm TEXT NOT NULL,
+    is_suspicious BOOLEAN NOT NULL,
+    created_at TIMESTAMPTZ
 );
 
 -- Indexes for performance
+CREATE INDEX idx_semester ON semesters(year, period);
+CREATE INDEX idx_semesters_created_by ON semesters(created_by);
 CREATE INDEX idx_activities_professor ON activities(professor_id);
+CREATE INDEX idx_activities_semester ON activities(semester_id);
 CREATE INDEX idx_activities_invite ON activities(invite_token);
 CREATE INDEX idx_submissions_activity ON submissions(activity_id);
 CREATE INDEX idx_submissions_student ON submissions(student_id);
+CREATE INDEX idx_submissions_session ON submissions(session_id);
+CREATE INDEX idx_submissions_receipt ON submissions(receipt_id);
+CREATE INDEX idx_submissions_analysis_pending ON submissions(analysis_pending);
 CREATE INDEX idx_telemetry_activity ON telemetry_data(activity_id);
 CREATE INDEX idx_telemetry_student ON telemetry_data(student_id);
+CREATE INDEX idx_telemetry_session ON telemetry_data(session_id);
+-- One accepted row per signed batch; replayed and forged batches are kept as evidence
+CREATE UNIQUE INDEX idx_telemetry_session_sequence ON telemetry_data(session_id, sequence)
+    WHERE sequence > 0 AND integrity <> 'replayed_batch' AND integrity <> 'invalid_signature' AND integrity <> 'session_mismatch';
 CREATE INDEX idx_telemetry_timestamp ON telemetry_data(timestamp);
+CREATE INDEX idx_telemetry_sessions_activity ON telemetry_sessions(activity_id);
+CREATE INDEX idx_telemetry_sessions_student ON telemetry_sessions(student_id);
+CREATE INDEX idx_telemetry_jobs_leased_until ON telemetry_jobs(leased_until);
+CREATE INDEX idx_telemetry_jobs_created_at ON telemetry_jobs(created_at);
+CREATE INDEX idx_dead_letters_activity ON telemetry_dead_letters(activity_id);
+CREATE INDEX idx_dead_letters_student ON telemetry_dead_letters(student_id);
+CREATE INDEX idx_archive_session ON telemetry_archives(activity_id, student_id, session_id);
+CREATE INDEX idx_archives_last_timestamp ON telemetry_archives(last_timestamp);
+CREATE INDEX idx_outages_activity ON telemetry_outages(activity_id);
+CREATE INDEX idx_outages_student ON telemetry_outages(student_id);
+CREATE INDEX idx_outages_session ON telemetry_outages(session_id);
+CREATE INDEX idx_analysis_rules_activity ON analysis_rules(activity_id);
+CREATE INDEX idx_labels_submission ON submission_labels(submission_id);
+CREATE INDEX idx_labels_activity ON submission_labels(activity_id);
+CREATE INDEX idx_analysis_runs_submission ON analysis_runs(submission_id);
+CREATE INDEX idx_analysis_runs_activity ON analysis_runs(activity_id);
+CREATE INDEX idx_analysis_runs_job ON analysis_runs(job_id);
+CREATE INDEX idx_analysis_runs_version ON analysis_runs(analysis_version);
+CREATE INDEX idx_reanalysis_jobs_professor ON reanalysis_jobs(professor_id);
+CREATE INDEX idx_reanalysis_jobs_activity ON reanalysis_jobs(activity_id);
+CREATE INDEX idx_reanalysis_jobs_semester ON reanalysis_jobs(semester_id);
+CREATE UNIQUE INDEX idx_similarity_pair ON similarity_detections(activity_id, submission_id1, submission_id2, algorithm);
+CREATE INDEX idx_similarity_suspicious ON similarity_detections(is_suspicious);
+CREATE INDEX idx_similarity_cluster ON similarity_detections(cluster_id);
+CREATE INDEX idx_similarity_job ON similarity_detections(job_id);
+CREATE INDEX idx_similarity_clusters_activity ON similarity_clusters(activity_id);
+CREATE INDEX idx_similarity_clusters_job ON similarity_clusters(job_id);
+CREATE INDEX idx_similarity_jobs_activity ON similarity_jobs(activity_id);
+CREATE INDEX idx_similarity_jobs_professor ON similarity_jobs(professor_id);
+CREATE UNIQUE INDEX idx_similarity_run_pair ON similarity_run_detections(job_id, submission_id1, submission_id2, algorithm);
+CREATE INDEX idx_similarity_run_activity ON similarity_run_detections(activity_id);
 
 -- Example data
 
@@ -88,9 +390,15 @@ CREATE INDEX idx_telemetry_timestamp ON telemetry_data(timestamp);
 INSERT INTO users (email, password, name, role) 
 VALUES ('professor@dalivim.com', 'hashed_password', 'Prof. Silva', 'professor');
 
+-- Insert a semester keeping raw events for a year and features forever
+INSERT INTO semesters (year, period, start_date, end_date, raw_retention_days, feature_retention_days)
+VALUES (2024, 1, '2024-02-01', '2024-07-15', 365, 0);
+
 -- Insert an activity
-INSERT INTO activities (professor_id, title, description, language, time_limit, invite_token)
+INSERT INTO activities (professor_id, semester_id, target_semester, title, description, language, time_limit, invite_token)
 VALUES (
+    1,
+    1,
     1,
     'Implementar Bubble Sort',
     'Crie uma função que ordena um array usando o algoritmo Bubble Sort. A função deve receber um array de números e retornar o array ordenado.',
@@ -129,7 +437,7 @@ INSERT INTO submissions (
     'def bubble_sort(arr):\n    n = len(arr)\n    for i in range(n):\n        for j in range(0, n-i-1):\n            if arr[j] > arr[j+1]:\n                arr[j], arr[j+1] = arr[j+1], arr[j]\n    return arr',
     0.73,
     'medium',
-    ARRAY['moderate_paste_ratio', 'low_edit_ratio'],
+    '["moderate_paste_ratio", "low_edit_ratio"]',
     150.5,
     2,
     0.35,
@@ -167,8 +475,8 @@ ORDER BY s.authorship_score ASC;
 -- Get telemetry timeline for a student
 SELECT 
     timestamp,
-    features->>'avgKeystrokeInterval' as avg_keystroke,
-    features->>'pasteCharRatio' as paste_ratio,
+    features::json->>'avgKeystrokeInterval' as avg_keystroke,
+    features::json->>'pasteCharRatio' as paste_ratio,
     is_final
 FROM telemetry_data
 WHERE activity_id = 1 AND student_id = 2
@@ -183,7 +491,7 @@ SELECT
 FROM submissions s
 JOIN activities a ON s.activity_id = a.id
 WHERE s.authorship_score < 0.5
-  AND array_length(s.signals, 1) >= 3
+  AND json_array_length(s.signals::json) >= 3
 ORDER BY s.authorship_score ASC;
 
 -- Average metrics by activity